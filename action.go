@@ -3,6 +3,12 @@
 
 package main
 
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
 // Every shift or reduce operation is stored as one of the following
 type action struct {
 	sp    *symbol // The look-ahead symbol
@@ -17,3 +23,250 @@ type action struct {
 
 	seq int // mdhender: added to support sorting actions
 }
+
+// actionSeq is used to number actions in the order they are created.
+var actionSeq int
+
+// Action_add creates a new action and adds it to the front of a list.
+// The state is only used by SHIFT actions and the rule by REDUCE actions.
+func Action_add(app **action, type_ e_action, sp *symbol, stp *state, rp *rule) {
+	actionSeq++
+	newaction := &action{sp: sp, type_: type_, next: *app, seq: actionSeq}
+	newaction.x.stp, newaction.x.rp = stp, rp
+	*app = newaction
+}
+
+// actioncmp compares two actions for sorting purposes.
+// It returns negative, zero, or positive if the first action is less than,
+// equal to, or greater than the second.
+func actioncmp(ap1, ap2 *action) int {
+	rc := ap1.sp.index - ap2.sp.index
+	if rc == 0 {
+		rc = int(ap1.type_) - int(ap2.type_)
+	}
+	if rc == 0 && (ap1.type_ == REDUCE || ap1.type_ == SHIFTREDUCE) {
+		rc = ap1.x.rp.index - ap2.x.rp.index
+	}
+	if rc == 0 {
+		rc = ap2.seq - ap1.seq
+	}
+	return rc
+}
+
+// Action_sort sorts a list of actions.
+func Action_sort(ap *action) *action {
+	var list []*action
+	for ; ap != nil; ap = ap.next {
+		list = append(list, ap)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return actioncmp(list[i], list[j]) < 0
+	})
+	ap = nil
+	for i := len(list) - 1; i >= 0; i-- {
+		list[i].next, ap = ap, list[i]
+	}
+	return ap
+}
+
+// FindActions computes the reduce actions, and resolves conflicts.
+func FindActions(lemp *lemon) {
+	// Add all of the reduce actions. A reduce action is added for each element
+	// of the followset of a configuration which has its dot at the extreme right.
+	for i := 0; i < lemp.nstate; i++ { // Loop over all states
+		stp := lemp.sorted[i]
+		for cfp := stp.cfp; cfp != nil; cfp = cfp.next { // Loop over all configurations
+			if cfp.rp.nrhs == cfp.dot { // Is dot at extreme right?
+				for j := 0; j < lemp.nterminal; j++ {
+					if cfp.fws.Has(j) {
+						// Add a reduce action to the state "stp" which will reduce by the
+						// rule "cfp.rp" if the lookahead symbol is "lemp.symbols[j]"
+						Action_add(&stp.ap, REDUCE, lemp.symbols[j], nil, cfp.rp)
+					}
+				}
+			}
+		}
+	}
+
+	// Add to the start state of each entry point an action to ACCEPT if the
+	// lookahead is its start nonterminal. The first start state is state 0.
+	for _, ep := range lemp.entries {
+		Action_add(&ep.stp.ap, ACCEPT, ep.goal, nil, nil)
+	}
+
+	// resolve conflicts
+	for i := 0; i < lemp.nstate; i++ {
+		stp := lemp.sorted[i]
+		stp.ap = Action_sort(stp.ap)
+		for ap := stp.ap; ap != nil && ap.next != nil; ap = ap.next {
+			for nap := ap.next; nap != nil && nap.sp == ap.sp; nap = nap.next {
+				// The two actions "ap" and "nap" have the same lookahead.
+				// Figure out which one should be used.
+				lemp.nconflict += resolve_conflict(ap, nap)
+			}
+		}
+	}
+
+	// count the conflicts that couldn't be resolved
+	for i := 0; i < lemp.nstate; i++ {
+		for ap := lemp.sorted[i].ap; ap != nil; ap = ap.next {
+			switch ap.type_ {
+			case SRCONFLICT:
+				lemp.nsrconflict++
+			case RRCONFLICT:
+				lemp.nrrconflict++
+			}
+		}
+	}
+
+	// report each of them, unless they were all expected
+	expected := lemp.conflictsExpected()
+	for i := 0; i < lemp.nstate; i++ {
+		for ap := lemp.sorted[i].ap; ap != nil; ap = ap.next {
+			switch ap.type_ {
+			case SSCONFLICT:
+				lemp.warningMsg(CONFLICTS, lemp.filename, 0, "shift/shift conflict in state %d on %s.", i, ap.sp.displayName())
+			case SRCONFLICT:
+				if expected {
+					continue
+				}
+				lemp.warningMsg(CONFLICTS, lemp.filename, ap.x.rp.ruleline, "shift/reduce conflict in state %d on %s.", i, ap.sp.displayName())
+			case RRCONFLICT:
+				if expected {
+					continue
+				}
+				lemp.warningMsg(CONFLICTS, lemp.filename, ap.x.rp.ruleline, "reduce/reduce conflict in state %d on %s.", i, ap.sp.displayName())
+			}
+			if (ap.type_ == SRCONFLICT || ap.type_ == RRCONFLICT) && lemp.warningEnabled(CONFLICTS) && lemp.warningEnabled(COUNTEREXAMPLES) {
+				lemp.explainConflict(lemp.sorted[i], ap)
+			}
+		}
+	}
+
+	// report each rule that can never be reduced.
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		rp.canReduce = false
+	}
+	for i := 0; i < lemp.nstate; i++ {
+		for ap := lemp.sorted[i].ap; ap != nil; ap = ap.next {
+			if ap.type_ == REDUCE {
+				ap.x.rp.canReduce = true
+			}
+		}
+	}
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		if !rp.canReduce {
+			lemp.warningMsg(NEVER_REDUCED_RULE, lemp.filename, rp.ruleline, "This rule can not be reduced.")
+		}
+	}
+}
+
+// conflictsExpected compares the number of unresolved conflicts to the
+// counts from %expect and %expect_rr. A count that isn't declared is zero.
+// It returns true if either count was declared and both of them match;
+// a mismatch is reported as an error.
+func (lemp *lemon) conflictsExpected() bool {
+	if lemp.expectLineno == 0 && lemp.expectRRLineno == 0 {
+		return false
+	}
+	expected := true
+	for _, decl := range []struct {
+		keyword string
+		value   string
+		lineno  int
+		found   int
+		kind    string
+	}{
+		{keyword: "expect", value: lemp.expect, lineno: lemp.expectLineno, found: lemp.nsrconflict, kind: "shift/reduce"},
+		{keyword: "expect_rr", value: lemp.expectRR, lineno: lemp.expectRRLineno, found: lemp.nrrconflict, kind: "reduce/reduce"},
+	} {
+		if decl.lineno == 0 {
+			if decl.found != 0 {
+				ErrorMsg(lemp.filename, 0, "the grammar has %d %s conflicts, but there is no %%%s.", decl.found, decl.kind, decl.keyword)
+				lemp.errorcnt++
+				expected = false
+			}
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(decl.value))
+		if err != nil || n < 0 {
+			ErrorMsg(lemp.filename, decl.lineno, "the argument to %%%s must be a number of conflicts, not %q.", decl.keyword, decl.value)
+			lemp.errorcnt++
+			expected = false
+		} else if n != decl.found {
+			ErrorMsg(lemp.filename, decl.lineno, "%%%s declares %d %s conflicts, but the grammar has %d.", decl.keyword, n, decl.kind, decl.found)
+			lemp.errorcnt++
+			expected = false
+		}
+	}
+	return expected
+}
+
+// resolve_conflict resolves a conflict between the two given actions.
+// If the conflict can't be resolved, it returns non-zero.
+//
+// NO LONGER TRUE:
+//
+//	To resolve a conflict, first look to see if either action
+//	is on an error rule.  In that case, take the action which
+//	is not associated with the error rule.  If neither or both
+//	actions are associated with an error rule, then try to
+//	use precedence to resolve the conflict.
+//
+// If either action is a SHIFT, then it must be apx.  This
+// function won't work if apx.type==REDUCE and apy.type==SHIFT.
+//
+// Symbols whose precedence is used to resolve a conflict are marked
+// so that useless precedence declarations can be reported.
+func resolve_conflict(apx, apy *action) int {
+	if apx.sp != apy.sp { // Otherwise there would be no conflict
+		panic("assert(apx.sp == apy.sp)")
+	}
+	errcnt := 0
+	if apx.type_ == SHIFT && apy.type_ == SHIFT {
+		apy.type_ = SSCONFLICT
+		errcnt++
+	}
+	if apx.type_ == SHIFT && apy.type_ == REDUCE {
+		spx, spy := apx.sp, apy.x.rp.precsym
+		if spy == nil || spx.prec < 0 || spy.prec < 0 {
+			// Not enough precedence information.
+			apy.type_ = SRCONFLICT
+			errcnt++
+		} else {
+			spx.precUsed, spy.precUsed = true, true
+			if spx.prec > spy.prec { // higher precedence wins
+				apy.type_ = RD_RESOLVED
+			} else if spx.prec < spy.prec {
+				apx.type_ = SH_RESOLVED
+			} else if spx.prec == spy.prec && spx.assoc == RIGHT { // Use operator associativity to break tie
+				apy.type_ = RD_RESOLVED
+			} else if spx.prec == spy.prec && spx.assoc == LEFT {
+				apx.type_ = SH_RESOLVED
+			} else {
+				if !(spx.prec == spy.prec && spx.assoc == NONE) {
+					panic("assert(spx.prec == spy.prec && spx.assoc == NONE)")
+				}
+				apx.type_ = ERROR
+			}
+		}
+	} else if apx.type_ == REDUCE && apy.type_ == REDUCE {
+		spx, spy := apx.x.rp.precsym, apy.x.rp.precsym
+		if spx == nil || spy == nil || spx.prec < 0 || spy.prec < 0 || spx.prec == spy.prec {
+			apy.type_ = RRCONFLICT
+			errcnt++
+		} else {
+			spx.precUsed, spy.precUsed = true, true
+			if spx.prec > spy.prec {
+				apy.type_ = RD_RESOLVED
+			} else if spx.prec < spy.prec {
+				apx.type_ = RD_RESOLVED
+			}
+		}
+	} else {
+		// The REDUCE/SHIFT case cannot happen because SHIFTs come before
+		// REDUCEs on the list. If we reach this point it must be because
+		// the parser conflict had already been resolved.
+	}
+	return errcnt
+}
@@ -0,0 +1,430 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+// this file contains a syntax tree for grammar files.
+// unlike Parse, which feeds the symbol table and the rule list, the tree
+// keeps the comments and the layout hints that tools like the formatter
+// need to re-emit the file.
+
+import (
+	"bytes"
+	"fmt"
+)
+
+type astKind int
+
+const (
+	astComment   astKind = iota // a comment on a line by itself
+	astDirective                // a preprocessor line (%ifdef, %else, etc)
+	astDecl                     // a declaration (%name, %left, etc)
+	astRule                     // a production rule
+)
+
+// astToken is a token from the grammar file.
+// The line and column are 1-based; offset is the byte offset into the input.
+type astToken struct {
+	text   string
+	line   int
+	col    int
+	offset int
+}
+
+// end returns the byte offset just past the token.
+func (t astToken) end() int {
+	return t.offset + len(t.text)
+}
+
+// endLine returns the line on which the token ends.
+func (t astToken) endLine() int {
+	return t.line + bytes.Count([]byte(t.text), []byte{'\n'})
+}
+
+func (t astToken) isComment() bool {
+	return len(t.text) > 1 && t.text[0] == '/' && (t.text[1] == '/' || t.text[1] == '*')
+}
+
+func (t astToken) isCode() bool {
+	return len(t.text) != 0 && t.text[0] == '{'
+}
+
+func (t astToken) isIdent() bool {
+	return len(t.text) != 0 && isalnum(t.text[0])
+}
+
+type astFile struct {
+	filename string
+	input    []byte
+	items    []*astItem
+}
+
+type astItem struct {
+	kind        astKind
+	blankBefore bool       // true if a blank line separates this item from the previous one
+	start, end  int        // byte offsets of the item in the input
+	verbatim    bool       // true if the item can't be re-formatted and must be copied as is
+	text        astToken   // the comment or directive
+	keyword     astToken   // the declaration keyword, without the "%"
+	args        []astToken // the declaration arguments
+	terminated  bool       // true if the declaration argument list ended with "."
+	lhs         astToken   // the left-hand side of the rule
+	lhsalias    *astToken  // the alias for the left-hand side
+	rhs         []astToken // the tokens between the "::=" and the "."
+	prec        *astToken  // the precedence symbol for the rule
+	code        *astToken  // the code for the rule
+	trailing    *astToken  // comment following the item on the same line
+}
+
+// firstLine returns the line the item starts on.
+func (item *astItem) firstLine() int {
+	switch item.kind {
+	case astComment, astDirective:
+		return item.text.line
+	case astDecl:
+		return item.keyword.line
+	}
+	return item.lhs.line
+}
+
+// declShape describes the arguments taken by a declaration keyword.
+type declShape int
+
+const (
+	declSingle  declShape = iota // one argument, like %name or %include
+	declSymbol                   // a symbol and an argument, like %type or %destructor
+	declList                     // a list of symbols terminated by ".", like %left
+	declUnknown                  // not a known keyword
+)
+
+// declShapes maps each declaration keyword to the shape of its arguments.
+var declShapes = map[string]declShape{
+	"name":               declSingle,
+	"include":            declSingle,
+	"code":               declSingle,
+	"token_destructor":   declSingle,
+	"default_destructor": declSingle,
+	"token_prefix":       declSingle,
+	"syntax_error":       declSingle,
+	"parse_accept":       declSingle,
+	"parse_failure":      declSingle,
+	"stack_overflow":     declSingle,
+	"extra_argument":     declSingle,
+	"extra_context":      declSingle,
+	"token_type":         declSingle,
+	"default_type":       declSingle,
+	"location_type":      declSingle,
+	"stack_size":         declSingle,
+	"start_symbol":       declSingle,
+	"include_grammar":    declSingle,
+	"import_tokens":      declSingle,
+	"skip_pattern":       declSingle,
+	"expect":             declSingle,
+	"expect_rr":          declSingle,
+	"destructor":         declSymbol,
+	"type":               declSymbol,
+	"token_pattern":      declSymbol,
+	"left":               declList,
+	"right":              declList,
+	"nonassoc":           declList,
+	"fallback":           declList,
+	"token":              declList,
+	"wildcard":           declList,
+	"token_class":        declList,
+	"template":           declList,
+}
+
+func declShapeOf(keyword string) declShape {
+	if shape, ok := declShapes[keyword]; ok {
+		return shape
+	}
+	return declUnknown
+}
+
+// isPrecedenceKeyword returns true for the declarations that set precedence.
+func isPrecedenceKeyword(keyword string) bool {
+	return keyword == "left" || keyword == "right" || keyword == "nonassoc"
+}
+
+// astTokenize splits the input into tokens the same way that Parse does,
+// except that comments and preprocessor lines are returned as tokens.
+func astTokenize(filename string, input []byte) ([]astToken, error) {
+	var tokens []astToken
+	pos, line, col := 0, 1, 1
+	// advance moves the position forward, keeping track of lines and columns
+	advance := func(n int) {
+		for ; n > 0 && pos < len(input); n-- {
+			if input[pos] == '\n' {
+				line, col = line+1, 1
+			} else {
+				col++
+			}
+			pos++
+		}
+	}
+	for pos < len(input) {
+		if col == 1 && isPreprocessorLine(input[pos:]) {
+			end := bytes.IndexByte(input[pos:], '\n')
+			if end == -1 {
+				end = len(input) - pos
+			}
+			tokens = append(tokens, astToken{text: string(input[pos : pos+end]), line: line, col: col, offset: pos})
+			advance(end)
+			continue
+		} else if isspace(input[pos]) {
+			advance(1)
+			continue
+		}
+
+		tok := astToken{line: line, col: col, offset: pos}
+		var n int
+		if comment := scanCPPComment(input[pos:]); len(comment) != 0 {
+			n = len(comment)
+		} else if comment := scanCComment(input[pos:]); len(comment) != 0 {
+			if !bytes.HasSuffix(comment, []byte{'*', '/'}) || len(comment) < 4 {
+				return nil, fmt.Errorf("%s:%d: comment starting on this line is not terminated before the end of the file", filename, line)
+			}
+			n = len(comment)
+		} else if literal := scanStringLiteral(input[pos:]); literal != nil {
+			if len(literal) == 1 || literal[len(literal)-1] != '"' {
+				return nil, fmt.Errorf("%s:%d: string starting on this line is not terminated before the end of the file", filename, line)
+			}
+			n = len(literal)
+		} else if codeBlock, err := scanCodeBlock(input[pos:]); codeBlock != nil {
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: C code starting on this line: %v", filename, line, err)
+			}
+			n = len(codeBlock)
+		} else if isalnum(input[pos]) {
+			for n = 1; pos+n < len(input) && (input[pos+n] == '_' || isalnum(input[pos+n])); n++ {
+				//
+			}
+		} else if bytes.HasPrefix(input[pos:], []byte{':', ':', '='}) {
+			n = 3
+		} else if len(input[pos:]) > 1 && (input[pos] == '/' || input[pos] == '|') && isalpha(input[pos+1]) {
+			for n = 1; pos+n < len(input) && (input[pos+n] == '_' || isalnum(input[pos+n])); n++ {
+				//
+			}
+		} else {
+			n = 1
+		}
+		tok.text = string(input[pos : pos+n])
+		tokens = append(tokens, tok)
+		advance(n)
+	}
+	return tokens, nil
+}
+
+// isPreprocessorLine returns true if the line is one of the macros
+// handled by the preprocessor.
+func isPreprocessorLine(input []byte) bool {
+	for _, macro := range []string{"%ifndef", "%ifdef", "%if", "%else", "%endif"} {
+		if ismacro(input, macro) {
+			return true
+		}
+	}
+	return false
+}
+
+// astParse reads the text of a grammar file into a syntax tree.
+func astParse(filename string, input []byte) (*astFile, error) {
+	tokens, err := astTokenize(filename, input)
+	if err != nil {
+		return nil, err
+	}
+	f := &astFile{filename: filename, input: input}
+	p := &astParser{f: f, tokens: tokens}
+	for p.pos < len(p.tokens) {
+		if err := p.parseItem(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+type astParser struct {
+	f      *astFile
+	tokens []astToken
+	pos    int
+	inline []astToken // comments found inside of the current item
+}
+
+func (p *astParser) errorf(tok astToken, format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", p.f.filename, tok.line, fmt.Sprintf(format, args...))
+}
+
+// blankBefore returns true if there is a blank line before the token.
+func (p *astParser) blankBefore(tok astToken) bool {
+	if len(p.f.items) == 0 {
+		return false
+	}
+	prev := p.f.items[len(p.f.items)-1]
+	return bytes.Count(p.f.input[prev.end:tok.offset], []byte{'\n'}) > 1
+}
+
+// next returns the next token that isn't a comment.
+// Comments are saved so the item can be marked as verbatim.
+func (p *astParser) next() (astToken, bool) {
+	for p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		p.pos++
+		if tok.isComment() || isPreprocessorLine([]byte(tok.text)) {
+			p.inline = append(p.inline, tok)
+			continue
+		}
+		return tok, true
+	}
+	return astToken{}, false
+}
+
+// peek returns the next token that isn't a comment without consuming it.
+func (p *astParser) peek() (astToken, bool) {
+	for i := p.pos; i < len(p.tokens); i++ {
+		if !p.tokens[i].isComment() && !isPreprocessorLine([]byte(p.tokens[i].text)) {
+			return p.tokens[i], true
+		}
+	}
+	return astToken{}, false
+}
+
+func (p *astParser) parseItem() error {
+	tok := p.tokens[p.pos]
+	item := &astItem{blankBefore: p.blankBefore(tok), start: tok.offset}
+	p.inline = nil
+	if tok.isComment() {
+		p.pos++
+		item.kind, item.text, item.end = astComment, tok, tok.end()
+		p.f.items = append(p.f.items, item)
+		return nil
+	} else if isPreprocessorLine([]byte(tok.text)) {
+		p.pos++
+		item.kind, item.text, item.end = astDirective, tok, tok.end()
+		p.f.items = append(p.f.items, item)
+		return nil
+	}
+
+	var last astToken
+	var err error
+	if tok.text == "%" {
+		item.kind = astDecl
+		last, err = p.parseDecl(item)
+	} else if isalpha(tok.text[0]) {
+		item.kind = astRule
+		last, err = p.parseRule(item)
+	} else {
+		return p.errorf(tok, "token %q should be either \"%%\" or a non-terminal name", tok.text)
+	}
+	if err != nil {
+		return err
+	}
+	item.end = last.end()
+	if len(p.inline) != 0 {
+		// comments inside the item are kept by copying the item as is
+		item.verbatim = true
+	}
+
+	// a comment on the same line as the end of the item belongs to the item
+	if p.pos < len(p.tokens) && p.tokens[p.pos].isComment() && p.tokens[p.pos].line == last.endLine() {
+		trailing := p.tokens[p.pos]
+		item.trailing, item.end = &trailing, trailing.end()
+		p.pos++
+	}
+	p.f.items = append(p.f.items, item)
+	return nil
+}
+
+func (p *astParser) parseDecl(item *astItem) (last astToken, err error) {
+	pct, _ := p.next()
+	keyword, ok := p.next()
+	if !ok || !isalpha(keyword.text[0]) {
+		return pct, p.errorf(pct, "illegal declaration keyword")
+	}
+	item.keyword, last = keyword, keyword
+	switch declShapeOf(keyword.text) {
+	case declSingle:
+		arg, ok := p.next()
+		if !ok {
+			return last, p.errorf(keyword, "missing argument to %%%s", keyword.text)
+		}
+		item.args = append(item.args, arg)
+		return arg, nil
+	case declSymbol:
+		for i := 0; i < 2; i++ {
+			arg, ok := p.next()
+			if !ok {
+				return last, p.errorf(keyword, "missing argument to %%%s", keyword.text)
+			}
+			item.args, last = append(item.args, arg), arg
+		}
+		return last, nil
+	case declUnknown:
+		// guess at the shape from the first argument
+		if arg, ok := p.peek(); ok && (arg.isCode() || arg.text[0] == '"') {
+			arg, _ = p.next()
+			item.args = append(item.args, arg)
+			return arg, nil
+		}
+	}
+	for {
+		arg, ok := p.next()
+		if !ok {
+			return last, p.errorf(keyword, "missing \".\" after %%%s", keyword.text)
+		} else if arg.text == "." {
+			item.terminated = true
+			return arg, nil
+		}
+		item.args, last = append(item.args, arg), arg
+	}
+}
+
+func (p *astParser) parseRule(item *astItem) (last astToken, err error) {
+	item.lhs, _ = p.next()
+	tok, ok := p.next()
+	if ok && tok.text == "(" {
+		alias, ok := p.next()
+		if !ok || !isalpha(alias.text[0]) {
+			return tok, p.errorf(tok, "missing alias for the LHS %q", item.lhs.text)
+		}
+		item.lhsalias = &alias
+		if tok, ok = p.next(); !ok || tok.text != ")" {
+			return alias, p.errorf(alias, "missing \")\" following LHS alias name %q", alias.text)
+		}
+		tok, ok = p.next()
+	}
+	if !ok || tok.text != "::=" {
+		return item.lhs, p.errorf(item.lhs, "expected to see a \"::=\" following the LHS symbol %q", item.lhs.text)
+	}
+	for {
+		tok, ok = p.next()
+		if !ok {
+			return last, p.errorf(item.lhs, "rule for %q is missing the terminating \".\"", item.lhs.text)
+		} else if tok.text == "." {
+			last = tok
+			break
+		}
+		item.rhs = append(item.rhs, tok)
+	}
+
+	// the precedence mark and the code may follow in either order
+	for {
+		tok, ok = p.peek()
+		if !ok {
+			return last, nil
+		} else if tok.text == "[" && item.prec == nil {
+			p.next()
+			prec, ok := p.next()
+			if !ok {
+				return tok, p.errorf(tok, "missing precedence symbol")
+			}
+			item.prec = &prec
+			if last, ok = p.next(); !ok || last.text != "]" {
+				return prec, p.errorf(prec, "missing \"]\" on precedence mark")
+			}
+		} else if tok.isCode() && item.code == nil {
+			code, _ := p.next()
+			item.code, last = &code, code
+		} else {
+			return last, nil
+		}
+	}
+}
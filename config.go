@@ -6,6 +6,7 @@ package main
 import (
 	"fmt"
 	"github.com/mdhender/lemon/internal/sets"
+	"sort"
 )
 
 type config struct {
@@ -23,3 +24,161 @@ type config struct {
 func (c *config) String() string {
 	return fmt.Sprintf("(config (hash %v) (dot %d))", confighash(c), c.dot)
 }
+
+// The configuration list is built up for one state at a time.
+// These variables hold the list under construction.
+var (
+	cfgCurrent    *config               // Top of list of configurations
+	cfgCurrentEnd *config               // Last configuration on the list
+	cfgBasis      *config               // Top of list of basis configurations
+	cfgBasisEnd   *config               // Last basis configuration on the list
+	cfgTable      map[configKey]*config // The configurations on the current list
+	cfgSetSize    int                   // Size of the follow sets
+)
+
+// configKey identifies a configuration by its rule and dot.
+type configKey struct {
+	rp  *rule
+	dot int
+}
+
+// Configlist_init initializes the configuration list builder.
+func Configlist_init(lemp *lemon) {
+	cfgSetSize = lemp.nterminal + 1
+	Configlist_reset()
+}
+
+// Configlist_reset empties the configuration list builder.
+func Configlist_reset() {
+	cfgCurrent, cfgCurrentEnd = nil, nil
+	cfgBasis, cfgBasisEnd = nil, nil
+	cfgTable = make(map[configKey]*config)
+}
+
+// Configlist_add adds another configuration to the configuration list.
+// If the configuration is already on the list, that one is returned.
+func Configlist_add(rp *rule, dot int) *config {
+	cfp := cfgTable[configKey{rp: rp, dot: dot}]
+	if cfp == nil {
+		cfp = &config{rp: rp, dot: dot, fws: sets.New(cfgSetSize)}
+		if cfgCurrentEnd == nil {
+			cfgCurrent = cfp
+		} else {
+			cfgCurrentEnd.next = cfp
+		}
+		cfgCurrentEnd = cfp
+		cfgTable[configKey{rp: rp, dot: dot}] = cfp
+	}
+	return cfp
+}
+
+// Configlist_addbasis adds a basis configuration to the configuration list.
+func Configlist_addbasis(rp *rule, dot int) *config {
+	cfp := cfgTable[configKey{rp: rp, dot: dot}]
+	if cfp == nil {
+		cfp = Configlist_add(rp, dot)
+		if cfgBasisEnd == nil {
+			cfgBasis = cfp
+		} else {
+			cfgBasisEnd.bp = cfp
+		}
+		cfgBasisEnd = cfp
+	}
+	return cfp
+}
+
+// Configlist_closure computes the closure of the configuration list.
+func Configlist_closure(lemp *lemon) {
+	for cfp := cfgCurrent; cfp != nil; cfp = cfp.next {
+		rp, dot := cfp.rp, cfp.dot
+		if dot >= rp.nrhs {
+			continue
+		}
+		sp := rp.rhs[dot]
+		if sp.type_ != NONTERMINAL {
+			continue
+		}
+		if sp.rule == nil && sp != lemp.errsym {
+			ErrorMsg(lemp.filename, rp.ruleline, "Nonterminal \"%s\" has no rules.", sp.name)
+			lemp.errorcnt++
+		}
+		for newrp := sp.rule; newrp != nil; newrp = newrp.nextlhs {
+			newcfp := Configlist_add(newrp, 0)
+			i := dot + 1
+			for ; i < rp.nrhs; i++ {
+				xsp := rp.rhs[i]
+				if xsp.type_ == TERMINAL {
+					newcfp.fws.Add(xsp.index)
+					break
+				} else if xsp.type_ == MULTITERMINAL {
+					for k := 0; k < xsp.nsubsym; k++ {
+						newcfp.fws.Add(xsp.subsym[k].index)
+					}
+					break
+				} else {
+					newcfp.fws.Union(xsp.firstset)
+					if !xsp.lambda {
+						break
+					}
+				}
+			}
+			if i == rp.nrhs {
+				Plink_add(&cfp.fplp, newcfp)
+			}
+		}
+	}
+}
+
+// Configlist_sort sorts the configuration list.
+func Configlist_sort() {
+	var list []*config
+	for cfp := cfgCurrent; cfp != nil; cfp = cfp.next {
+		list = append(list, cfp)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].less(list[j])
+	})
+	cfgCurrent, cfgCurrentEnd = nil, nil
+	for i := len(list) - 1; i >= 0; i-- {
+		list[i].next, cfgCurrent = cfgCurrent, list[i]
+	}
+}
+
+// Configlist_sortbasis sorts the basis configuration list.
+func Configlist_sortbasis() {
+	var list []*config
+	for cfp := cfgBasis; cfp != nil; cfp = cfp.bp {
+		list = append(list, cfp)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].less(list[j])
+	})
+	cfgBasis, cfgBasisEnd = nil, nil
+	for i := len(list) - 1; i >= 0; i-- {
+		list[i].bp, cfgBasis = cfgBasis, list[i]
+	}
+}
+
+// Configlist_return returns a pointer to the head of the configuration list
+// and resets the list.
+func Configlist_return() *config {
+	old := cfgCurrent
+	cfgCurrent, cfgCurrentEnd = nil, nil
+	return old
+}
+
+// Configlist_basis returns a pointer to the head of the basis list
+// and resets the list.
+func Configlist_basis() *config {
+	old := cfgBasis
+	cfgBasis, cfgBasisEnd = nil, nil
+	return old
+}
+
+// less compares two configurations by rule and then by dot.
+func (c *config) less(c2 *config) bool {
+	if c.rp.index != c2.rp.index {
+		return c.rp.index < c2.rp.index
+	}
+	return c.dot < c2.dot
+}
@@ -0,0 +1,452 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+// this file contains the counterexamples for conflicts.
+//
+// for a conflict in a state, we find the shortest stacks of states that
+// reach it and run the parser forward from each stack, once for each of the
+// two actions in the conflict. that gives an input prefix and the two
+// derivations that compete for it. if neither action can lead to the
+// lookahead being shifted, the lookahead was merged in from another state
+// and the conflict is an artifact of LALR(1). otherwise we count the parses
+// of the example inputs to decide if the grammar is ambiguous.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The limits on the searches for counterexamples. The searches stop when
+// they hit a limit, so a big grammar gets a less certain answer instead of
+// a slow one.
+const (
+	ceMaxStacks      = 64   // stacks that reach the conflict state
+	ceMaxSearch      = 5000 // partial stacks explored while looking for them
+	ceMaxCompletions = 5000 // configurations explored to finish the input
+	ceMaxReductions  = 200  // reductions on one lookahead
+)
+
+// ceNode is a node in the parse tree of a counterexample.
+type ceNode struct {
+	sp       *symbol
+	rp       *rule // the rule that was reduced, or nil for a leaf
+	children []*ceNode
+	dot      bool // true if the conflict is just before this leaf
+}
+
+// String returns the tree with each reduction written as "lhs(children)".
+func (n *ceNode) String() string {
+	sb := &strings.Builder{}
+	n.write(sb)
+	return sb.String()
+}
+
+func (n *ceNode) write(sb *strings.Builder) {
+	if n.dot {
+		sb.WriteString("• ")
+	}
+	sb.WriteString(n.sp.displayName())
+	if n.rp == nil {
+		return
+	}
+	sb.WriteByte('(')
+	for i, child := range n.children {
+		if i != 0 {
+			sb.WriteByte(' ')
+		}
+		child.write(sb)
+	}
+	sb.WriteByte(')')
+}
+
+// leaves appends the leaves of the tree to a list.
+func (n *ceNode) leaves(list []*ceNode) []*ceNode {
+	if n.rp == nil {
+		return append(list, n)
+	}
+	for _, child := range n.children {
+		list = child.leaves(list)
+	}
+	return list
+}
+
+// ceStack is the parser stack while running a counterexample.
+// The trees are the symbols between the states.
+type ceStack struct {
+	states []*state
+	trees  []*ceNode
+}
+
+func (stk ceStack) top() *state {
+	return stk.states[len(stk.states)-1]
+}
+
+func (stk ceStack) push(stp *state, tree *ceNode) ceStack {
+	return ceStack{
+		states: append(append([]*state{}, stk.states...), stp),
+		trees:  append(append([]*ceNode{}, stk.trees...), tree),
+	}
+}
+
+// key returns a string that identifies the states on the stack.
+func (stk ceStack) key() string {
+	sb := &strings.Builder{}
+	for _, stp := range stk.states {
+		_, _ = fmt.Fprintf(sb, "%d,", stp.statenum)
+	}
+	return sb.String()
+}
+
+// ceActions returns the actions of a state on a symbol that the parser could
+// take, including the ones that lost a conflict.
+func ceActions(stp *state, sp *symbol) (actions []*action) {
+	for ap := stp.ap; ap != nil; ap = ap.next {
+		if ap.sp != sp {
+			continue
+		}
+		switch ap.type_ {
+		case SHIFT, SSCONFLICT, REDUCE, SRCONFLICT, RRCONFLICT, ACCEPT:
+			actions = append(actions, ap)
+		}
+	}
+	return actions
+}
+
+// ceResult is what happens when the parser runs one action on a stack.
+type ceResult int
+
+const (
+	ceError    ceResult = iota // the lookahead is a syntax error
+	ceShifted                  // the lookahead was shifted
+	ceAccepted                 // the input was accepted
+)
+
+// run performs the action on the stack and then the reductions that follow
+// it, until the lookahead is shifted or the input is accepted. When follow
+// is set, the actions that lost conflicts are tried as well.
+func (lemp *lemon) run(stk ceStack, la *symbol, ap *action, follow bool, dot bool, depth int) (ceStack, ceResult) {
+	if depth > ceMaxReductions {
+		return stk, ceError
+	}
+	switch ap.type_ {
+	case SHIFT, SSCONFLICT:
+		return stk.push(ap.x.stp, &ceNode{sp: la, dot: dot}), ceShifted
+	case ACCEPT:
+		return stk, ceAccepted
+	}
+
+	// reduce, then go to the state for the left-hand side
+	rp := ap.x.rp
+	n := len(stk.states) - rp.nrhs
+	if n < 1 {
+		return stk, ceError
+	}
+	node := &ceNode{sp: rp.lhs, rp: rp, children: append([]*ceNode{}, stk.trees[n-1:]...)}
+	stk = ceStack{states: stk.states[:n], trees: stk.trees[:n-1]}
+	var next *state
+	for gp := stk.top().ap; gp != nil; gp = gp.next {
+		if gp.sp == rp.lhs && gp.type_ == SHIFT {
+			next = gp.x.stp
+		} else if gp.sp == rp.lhs && gp.type_ == ACCEPT && la.index == 0 {
+			return ceStack{states: stk.states, trees: append(append([]*ceNode{}, stk.trees...), node)}, ceAccepted
+		}
+	}
+	if next == nil {
+		return stk, ceError
+	}
+	stk = stk.push(next, node)
+
+	actions := ceActions(next, la)
+	if !follow && len(actions) > 1 {
+		actions = actions[:1]
+	}
+	for _, nap := range actions {
+		if result, outcome := lemp.run(stk, la, nap, follow, dot, depth+1); outcome != ceError {
+			return result, outcome
+		}
+	}
+	return stk, ceError
+}
+
+// complete finds the shortest input that takes the parser from the stack
+// to accepting. It returns the stack after the input is accepted.
+func (lemp *lemon) complete(stk ceStack) (ceStack, bool) {
+	seen := map[string]bool{stk.key(): true}
+	for queue := []ceStack{stk}; len(queue) != 0 && len(seen) < ceMaxCompletions; queue = queue[1:] {
+		for i := 0; i < lemp.nterminal; i++ {
+			la := lemp.symbols[i]
+			actions := ceActions(queue[0].top(), la)
+			if len(actions) == 0 {
+				continue
+			}
+			next, outcome := lemp.run(queue[0], la, actions[0], false, false, 0)
+			if outcome == ceAccepted {
+				return next, true
+			} else if outcome == ceShifted && !seen[next.key()] {
+				seen[next.key()] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return stk, false
+}
+
+// stacksTo returns the shortest stacks of states that reach the target
+// state from the start state, shortest first. It returns false if the
+// search stopped at one of the limits before looking at every stack.
+func (lemp *lemon) stacksTo(target *state) (stacks []ceStack, exhaustive bool) {
+	type edge struct {
+		from *state
+		sp   *symbol
+	}
+	preds := make(map[*state][]edge)
+	for _, stp := range lemp.sorted {
+		for ap := stp.ap; ap != nil; ap = ap.next {
+			if ap.type_ == SHIFT {
+				preds[ap.x.stp] = append(preds[ap.x.stp], edge{from: stp, sp: ap.sp})
+			}
+		}
+	}
+	// search backwards from the target. a state may appear twice in a
+	// stack so that loops in the automaton can provide more context.
+	type partial struct {
+		states  []*state
+		symbols []*symbol
+	}
+	queue := []partial{{states: []*state{target}}}
+	for searched := 0; len(queue) != 0 && len(stacks) < ceMaxStacks && searched < ceMaxSearch; queue, searched = queue[1:], searched+1 {
+		p := queue[0]
+		if lemp.isStartState(p.states[0]) {
+			stk := ceStack{states: p.states}
+			for _, sp := range p.symbols {
+				stk.trees = append(stk.trees, &ceNode{sp: sp})
+			}
+			stacks = append(stacks, stk)
+			continue
+		}
+		for _, e := range preds[p.states[0]] {
+			count := 0
+			for _, stp := range p.states {
+				if stp == e.from {
+					count++
+				}
+			}
+			if count < 2 {
+				queue = append(queue, partial{
+					states:  append([]*state{e.from}, p.states...),
+					symbols: append([]*symbol{e.sp}, p.symbols...),
+				})
+			}
+		}
+	}
+	return stacks, len(queue) == 0
+}
+
+// ceExample is the input and parse tree for one side of a conflict.
+type ceExample struct {
+	tree   *ceNode
+	prefix []*symbol // the symbols before the conflict
+	input  []*symbol // all the terminals, with the prefix expanded
+}
+
+// example runs one side of a conflict from the stack to the end of an input.
+func (lemp *lemon) example(stk ceStack, la *symbol, ap *action, yields map[*symbol][]*symbol) (*ceExample, bool) {
+	next, outcome := lemp.run(stk, la, ap, true, true, 0)
+	if outcome == ceShifted {
+		var ok bool
+		if next, ok = lemp.complete(next); !ok {
+			return nil, false
+		}
+	} else if outcome != ceAccepted {
+		return nil, false
+	}
+	if len(next.trees) != 1 {
+		return nil, false
+	}
+	ex := &ceExample{tree: next.trees[0]}
+	for _, tree := range stk.trees {
+		ex.prefix = append(ex.prefix, tree.sp)
+	}
+	for _, leaf := range ex.tree.leaves(nil) {
+		if leaf.sp.type_ == NONTERMINAL {
+			ex.input = append(ex.input, yields[leaf.sp]...)
+		} else if leaf.sp.index != 0 {
+			ex.input = append(ex.input, leaf.sp)
+		}
+	}
+	return ex, true
+}
+
+// shortestYields returns the shortest string of terminals that each
+// productive symbol derives. A multi-terminal yields its first terminal.
+func shortestYields(lemp *lemon) map[*symbol][]*symbol {
+	yields := make(map[*symbol][]*symbol)
+	for i := 0; i < lemp.nterminal; i++ {
+		yields[lemp.symbols[i]] = []*symbol{lemp.symbols[i]}
+	}
+	yieldOf := func(sp *symbol) ([]*symbol, bool) {
+		if sp.type_ == MULTITERMINAL {
+			return []*symbol{sp.subsym[0]}, true
+		}
+		y, ok := yields[sp]
+		return y, ok
+	}
+	for progress := true; progress; {
+		progress = false
+		for rp := lemp.rule; rp != nil; rp = rp.next {
+			var y []*symbol
+			ok := true
+			for _, sp := range rp.rhs {
+				var sy []*symbol
+				if sy, ok = yieldOf(sp); !ok {
+					break
+				}
+				y = append(y, sy...)
+			}
+			if old, found := yields[rp.lhs]; ok && (!found || len(y) < len(old)) {
+				yields[rp.lhs], progress = y, true
+			}
+		}
+	}
+	return yields
+}
+
+// countParses returns the number of ways the start symbol derives the
+// input, stopping at two. Derivations that loop without consuming input
+// are not counted.
+func countParses(lemp *lemon, start *symbol, input []*symbol) int {
+	type key struct {
+		sp   *symbol
+		i, j int
+	}
+	type seqKey struct {
+		rp      *rule
+		k, i, j int
+	}
+	memo, busy := make(map[key]int), make(map[key]bool)
+	seqMemo := make(map[seqKey]int)
+	var count func(sp *symbol, i, j int) int
+	var seq func(rp *rule, k, i, j int) int
+	count = func(sp *symbol, i, j int) int {
+		switch sp.type_ {
+		case TERMINAL:
+			if j == i+1 && input[i] == sp {
+				return 1
+			}
+			return 0
+		case MULTITERMINAL:
+			if j == i+1 {
+				for _, subsym := range sp.subsym {
+					if input[i] == subsym {
+						return 1
+					}
+				}
+			}
+			return 0
+		}
+		k := key{sp, i, j}
+		if n, ok := memo[k]; ok {
+			return n
+		} else if busy[k] {
+			return 0
+		}
+		busy[k] = true
+		n := 0
+		for rp := sp.rule; rp != nil && n < 2; rp = rp.nextlhs {
+			n = min(2, n+seq(rp, 0, i, j))
+		}
+		delete(busy, k)
+		memo[k] = n
+		return n
+	}
+	seq = func(rp *rule, k, i, j int) int {
+		if k == rp.nrhs {
+			if i == j {
+				return 1
+			}
+			return 0
+		}
+		sk := seqKey{rp, k, i, j}
+		if n, ok := seqMemo[sk]; ok {
+			return n
+		}
+		n := 0
+		for m := i; m <= j && n < 2; m++ {
+			if first := count(rp.rhs[k], i, m); first != 0 {
+				n = min(2, n+first*seq(rp, k+1, m, j))
+			}
+		}
+		seqMemo[sk] = n
+		return n
+	}
+	return count(start, 0, len(input))
+}
+
+// symbolNames returns the names of a list of symbols separated by spaces.
+// Terminals with a spelling are shown by their spelling.
+func symbolNames(list []*symbol) string {
+	var names []string
+	for _, sp := range list {
+		names = append(names, sp.displayName())
+	}
+	return strings.Join(names, " ")
+}
+
+// explainConflict writes a counterexample for a conflict as notes.
+// The action is the one that lost the conflict; the winner is the first
+// action in the state with the same lookahead.
+func (lemp *lemon) explainConflict(stp *state, loser *action) {
+	var winner *action
+	for ap := stp.ap; ap != nil; ap = ap.next {
+		if ap.sp == loser.sp {
+			winner = ap
+			break
+		}
+	}
+	if winner == nil || winner == loser {
+		return
+	}
+	la, lineno := loser.sp, loser.x.rp.ruleline
+	describe := func(ap *action) string {
+		if ap.type_ == SHIFT {
+			return "Shift"
+		}
+		sb := &strings.Builder{}
+		ap.x.rp.printCursor(sb, -1)
+		return fmt.Sprintf("Reduce by %s.", sb.String())
+	}
+
+	yields := shortestYields(lemp)
+	var first, second *ceExample
+	stacks, exhaustive := lemp.stacksTo(stp)
+	for _, stk := range stacks {
+		ex1, ok1 := lemp.example(stk, la, winner, yields)
+		ex2, ok2 := lemp.example(stk, la, loser, yields)
+		if ok1 && ok2 {
+			first, second = ex1, ex2
+			break
+		}
+	}
+	if first == nil {
+		if exhaustive {
+			lemp.noteMsg(lemp.filename, lineno, "This conflict is an LALR(1) artifact: no input that reaches state %d can be continued with %s after both actions. A canonical LR(1) parser would not have it.", stp.statenum, la.name)
+		} else {
+			lemp.noteMsg(lemp.filename, lineno, "No counterexample was found for this conflict within the search limits.")
+		}
+		return
+	}
+
+	lemp.noteMsg(lemp.filename, lineno, "Example: %s • %s", symbolNames(first.prefix), la.displayName())
+	lemp.noteMsg(lemp.filename, lineno, "%s derivation: %s", describe(winner), first.tree)
+	lemp.noteMsg(lemp.filename, lineno, "%s derivation: %s", describe(loser), second.tree)
+	start := first.tree.sp
+	for _, input := range [][]*symbol{first.input, second.input} {
+		if countParses(lemp, start, input) > 1 {
+			lemp.noteMsg(lemp.filename, lineno, "This conflict is an ambiguity: the input \"%s\" has more than one parse.", symbolNames(input))
+			return
+		}
+	}
+	lemp.noteMsg(lemp.filename, lineno, "This conflict is not an ambiguity in these examples: the parser needs more than one token of lookahead to choose.")
+}
@@ -0,0 +1,111 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCounterexamples(t *testing.T) {
+	type test_case struct {
+		id      int
+		grammar string
+		expect  []string // notes that must be reported, in order
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			grammar: "prog ::= expr.\nexpr ::= expr PLUS expr.\nexpr ::= NUM.\n",
+			expect: []string{
+				"note: Example: expr PLUS expr • PLUS",
+				"note: Shift derivation: prog(expr(expr PLUS expr(expr • PLUS expr(NUM))))",
+				"note: Reduce by expr ::= expr PLUS expr. derivation: prog(expr(expr(expr PLUS expr) • PLUS expr(NUM)))",
+				`note: This conflict is an ambiguity: the input "NUM PLUS NUM PLUS NUM" has more than one parse.`,
+			},
+		},
+		{id: 2,
+			grammar: "prog ::= s.\ns ::= IF E THEN s.\ns ::= IF E THEN s ELSE s.\ns ::= X.\n",
+			expect: []string{
+				`note: This conflict is an ambiguity: the input "IF E THEN IF E THEN X ELSE X" has more than one parse.`,
+			},
+		},
+		{id: 3,
+			grammar: "prog ::= s.\ns ::= a X.\ns ::= b X Y.\na ::= C.\nb ::= C.\n",
+			expect: []string{
+				"note: Example: C • X",
+				"note: This conflict is not an ambiguity in these examples: the parser needs more than one token of lookahead to choose.",
+			},
+		},
+		{id: 4,
+			grammar: "prog ::= s.\ns ::= A a D.\ns ::= B b D.\ns ::= A b E.\ns ::= B a E.\na ::= C.\nb ::= C.\n",
+			expect: []string{
+				"note: This conflict is an LALR(1) artifact: no input that reaches state 7 can be continued with D after both actions. A canonical LR(1) parser would not have it.",
+				"note: This conflict is an LALR(1) artifact: no input that reaches state 7 can be continued with E after both actions. A canonical LR(1) parser would not have it.",
+			},
+		},
+	} {
+		lem := parseGrammar(t, tc.grammar)
+		lem.warnings = newWarningFlags()
+		lem.warnings.enabled[COUNTEREXAMPLES] = true
+		var notes []string
+		msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+			if strings.HasPrefix(msg, "note: ") {
+				notes = append(notes, msg)
+			}
+		}
+		analyzeGrammar(lem)
+		msgHook = nil
+		got := strings.Join(notes, "\n")
+		from := 0
+		for _, want := range tc.expect {
+			n := strings.Index(got[from:], want)
+			if n < 0 {
+				t.Errorf("%d: want note %q\n%d: got\n%s\n", tc.id, want, tc.id, got)
+				break
+			}
+			from += n + len(want)
+		}
+	}
+
+	// without the category, the conflicts are reported without notes
+	lem := parseGrammar(t, "prog ::= expr.\nexpr ::= expr PLUS expr.\nexpr ::= NUM.\n")
+	lem.warnings = newWarningFlags()
+	var got []string
+	msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+		got = append(got, msg)
+	}
+	analyzeGrammar(lem)
+	msgHook = nil
+	if len(got) != 1 || !strings.Contains(got[0], "shift/reduce conflict") {
+		t.Errorf("default: want 1 conflict: got %q\n", got)
+	}
+}
+
+func TestCountParses(t *testing.T) {
+	type test_case struct {
+		id      int
+		grammar string
+		input   string
+		expect  int
+	}
+	for _, tc := range []test_case{
+		{id: 1, grammar: "prog ::= expr.\nexpr ::= expr PLUS expr.\nexpr ::= NUM.\n", input: "NUM", expect: 1},
+		{id: 2, grammar: "prog ::= expr.\nexpr ::= expr PLUS expr.\nexpr ::= NUM.\n", input: "NUM PLUS NUM", expect: 1},
+		{id: 3, grammar: "prog ::= expr.\nexpr ::= expr PLUS expr.\nexpr ::= NUM.\n", input: "NUM PLUS NUM PLUS NUM", expect: 2},
+		{id: 4, grammar: "prog ::= expr.\nexpr ::= expr PLUS expr.\nexpr ::= NUM.\n", input: "NUM NUM", expect: 0},
+		{id: 5, grammar: "prog ::= list.\nlist ::= list ITEM.\nlist ::= .\n", input: "ITEM ITEM ITEM", expect: 1},
+		{id: 6, grammar: "prog ::= a.\na ::= a.\na ::= X.\n", input: "X", expect: 1},
+	} {
+		lem := parseGrammar(t, tc.grammar)
+		FindRulePrecedences(lem.rule)
+		FindFirstSets(lem)
+		var input []*symbol
+		for _, name := range strings.Fields(tc.input) {
+			input = append(input, Symbol_find(name))
+		}
+		if got := countParses(lem, lem.startSymbol(), input); got != tc.expect {
+			t.Errorf("%d: want %d: got %d\n", tc.id, tc.expect, got)
+		}
+	}
+}
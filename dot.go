@@ -0,0 +1,161 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dotFilter selects the states that are written to the DOT graph.
+// A nil filter selects every state.
+type dotFilter map[int]bool
+
+// parseStateList returns the states in a list like "1,4-7".
+func parseStateList(list string) (dotFilter, error) {
+	filter := make(dotFilter)
+	for _, item := range strings.Split(list, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		from, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid state %q in %q", lo, list)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(hi); err != nil || to < from {
+				return nil, fmt.Errorf("invalid range %q in %q", item, list)
+			}
+		}
+		for n := from; n <= to; n++ {
+			filter[n] = true
+		}
+	}
+	return filter, nil
+}
+
+// nearFilter returns the states that are no more than radius shift or goto
+// transitions away from the center state, in either direction.
+func (lemp *lemon) nearFilter(center, radius int) (dotFilter, error) {
+	if center < 0 || center >= len(lemp.sorted) {
+		return nil, fmt.Errorf("state %d does not exist (the parser has states 0 to %d)", center, len(lemp.sorted)-1)
+	}
+	neighbors := make(map[int][]int)
+	for _, stp := range lemp.sorted {
+		for ap := stp.ap; ap != nil; ap = ap.next {
+			if ap.type_ == SHIFT || ap.type_ == SSCONFLICT {
+				neighbors[stp.statenum] = append(neighbors[stp.statenum], ap.x.stp.statenum)
+				neighbors[ap.x.stp.statenum] = append(neighbors[ap.x.stp.statenum], stp.statenum)
+			}
+		}
+	}
+	filter := dotFilter{center: true}
+	for ring, distance := []int{center}, 0; distance < radius; distance++ {
+		var next []int
+		for _, n := range ring {
+			for _, m := range neighbors[n] {
+				if !filter[m] {
+					filter[m] = true
+					next = append(next, m)
+				}
+			}
+		}
+		ring = next
+	}
+	return filter, nil
+}
+
+// ReportDot writes the automaton as a Graphviz DOT graph. Each node is a
+// state labeled with its basis configurations. Each edge is a shift (on a
+// terminal) or a goto (on a nonterminal, dashed). States with conflicts
+// are filled. When the graph is filtered, the states outside the filter
+// that are the source or target of an edge are drawn as dashed boxes.
+func ReportDot(w io.Writer, lemp *lemon, filter dotFilter) {
+	included := func(stp *state) bool {
+		return filter == nil || filter[stp.statenum]
+	}
+
+	_, _ = fmt.Fprintf(w, "// Automaton for grammar file \"%s\".\n", lemp.filename)
+	_, _ = fmt.Fprintf(w, "digraph lemon {\n")
+	_, _ = fmt.Fprintf(w, "  rankdir=LR;\n")
+	_, _ = fmt.Fprintf(w, "  node [shape=box, fontname=\"monospace\"];\n")
+
+	boundary := make(map[int]bool)
+	var edges []string
+	for _, stp := range lemp.sorted {
+		for ap := stp.ap; ap != nil; ap = ap.next {
+			if ap.type_ != SHIFT && ap.type_ != SSCONFLICT {
+				continue
+			}
+			from, to := stp, ap.x.stp
+			if !included(from) && !included(to) {
+				continue
+			} else if !included(from) {
+				boundary[from.statenum] = true
+			} else if !included(to) {
+				boundary[to.statenum] = true
+			}
+			style := ""
+			if ap.sp.index >= lemp.nterminal {
+				style = ", style=dashed"
+			}
+			edges = append(edges, fmt.Sprintf("  s%d -> s%d [label=%s%s];\n", from.statenum, to.statenum, dotQuote(ap.sp.displayName()), style))
+		}
+	}
+
+	for _, stp := range lemp.sorted {
+		if !included(stp) {
+			continue
+		}
+		label := &bytes.Buffer{}
+		_, _ = fmt.Fprintf(label, "State %d:\n", stp.statenum)
+		for cfp := stp.bp; cfp != nil; cfp = cfp.bp {
+			cfp.rp.printCursor(label, cfp.dot)
+			_, _ = fmt.Fprintf(label, "\n")
+		}
+		var conflicts []string
+		for ap := stp.ap; ap != nil; ap = ap.next {
+			switch ap.type_ {
+			case SSCONFLICT, SRCONFLICT, RRCONFLICT:
+				if len(conflicts) == 0 || conflicts[len(conflicts)-1] != ap.sp.displayName() {
+					conflicts = append(conflicts, ap.sp.displayName())
+				}
+			}
+		}
+		style := ""
+		if len(conflicts) != 0 {
+			_, _ = fmt.Fprintf(label, "conflicts on %s\n", strings.Join(conflicts, " "))
+			style = ", style=filled, fillcolor=\"#f4a6a6\""
+		}
+		_, _ = fmt.Fprintf(w, "  s%d [label=%s%s];\n", stp.statenum, dotLabel(label.String()), style)
+	}
+
+	var outside []int
+	for n := range boundary {
+		outside = append(outside, n)
+	}
+	sort.Ints(outside)
+	for _, n := range outside {
+		_, _ = fmt.Fprintf(w, "  s%d [label=\"State %d\", style=dashed];\n", n, n)
+	}
+
+	for _, edge := range edges {
+		_, _ = fmt.Fprint(w, edge)
+	}
+	_, _ = fmt.Fprintf(w, "}\n")
+}
+
+// dotQuote returns a string as a quoted DOT identifier.
+func dotQuote(s string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(s) + "\""
+}
+
+// dotLabel returns a multi-line label with each line left-justified.
+func dotLabel(s string) string {
+	quoted := dotQuote(s)
+	return strings.ReplaceAll(quoted, "\n", "\\l")
+}
@@ -0,0 +1,85 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseStateList(t *testing.T) {
+	type test_case struct {
+		id     int
+		list   string
+		expect string
+	}
+	for _, tc := range []test_case{
+		{id: 1, list: "3", expect: "[3]"},
+		{id: 2, list: "1,4-7", expect: "[1 4 5 6 7]"},
+		{id: 3, list: "2, 2-3", expect: "[2 3]"},
+		{id: 4, list: "7-4", expect: "error"},
+		{id: 5, list: "x", expect: "error"},
+	} {
+		filter, err := parseStateList(tc.list)
+		got := "error"
+		if err == nil {
+			var states []int
+			for n := range filter {
+				states = append(states, n)
+			}
+			sort.Ints(states)
+			got = fmt.Sprint(states)
+		}
+		if got != tc.expect {
+			t.Errorf("%d: want %s: got %s\n", tc.id, tc.expect, got)
+		}
+	}
+}
+
+func TestReportDot(t *testing.T) {
+	lem := parseGrammar(t, "prog ::= expr.\nexpr ::= expr PLUS expr.\nexpr ::= NUM.\n")
+	lem.warnings = newWarningFlags()
+	lem.warnings.enabled[CONFLICTS] = false
+	analyzeGrammar(lem)
+
+	w := &bytes.Buffer{}
+	ReportDot(w, lem, nil)
+	for _, want := range []string{
+		`s0 [label="State 0:\lprog ::= * expr\l"];`,
+		`s3 [label="State 3:\lexpr ::= expr * PLUS expr\lexpr ::= expr PLUS expr *\lconflicts on PLUS\l", style=filled`,
+		`s0 -> s4 [label="NUM"];`,
+		`s0 -> s1 [label="expr", style=dashed];`,
+	} {
+		if !strings.Contains(w.String(), want) {
+			t.Errorf("all: want %s\nall: got\n%s", want, w.String())
+		}
+	}
+
+	filter, err := lem.nearFilter(1, 1)
+	if err != nil {
+		t.Fatalf("near: %v\n", err)
+	}
+	w.Reset()
+	ReportDot(w, lem, filter)
+	for _, want := range []string{
+		`s1 [label="State 1:`,
+		`s2 [label="State 2:`,
+		`s0 [label="State 0:`,
+		`s3 [label="State 3", style=dashed];`,
+		`s2 -> s3 [label="expr", style=dashed];`,
+	} {
+		if !strings.Contains(w.String(), want) {
+			t.Errorf("near: want %s\nnear: got\n%s", want, w.String())
+		}
+	}
+	if strings.Contains(w.String(), `s4 [label="State 4:`) {
+		t.Errorf("near: want state 4 outside\nnear: got\n%s", w.String())
+	}
+	if _, err := lem.nearFilter(99, 1); err == nil {
+		t.Errorf("near: want error for missing state\n")
+	}
+}
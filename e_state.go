@@ -19,6 +19,7 @@ const (
 	LHS_ALIAS_3
 	RHS_ALIAS_1
 	RHS_ALIAS_2
+	RHS_ALIAS_3
 	PRECEDENCE_MARK_1
 	PRECEDENCE_MARK_2
 	RESYNC_AFTER_RULE_ERROR
@@ -30,6 +31,16 @@ const (
 	WAITING_FOR_CLASS_ID
 	WAITING_FOR_CLASS_TOKEN
 	WAITING_FOR_TOKEN_NAME
+	WAITING_FOR_TEMPLATE_NAME
+	WAITING_FOR_TEMPLATE_PARAM
+	RHS_TEMPLATE_ARGS
+	WAITING_FOR_START_SYMBOL
+	WAITING_FOR_INCLUDE_FILE
+	WAITING_FOR_TOKEN_NUMBER
+	WAITING_FOR_VOCABULARY_FILE
+	WAITING_FOR_PATTERN_TOKEN
+	WAITING_FOR_TOKEN_PATTERN
+	WAITING_FOR_SKIP_PATTERN
 )
 
 var e_state_names = [...]string{
@@ -45,6 +56,7 @@ var e_state_names = [...]string{
 	LHS_ALIAS_3:                   "LHS_ALIAS_3",
 	RHS_ALIAS_1:                   "RHS_ALIAS_1",
 	RHS_ALIAS_2:                   "RHS_ALIAS_2",
+	RHS_ALIAS_3:                   "RHS_ALIAS_3",
 	PRECEDENCE_MARK_1:             "PRECEDENCE_MARK_1",
 	PRECEDENCE_MARK_2:             "PRECEDENCE_MARK_2",
 	RESYNC_AFTER_RULE_ERROR:       "RESYNC_AFTER_RULE_ERROR",
@@ -56,6 +68,16 @@ var e_state_names = [...]string{
 	WAITING_FOR_CLASS_ID:          "WAITING_FOR_CLASS_ID",
 	WAITING_FOR_CLASS_TOKEN:       "WAITING_FOR_CLASS_TOKEN",
 	WAITING_FOR_TOKEN_NAME:        "WAITING_FOR_TOKEN_NAME",
+	WAITING_FOR_TEMPLATE_NAME:     "WAITING_FOR_TEMPLATE_NAME",
+	WAITING_FOR_TEMPLATE_PARAM:    "WAITING_FOR_TEMPLATE_PARAM",
+	RHS_TEMPLATE_ARGS:             "RHS_TEMPLATE_ARGS",
+	WAITING_FOR_START_SYMBOL:      "WAITING_FOR_START_SYMBOL",
+	WAITING_FOR_INCLUDE_FILE:      "WAITING_FOR_INCLUDE_FILE",
+	WAITING_FOR_TOKEN_NUMBER:      "WAITING_FOR_TOKEN_NUMBER",
+	WAITING_FOR_VOCABULARY_FILE:   "WAITING_FOR_VOCABULARY_FILE",
+	WAITING_FOR_PATTERN_TOKEN:     "WAITING_FOR_PATTERN_TOKEN",
+	WAITING_FOR_TOKEN_PATTERN:     "WAITING_FOR_TOKEN_PATTERN",
+	WAITING_FOR_SKIP_PATTERN:      "WAITING_FOR_SKIP_PATTERN",
 }
 
 func (e e_state) String() string {
@@ -0,0 +1,42 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+// The categories of warnings. Each can be enabled, disabled, or turned
+// into an error from the command line.
+type e_warning int
+
+const (
+	CONFLICTS             e_warning = iota // Conflicts that couldn't be resolved
+	UNUSED_SYMBOL                          // Symbols that aren't used by any rule
+	UNUSED_ALIAS                           // Aliases that aren't used in the rule's code
+	USELESS_PRECEDENCE                     // Precedence that never resolves a conflict
+	NEVER_REDUCED_RULE                     // Rules that can't be reduced
+	PREPROCESSOR                           // Problems with macros
+	MISSPELLED_SYMBOL                      // Symbols used once that look like another symbol
+	UNREACHABLE_SYMBOL                     // Nonterminals that can't be reached from the start symbol
+	TERMINAL_TYPE                          // Token classes whose terminals have different %types
+	NON_PRODUCTIVE_SYMBOL                  // Nonterminals that can't derive a string of terminals
+	LEXER                                  // Tokens without a pattern and patterns that never match
+	COUNTEREXAMPLES                        // Not a warning; adds examples to the conflicts
+)
+
+var e_warning_names = [...]string{
+	CONFLICTS:             "conflicts",
+	UNUSED_SYMBOL:         "unused-symbol",
+	UNUSED_ALIAS:          "unused-alias",
+	USELESS_PRECEDENCE:    "useless-precedence",
+	NEVER_REDUCED_RULE:    "never-reduced-rule",
+	PREPROCESSOR:          "preprocessor",
+	MISSPELLED_SYMBOL:     "misspelled-symbol",
+	UNREACHABLE_SYMBOL:    "unreachable-symbol",
+	TERMINAL_TYPE:         "terminal-type",
+	NON_PRODUCTIVE_SYMBOL: "non-productive-symbol",
+	LEXER:                 "lexer",
+	COUNTEREXAMPLES:       "counterexamples",
+}
+
+func (e e_warning) String() string {
+	return e_warning_names[e]
+}
@@ -0,0 +1,347 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The right-hand side of a rule may use EBNF shorthand:
+//
+//	[ a b ]    an optional sequence
+//	x?         an optional symbol or group
+//	x*         zero or more
+//	x+         one or more
+//	( a | b )  a group of alternatives
+//
+// The parser replaces each one with a helper nonterminal that has ordinary
+// rules. A helper is named after what it stands for, like "opt_x" or
+// "star_a_or_b", and the same shorthand used twice shares the same helper.
+// Repetitions are left recursive so that they don't grow the stack.
+// Inside a group, a bar written against a terminal, like A|B, still makes
+// a multi-terminal; a bar with spaces around it separates alternatives.
+// In the same way, a name in parentheses written against a symbol, like
+// item(I), is an alias, while one with a space before it, like A (B)*, is a
+// group when a "?", "*" or "+" follows it.
+
+// rhsGroup is a parenthesized or bracketed group on the RHS of a rule.
+type rhsGroup struct {
+	optional bool        // true for "[...]"
+	lineno   int         // where the group starts
+	alts     [][]*symbol // the alternatives that are complete
+	rhs      []*symbol   // the RHS of the enclosing rule or group
+	alias    []string    // the aliases of the enclosing rule
+}
+
+// openGroup starts a group. The symbols of the enclosing RHS are saved
+// until the group is closed. It returns false if groups aren't allowed.
+func (psp *pstate) openGroup(optional bool) bool {
+	if psp.tmpl != nil {
+		ErrorMsg(psp.filename, psp.tokenlineno, "EBNF shorthand can't be used in the rules of template %q.", psp.tmpl.name)
+		psp.errorcnt++
+		return false
+	}
+	psp.groups = append(psp.groups, &rhsGroup{optional: optional, lineno: psp.tokenlineno, rhs: psp.rhs, alias: psp.alias})
+	psp.rhs, psp.alias, psp.nrhs = nil, nil, 0
+	return true
+}
+
+// alternative ends an alternative of the innermost group.
+func (psp *pstate) alternative() {
+	g := psp.groups[len(psp.groups)-1]
+	g.alts = append(g.alts, psp.rhs)
+	psp.rhs, psp.alias, psp.nrhs = nil, nil, 0
+}
+
+// closeGroup ends the innermost group. The group is held until the next
+// token shows whether it is followed by a "?", "*" or "+".
+func (psp *pstate) closeGroup() {
+	g := psp.groups[len(psp.groups)-1]
+	psp.groups = psp.groups[:len(psp.groups)-1]
+	g.alts = append(g.alts, psp.rhs)
+	psp.rhs, psp.alias, psp.nrhs = g.rhs, g.alias, len(g.rhs)
+	psp.pending = g
+}
+
+// flushPending adds the group that was just closed to the RHS.
+// A group with a single alternative is copied in place.
+func (psp *pstate) flushPending() {
+	g := psp.pending
+	if g == nil {
+		return
+	}
+	psp.pending = nil
+	if g.optional {
+		psp.appendRHS(psp.helperFor("opt", g.alts, "["+altsText(g.alts)+"]"), "")
+	} else if len(g.alts) == 1 {
+		for _, sp := range g.alts[0] {
+			psp.appendRHS(sp, "")
+		}
+	} else {
+		psp.appendRHS(psp.helperFor("group", g.alts, groupText(g.alts)), "")
+	}
+}
+
+// checkAlias drops the alias that was just read for the last symbol on the
+// RHS if the symbol is inside a group.
+func (psp *pstate) checkAlias() {
+	if len(psp.groups) != 0 {
+		ErrorMsg(psp.filename, psp.tokenlineno, "the alias %q is inside a group; aliases are only allowed outside of groups.", psp.alias[psp.nrhs-1])
+		psp.errorcnt++
+		psp.alias[psp.nrhs-1] = ""
+	}
+}
+
+// quantify applies a "?", "*" or "+" to the group that was just closed or
+// to the last symbol on the RHS. The alias of the symbol is kept for an
+// optional helper. A repetition has no value, so an alias on it is an error.
+func (psp *pstate) quantify(op string) {
+	if psp.tmpl != nil {
+		ErrorMsg(psp.filename, psp.tokenlineno, "EBNF shorthand can't be used in the rules of template %q.", psp.tmpl.name)
+		psp.errorcnt++
+		return
+	}
+	var alts [][]*symbol
+	alias := ""
+	if g := psp.pending; g != nil && !g.optional {
+		psp.pending = nil
+		alts = g.alts
+	} else {
+		psp.flushPending()
+		if psp.nrhs == 0 {
+			ErrorMsg(psp.filename, psp.tokenlineno, "%q must follow a symbol or a group.", op)
+			psp.errorcnt++
+			return
+		}
+		last := psp.nrhs - 1
+		alts, alias = [][]*symbol{{psp.rhs[last]}}, psp.alias[last]
+		psp.rhs, psp.alias, psp.nrhs = psp.rhs[:last], psp.alias[:last], last
+		if alias != "" && op != "?" {
+			ErrorMsg(psp.filename, psp.tokenlineno, "the alias %q can't be used on %q because a repetition has no value.", alias, symbolText(alts[0][0])+op)
+			psp.errorcnt++
+			alias = ""
+		}
+	}
+	kind := map[string]string{"?": "opt", "*": "star", "+": "plus"}[op]
+	psp.appendRHS(psp.helperFor(kind, alts, groupText(alts)+op), alias)
+}
+
+// appendRHS adds a symbol to the RHS of the current rule or group.
+func (psp *pstate) appendRHS(sp *symbol, alias string) {
+	psp.rhs = append(psp.rhs, sp)
+	psp.alias = append(psp.alias, alias)
+	psp.nrhs = len(psp.rhs)
+}
+
+// helperFor returns the helper nonterminal for the shorthand, creating it
+// and its rules the first time the shorthand is used. The kind is "opt",
+// "star", "plus" or "group".
+func (psp *pstate) helperFor(kind string, alts [][]*symbol, text string) *symbol {
+	base := kind + "_" + altsKey(alts)
+	name := base
+	for n := 2; Symbol_find(name) != nil; n++ {
+		if sp := Symbol_find(name); sp.helper == text {
+			return psp.symbolNew(name)
+		}
+		name = fmt.Sprintf("%s_%d", base, n)
+	}
+	sp := psp.symbolNew(name)
+	sp.helper = text
+	switch kind {
+	case "opt":
+		for _, alt := range alts {
+			psp.helperRule(sp, alt)
+		}
+		psp.helperRule(sp, nil)
+	case "star":
+		psp.helperRule(sp, nil)
+		for _, alt := range alts {
+			psp.helperRule(sp, append([]*symbol{sp}, alt...))
+		}
+	case "plus":
+		for _, alt := range alts {
+			psp.helperRule(sp, alt)
+		}
+		for _, alt := range alts {
+			psp.helperRule(sp, append([]*symbol{sp}, alt...))
+		}
+	case "group":
+		for _, alt := range alts {
+			psp.helperRule(sp, alt)
+		}
+	}
+	if kind == "opt" || kind == "group" {
+		psp.helpers = append(psp.helpers, sp)
+	}
+	return sp
+}
+
+// helperRule creates a rule for a helper. The rule is added to the grammar
+// after the rule that uses the helper so that the start rule stays first.
+func (psp *pstate) helperRule(lhs *symbol, rhs []*symbol) *rule {
+	rp := &rule{
+		lhs:      lhs,
+		ruleline: psp.tokenlineno,
+		rhs:      append([]*symbol{}, rhs...),
+		rhsalias: make([]string, len(rhs)),
+		nrhs:     len(rhs),
+		noCode:   true,
+	}
+	rp.nextlhs = lhs.rule
+	lhs.rule = rp
+	psp.helperRules = append(psp.helperRules, rp)
+	return rp
+}
+
+// midRuleAction replaces a block of code on the RHS of a rule with a
+// helper nonterminal that has an empty rule with the code. The code runs
+// when the parser reaches that point in the rule, before the rest of the
+// RHS is parsed. The symbols to the left of the action are its context;
+// their aliases may be used in the code.
+func (psp *pstate) midRuleAction(code string) {
+	name := ""
+	for n := psp.nmid + 1; name == "" || Symbol_find(name) != nil; n++ {
+		name, psp.nmid = fmt.Sprintf("mid_%d", n), n
+	}
+	sp := psp.symbolNew(name)
+	sp.helper = "the action on " + sourceLine(psp.filename, psp.tokenlineno)
+	rp := psp.helperRule(sp, nil)
+	rp.code, rp.line, rp.noCode = code[1:], psp.tokenlineno, false
+	rp.context = append([]*symbol{}, psp.rhs...)
+	rp.contextAlias = append([]string{}, psp.alias...)
+	psp.appendRHS(sp, "")
+}
+
+// addRule adds a rule to the end of the grammar.
+func (psp *pstate) addRule(rp *rule) {
+	rp.index = psp.gp.nrule
+	psp.gp.nrule++
+	rp.next = nil
+	if psp.firstrule == nil {
+		psp.firstrule = rp
+		psp.lastrule = rp
+	} else {
+		psp.lastrule.next = rp
+		psp.lastrule = rp
+	}
+}
+
+// addHelperRules adds the rules of the helpers created since the last call.
+func (psp *pstate) addHelperRules() {
+	for _, rp := range psp.helperRules {
+		psp.addRule(rp)
+	}
+	psp.helperRules = nil
+}
+
+// typeHelpers gives a value to the optional and group helpers when every
+// alternative is a single symbol and all of the symbols have the same type.
+// The helper takes that type and each rule passes the value of its symbol
+// up. The empty rule of an optional helper leaves the value unset. This
+// runs after the whole grammar is read because %type and %token_type may
+// come after the rules.
+func (psp *pstate) typeHelpers() {
+	for _, sp := range psp.helpers {
+		datatype, ok := "", true
+		for rp := sp.rule; rp != nil && ok; rp = rp.nextlhs {
+			if rp.nrhs == 0 {
+				continue
+			} else if rp.nrhs != 1 {
+				ok = false
+			} else if t := psp.valueType(rp.rhs[0]); datatype != "" && t != datatype {
+				ok = false
+			} else {
+				datatype = t
+			}
+		}
+		if !ok || datatype == "" || (sp.datatype != "" && sp.datatype != datatype) {
+			continue
+		}
+		if datatype != psp.gp.vartype {
+			sp.datatype = datatype
+		}
+		for rp := sp.rule; rp != nil; rp = rp.nextlhs {
+			if rp.nrhs == 1 && len(rp.code) == 0 {
+				rp.lhsalias, rp.rhsalias[0] = "A", "B"
+				rp.rhs[0].bContent = true
+				rp.code, rp.line, rp.noCode = " A = B; }", rp.ruleline, false
+			}
+		}
+	}
+}
+
+// valueType returns the type of the value carried by a symbol. A terminal
+// with a %type of its own carries that type instead of the %token_type.
+func (psp *pstate) valueType(sp *symbol) string {
+	if sp.type_ == MULTITERMINAL {
+		return psp.valueType(sp.subsym[0])
+	} else if sp.datatype != "" {
+		return sp.datatype
+	} else if sp.type_ == TERMINAL || sp.name == "$" {
+		return psp.gp.tokentype
+	}
+	return psp.gp.vartype
+}
+
+// altsKey returns the part of a helper name for the alternatives.
+func altsKey(alts [][]*symbol) string {
+	var keys []string
+	for _, alt := range alts {
+		var items []string
+		for _, sp := range alt {
+			if sp.type_ == MULTITERMINAL {
+				var subs []string
+				for _, subsym := range sp.subsym {
+					subs = append(subs, subsym.name)
+				}
+				items = append(items, strings.Join(subs, "_or_"))
+			} else {
+				items = append(items, sp.name)
+			}
+		}
+		if len(items) != 0 {
+			keys = append(keys, strings.Join(items, "_"))
+		}
+	}
+	return strings.Join(keys, "_or_")
+}
+
+// altsText returns the alternatives as they are written in the grammar.
+func altsText(alts [][]*symbol) string {
+	var texts []string
+	for _, alt := range alts {
+		var items []string
+		for _, sp := range alt {
+			items = append(items, symbolText(sp))
+		}
+		texts = append(texts, strings.Join(items, " "))
+	}
+	return strings.Join(texts, " | ")
+}
+
+// groupText returns the alternatives as an operand of "?", "*" or "+".
+func groupText(alts [][]*symbol) string {
+	if len(alts) == 1 && len(alts[0]) == 1 {
+		return symbolText(alts[0][0])
+	}
+	return "(" + altsText(alts) + ")"
+}
+
+// symbolText returns a symbol as it is written in the grammar.
+func symbolText(sp *symbol) string {
+	if sp.helper != "" {
+		return sp.helper
+	} else if sp.instance != "" {
+		return sp.instance
+	} else if sp.type_ == MULTITERMINAL && Symbol_find(sp.name) != sp {
+		// an anonymous multi-terminal from the rule, not a %token_class
+		var subs []string
+		for _, subsym := range sp.subsym {
+			subs = append(subs, subsym.name)
+		}
+		return strings.Join(subs, "|")
+	}
+	return sp.name
+}
@@ -0,0 +1,184 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEBNF(t *testing.T) {
+	type test_case struct {
+		id      int
+		grammar string
+		expect  []string // the rules in the order they are numbered, which puts rules with code first
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			grammar: "prog ::= A B?.\n",
+			expect:  []string{"prog ::= A opt_B.", "opt_B ::= B.", "opt_B ::=."},
+		},
+		{id: 2,
+			grammar: "list ::= LP [item (COMMA item)*] RP.\nitem ::= NUM.\n",
+			expect: []string{
+				"list ::= LP opt_item_star_COMMA_item RP.",
+				"star_COMMA_item ::=.",
+				"star_COMMA_item ::= star_COMMA_item COMMA item.",
+				"opt_item_star_COMMA_item ::= item star_COMMA_item.",
+				"opt_item_star_COMMA_item ::=.",
+				"item ::= NUM.",
+			},
+		},
+		{id: 3,
+			grammar: "prog ::= stmt+.\nprog ::= X stmt+.\nstmt ::= A (B | C D) E.\n",
+			expect: []string{
+				"prog ::= plus_stmt.",
+				"plus_stmt ::= stmt.",
+				"plus_stmt ::= plus_stmt stmt.",
+				"prog ::= X plus_stmt.",
+				"stmt ::= A group_B_or_C_D E.",
+				"group_B_or_C_D ::= B.",
+				"group_B_or_C_D ::= C D.",
+			},
+		},
+		{id: 4,
+			grammar: "prog ::= (A B) C.\nprog(X) ::= D(Y) (E F).\n",
+			expect:  []string{"prog ::= A B C.", "prog ::= D E F."},
+		},
+		{id: 5,
+			grammar: "%token_type {int}\n%type prog {int}\nprog(X) ::= (PLUS | MINUS)(Y) NUM. { X = Y; }\n",
+			expect: []string{
+				"prog ::= group_PLUS_or_MINUS NUM. { X = Y; }",
+				"group_PLUS_or_MINUS ::= PLUS. { A = B; }",
+				"group_PLUS_or_MINUS ::= MINUS. { A = B; }",
+			},
+		},
+		{id: 6,
+			grammar: "%type num {int}\nprog ::= num? num*.\nnum ::= NUM.\n",
+			expect: []string{
+				"opt_num ::= num. { A = B; }",
+				"prog ::= opt_num star_num.",
+				"opt_num ::=.",
+				"star_num ::=.",
+				"star_num ::= star_num num.",
+				"num ::= NUM.",
+			},
+		},
+		{id: 7,
+			grammar: "opt_A ::= B.\nprog ::= A? opt_A.\n",
+			expect:  []string{"opt_A ::= B.", "prog ::= opt_A_2 opt_A.", "opt_A_2 ::= A.", "opt_A_2 ::=."},
+		},
+		{id: 8,
+			grammar: "block ::= LB(L) { open(L); } stmt* RB. { close(); }\nstmt ::= X.\n",
+			expect: []string{
+				"block ::= LB mid_1 star_stmt RB. { close(); }",
+				"mid_1 ::=. { open(L); }",
+				"star_stmt ::=.",
+				"star_stmt ::= star_stmt stmt.",
+				"stmt ::= X.",
+			},
+		},
+		{id: 9,
+			grammar: "prog ::= A (B)*.\nprog ::= C (D)+ E(X).\n",
+			expect: []string{
+				"prog ::= A star_B.",
+				"star_B ::=.",
+				"star_B ::= star_B B.",
+				"prog ::= C plus_D E.",
+				"plus_D ::= D.",
+				"plus_D ::= plus_D D.",
+			},
+		},
+	} {
+		lem := parseGrammar(t, tc.grammar)
+		var got []string
+		for rp := lem.rule; rp != nil; rp = rp.next {
+			w := &bytes.Buffer{}
+			rp.printCursor(w, -1)
+			text := w.String() + "."
+			if rp.code != "" {
+				text += " {" + rp.code
+			}
+			got = append(got, text)
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.expect, "\n") {
+			t.Errorf("%d: want\n%s\n%d: got\n%s\n", tc.id, strings.Join(tc.expect, "\n"), tc.id, strings.Join(got, "\n"))
+		}
+		if tc.id == 9 {
+			if rp := Symbol_find("prog").rule; rp.rhsalias[2] != "X" || rp.nextlhs.rhsalias[0] != "" {
+				t.Errorf("%d: want only E to have an alias\n", tc.id)
+			}
+		}
+		if tc.id == 8 {
+			if sp := Symbol_find("mid_1"); sp == nil || len(sp.rule.context) != 1 || sp.rule.context[0].name != "LB" || sp.rule.contextAlias[0] != "L" {
+				t.Errorf("%d: want the action to have LB(L) as its context\n", tc.id)
+			}
+		}
+	}
+}
+
+func TestEBNFErrors(t *testing.T) {
+	type test_case struct {
+		id      int
+		grammar string
+		expect  []string
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			grammar: "prog ::= * A.\n",
+			expect:  []string{`1: "*" must follow a symbol or a group.`},
+		},
+		{id: 2,
+			grammar: "prog ::= A (B | C.\n",
+			expect:  []string{`1: missing ")" to close the group that starts on line 1.`},
+		},
+		{id: 3,
+			grammar: "prog ::= A ].\n",
+			expect:  []string{`1: "]" does not close a group.`},
+		},
+		{id: 4,
+			grammar: "prog ::= [A(X)].\n",
+			expect:  []string{`1: the alias "X" is inside a group; aliases are only allowed outside of groups.`},
+		},
+		{id: 5,
+			grammar: "prog ::= A?.\nopt_A ::= B.\n",
+			expect:  []string{`2: "opt_A" is the name of the helper for "A?"; the nonterminal needs another name.`},
+		},
+		{id: 6,
+			grammar: "prog ::= A (B { f(); } | C).\n",
+			expect:  []string{`1: a mid-rule action can't be inside a group.`},
+		},
+		{id: 7,
+			grammar: "items ::= item(I)*.\nitems ::= (A | B)(Y)+ item(J)?.\nitem ::= X.\n",
+			expect: []string{
+				`1: the alias "I" can't be used on "item*" because a repetition has no value.`,
+				`2: the alias "Y" can't be used on "(A | B)+" because a repetition has no value.`,
+			},
+		},
+	} {
+		filename := filepath.Join(t.TempDir(), "test.y")
+		if err := os.WriteFile(filename, []byte(tc.grammar), 0644); err != nil {
+			t.Fatal(err)
+		}
+		Symbol_init()
+		Symbol_new("$")
+		lem := &lemon{filename: filename}
+		var got []string
+		msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+			got = append(got, fmt.Sprintf("%d: %s", lineno, msg))
+		}
+		Parse(lem, map[string]string{})
+		msgHook = nil
+		if strings.Join(got, "\n") != strings.Join(tc.expect, "\n") {
+			t.Errorf("%d: want\n%s\n%d: got\n%s\n", tc.id, strings.Join(tc.expect, "\n"), tc.id, strings.Join(got, "\n"))
+		}
+		if lem.errorcnt != len(tc.expect) {
+			t.Errorf("%d: errors: want %d: got %d\n", tc.id, len(tc.expect), lem.errorcnt)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A grammar may have more than one start symbol. As in lemon, %start_symbol
+// takes a single name, so each start symbol is declared with its own
+// %start_symbol:
+//
+//	%start_symbol statement
+//	%start_symbol expr
+//
+// Each start symbol is an entry point of the parser. It has its own start
+// state, where the parser accepts the input when it reduces to the start
+// symbol, but all of the entry points share the states and tables. The
+// first entry point is the one used when the parser is run without naming
+// one. Without a %start_symbol, the left-hand side of the first rule is the
+// only entry point.
+//
+// This program doesn't generate a parser, so there is no entry function for
+// each start symbol. The entry points and their start states are given in
+// the reports, like the -json output, for a code generator to use.
+//
+// A start symbol can't be on the right-hand side of a rule because the
+// parser would accept the input as soon as it reduced to it. When there is
+// more than one start symbol, a start symbol that is used in a rule is given
+// a helper, named like "entry_expr", whose only rule is "entry_expr ::= expr."
+// and the parser accepts the helper instead.
+
+// entryPoint is a start symbol of the grammar and the state that the parser
+// starts in for it.
+type entryPoint struct {
+	sp   *symbol // the start symbol
+	goal *symbol // the symbol that is accepted, sp or its helper
+	stp  *state  // the start state; nil until FindStates is called
+}
+
+// declareStartSymbol adds a start symbol from %start_symbol.
+func (psp *pstate) declareStartSymbol(name string) {
+	for _, start := range psp.gp.starts {
+		if start == name {
+			ErrorMsg(psp.filename, psp.tokenlineno, "%q is already a start symbol.", name)
+			psp.errorcnt++
+			return
+		}
+	}
+	psp.gp.starts = append(psp.gp.starts, name)
+}
+
+// addEntryRules adds the helpers for the start symbols that are used on the
+// right-hand side of a rule. It is only needed when there is more than one
+// start symbol; with a single start symbol, FindStates reports the error.
+func (psp *pstate) addEntryRules() {
+	if len(psp.gp.starts) < 2 {
+		return
+	}
+	for _, start := range psp.gp.starts {
+		sp := Symbol_find(start)
+		if sp == nil || sp.type_ != NONTERMINAL || !psp.usedOnRHS(sp) {
+			continue
+		}
+		name := "entry_" + start
+		for n := 2; Symbol_find(name) != nil; n++ {
+			name = fmt.Sprintf("entry_%s_%d", start, n)
+		}
+		goal := psp.symbolNew(name)
+		goal.helper = "%start_symbol " + start
+		goal.entry = sp
+		psp.helperRule(goal, []*symbol{sp})
+	}
+	psp.addHelperRules()
+}
+
+// usedOnRHS returns true if the symbol is on the right-hand side of a rule.
+func (psp *pstate) usedOnRHS(sp *symbol) bool {
+	for rp := psp.firstrule; rp != nil; rp = rp.next {
+		for _, rhs := range rp.rhs {
+			if rhs == sp {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// startSymbols returns the symbols named by %start_symbol, or the left-hand
+// side of the first rule if there are none. A name that isn't a nonterminal
+// of the grammar is an error that FindStates reports; the left-hand side of
+// the first rule stands in for it so that the analysis can go on.
+func (lemp *lemon) startSymbols() []*symbol {
+	var starts []*symbol
+	for _, name := range lemp.starts {
+		sp := Symbol_find(name)
+		if sp == nil || sp.rule == nil {
+			sp = lemp.startRule.lhs
+		}
+		if !symbolIn(sp, starts) {
+			starts = append(starts, sp)
+		}
+	}
+	if len(starts) == 0 {
+		starts = append(starts, lemp.startRule.lhs)
+	}
+	return starts
+}
+
+// startSymbol returns the first start symbol, which is the one used when
+// the parser isn't given an entry point.
+func (lemp *lemon) startSymbol() *symbol {
+	return lemp.startSymbols()[0]
+}
+
+// findEntryPoints returns an entry point for each start symbol. The start
+// states are added by FindStates.
+func (lemp *lemon) findEntryPoints() []*entryPoint {
+	goals := make(map[*symbol]*symbol)
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		if rp.lhs.entry != nil {
+			goals[rp.lhs.entry] = rp.lhs
+		}
+	}
+	var entries []*entryPoint
+	for _, sp := range lemp.startSymbols() {
+		ep := &entryPoint{sp: sp, goal: sp}
+		if goal, ok := goals[sp]; ok {
+			ep.goal = goal
+		}
+		entries = append(entries, ep)
+	}
+	return entries
+}
+
+// isStartState returns true if the state is the start state of an entry point.
+func (lemp *lemon) isStartState(stp *state) bool {
+	for _, ep := range lemp.entries {
+		if ep.stp == stp {
+			return true
+		}
+	}
+	return false
+}
+
+// startStates returns the start states of the entry points.
+func (lemp *lemon) startStates() []*state {
+	var states []*state
+	for _, ep := range lemp.entries {
+		states = append(states, ep.stp)
+	}
+	return states
+}
+
+// startSymbolNames returns the names of the start symbols for messages.
+func (lemp *lemon) startSymbolNames() string {
+	var names []string
+	for _, sp := range lemp.startSymbols() {
+		names = append(names, fmt.Sprintf("%q", sp.name))
+	}
+	return strings.Join(names, ", ")
+}
+
+// symbolIn returns true if the symbol is in the list.
+func symbolIn(sp *symbol, list []*symbol) bool {
+	for _, s := range list {
+		if s == sp {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEntryPoints(t *testing.T) {
+	grammar := "%start_symbol stmt\n%start_symbol expr\n%start_symbol type\n" +
+		"stmt ::= LET ID COLON type EQ expr SEMI.\n" +
+		"expr ::= expr PLUS term.\nexpr ::= term.\nterm ::= NUM.\nterm ::= ID.\n" +
+		"type ::= ID.\n"
+	type test_case struct {
+		id     int
+		entry  int
+		input  string
+		accept bool
+	}
+	lem := parseGrammar(t, grammar)
+	analyzeGrammar(lem)
+	if lem.errorcnt != 0 || lem.nconflict != 0 {
+		t.Fatalf("entry: want no errors or conflicts: got %d, %d\n", lem.errorcnt, lem.nconflict)
+	}
+	var got []string
+	for _, ep := range lem.entries {
+		got = append(got, fmt.Sprintf("%s %s", ep.sp.name, ep.goal.name))
+	}
+	if expect := "stmt stmt\nexpr entry_expr\ntype entry_type"; strings.Join(got, "\n") != expect {
+		t.Errorf("entry: want\n%s\nentry: got\n%s\n", expect, strings.Join(got, "\n"))
+	}
+	if lem.entries[0].stp != lem.sorted[0] {
+		t.Errorf("entry: want the first start state to be state 0: got %d\n", lem.entries[0].stp.statenum)
+	}
+	for _, tc := range []test_case{
+		{id: 1, entry: 0, input: "LET ID COLON ID EQ NUM PLUS ID SEMI", accept: true},
+		{id: 2, entry: 1, input: "NUM PLUS ID PLUS NUM", accept: true},
+		{id: 3, entry: 2, input: "ID", accept: true},
+		{id: 4, entry: 1, input: "LET ID COLON ID EQ NUM SEMI"},
+		{id: 5, entry: 2, input: "ID PLUS ID"},
+		{id: 6, entry: 0, input: "NUM"},
+	} {
+		stk := ceStack{states: []*state{lem.entries[tc.entry].stp}}
+		result := ceShifted
+		for _, name := range append(strings.Fields(tc.input), "$") {
+			actions := ceActions(stk.top(), Symbol_find(name))
+			if len(actions) != 1 {
+				result = ceError
+				break
+			}
+			if stk, result = lem.run(stk, Symbol_find(name), actions[0], false, false, 0); result != ceShifted {
+				break
+			}
+		}
+		if accept := result == ceAccepted; accept != tc.accept {
+			t.Errorf("%d: %s: want accept %v: got %v\n", tc.id, tc.input, tc.accept, accept)
+		}
+	}
+
+	w := &bytes.Buffer{}
+	Reprint(w, lem, false)
+	if !strings.Contains(w.String(), "%start_symbol stmt\n%start_symbol expr\n%start_symbol type\n") {
+		t.Errorf("reprint: want each start symbol: got\n%s\n", w.String())
+	}
+}
+
+func TestEntryPointErrors(t *testing.T) {
+	type test_case struct {
+		id      int
+		grammar string
+		expect  []string
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			grammar: "%start_symbol a\n%start_symbol a\na ::= A.\n",
+			expect:  []string{`2: error: "a" is already a start symbol.`},
+		},
+		{id: 2,
+			grammar: "%start_symbol {a}\na ::= A.\n",
+			expect:  []string{`1: error: illegal argument to %start_symbol: "{a}".`},
+		},
+		{id: 3,
+			grammar: "%start_symbol a\n%start_symbol b\na ::= A.\nb ::= B.\nc ::= C.\n",
+			expect: []string{
+				`5: warning: Nonterminal "c" can't be reached from any of the start symbols "a", "b". [-Wunreachable-symbol]`,
+				`5: warning: This rule can not be reduced. [-Wnever-reduced-rule]`,
+			},
+		},
+		{id: 4,
+			grammar: "%start_symbol a\n%start_symbol nope\na ::= A.\n",
+			expect:  []string{`0: error: The specified start symbol "nope" is not a nonterminal of the grammar.`},
+		},
+	} {
+		filename := filepath.Join(t.TempDir(), "test.y")
+		if err := os.WriteFile(filename, []byte(tc.grammar), 0644); err != nil {
+			t.Fatal(err)
+		}
+		Symbol_init()
+		State_init()
+		Symbol_new("$")
+		lem := &lemon{filename: filename, warnings: newWarningFlags()}
+		var got []string
+		msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+			kind := "error"
+			if isWarning {
+				kind = "warning"
+			}
+			got = append(got, fmt.Sprintf("%d: %s: %s", lineno, kind, msg))
+		}
+		Parse(lem, map[string]string{})
+		if lem.errorcnt == 0 {
+			if err := numberGrammar(lem); err != nil {
+				t.Fatal(err)
+			}
+			analyzeGrammar(lem)
+		}
+		msgHook = nil
+		if strings.Join(got, "\n") != strings.Join(tc.expect, "\n") {
+			t.Errorf("%d: want\n%s\n%d: got\n%s\n", tc.id, strings.Join(tc.expect, "\n"), tc.id, strings.Join(got, "\n"))
+		}
+	}
+}
@@ -8,6 +8,19 @@ import (
 	"os"
 )
 
+// msgHook, when set, receives every error and warning message instead of
+// standard error. The language server uses it to collect diagnostics.
+// Messages that aren't tied to a line have a lineno of zero.
+var msgHook func(filename string, lineno int, isWarning bool, msg string)
+
 func ErrorMsg(filename string, lineno int, format string, args ...any) {
-	_, _ = fmt.Fprintf(os.Stderr, "%s:%d: %s\n", filename, lineno, fmt.Sprintf(format, args...))
+	msg := fmt.Sprintf(format, args...)
+	filename, lineno = sourcePosition(filename, lineno)
+	if msgHook != nil {
+		msgHook(filename, lineno, false, msg)
+	} else if lineno > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "%s:%d: %s\n", filename, lineno, msg)
+	} else {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: %s\n", filename, msg)
+	}
 }
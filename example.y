@@ -0,0 +1,43 @@
+// example.y - a small calculator grammar used by the tests.
+
+%include {
+#include <stdio.h>
+#include <stdlib.h>
+}
+
+%name Calc
+%token_type {int}
+%token_prefix TK_
+
+%left     PLUS MINUS.
+%left     TIMES DIVIDE.
+%right    EXP.
+%nonassoc UMINUS.
+
+%type program {int}
+%type expr    {int}
+
+%syntax_error {
+	fprintf(stderr, "syntax error\n");
+}
+
+program ::= expr(A). { printf("%d\n", A); }
+
+expr(A) ::= expr(B) PLUS expr(C).   { A = B + C; }
+expr(A) ::= expr(B) MINUS expr(C).  { A = B - C; }
+expr(A) ::= expr(B) TIMES expr(C).  { A = B * C; }
+expr(A) ::= expr(B) DIVIDE expr(C). {
+	if (C != 0) {
+		A = B / C;
+	} else {
+		fprintf(stderr, "divide by zero\n");
+	}
+}
+expr(A) ::= expr(B) EXP expr(C).    { A = B; (void)C; }
+expr(A) ::= MINUS expr(B). [UMINUS] { A = -B; }
+expr(A) ::= LPAREN expr(B) RPAREN.  { A = B; }
+%ifdef a
+expr(A) ::= INTEGER(B). { A = B; }
+%else
+expr(A) ::= NUMBER(B). { A = B; }
+%endif
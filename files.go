@@ -0,0 +1,26 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// file_makename returns the name of an output file. It is the name of the
+// grammar file, without its directory or suffix, in the output directory
+// and with the given suffix.
+func file_makename(lemp *lemon, suffix string) string {
+	name := filepath.Base(lemp.filename)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return filepath.Join(outputDir, name+suffix)
+}
+
+// file_open creates an output file with the given suffix.
+// The name of the file is saved in lemp.outname.
+func file_open(lemp *lemon, suffix string) (*os.File, error) {
+	lemp.outname = file_makename(lemp, suffix)
+	return os.Create(lemp.outname)
+}
@@ -0,0 +1,453 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+// this file contains the grammar formatter.
+// it re-emits a grammar file from its syntax tree, aligning the "::=" of
+// neighboring rules, normalizing precedence blocks and re-indenting code.
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// formatWidth is the column at which declaration lists are wrapped.
+const formatWidth = 80
+
+// formatIndent is the indentation used for each level of code blocks.
+const formatIndent = "\t"
+
+// fmtCommand implements "lemon fmt".
+// It returns the exit code for the program.
+func fmtCommand(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := fs.Bool("check", false, "Don't print the formatted grammar; exit non-zero if any file is not formatted.")
+	write := fs.Bool("w", false, "Write the formatted grammar back to the source file.")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "usage: lemon fmt [-check] [-w] [grammar files]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		output, err := Format("<stdin>", input)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		} else if *check {
+			if !bytes.Equal(input, output) {
+				_, _ = fmt.Printf("<stdin>\n")
+				return 1
+			}
+			return 0
+		}
+		_, _ = os.Stdout.Write(output)
+		return 0
+	}
+
+	exitCode := 0
+	for _, filename := range fs.Args() {
+		input, err := os.ReadFile(filename)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "%s: can't open this file for reading.\n", filename)
+			exitCode = 1
+			continue
+		}
+		output, err := Format(filename, input)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+			exitCode = 1
+			continue
+		}
+		if *check {
+			if !bytes.Equal(input, output) {
+				_, _ = fmt.Printf("%s\n", filename)
+				exitCode = 1
+			}
+		} else if *write {
+			if !bytes.Equal(input, output) {
+				if err := os.WriteFile(filename, output, 0644); err != nil {
+					_, _ = fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+					exitCode = 1
+				}
+			}
+		} else {
+			_, _ = os.Stdout.Write(output)
+		}
+	}
+	return exitCode
+}
+
+// Format returns the formatted text of a grammar file.
+func Format(filename string, input []byte) ([]byte, error) {
+	f, err := astParse(filename, input)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	f.format(buf)
+	return buf.Bytes(), nil
+}
+
+func (f *astFile) format(buf *bytes.Buffer) {
+	for i := 0; i < len(f.items); {
+		item := f.items[i]
+		if i != 0 && item.blankBefore {
+			buf.WriteByte('\n')
+		}
+		if item.verbatim {
+			buf.Write(bytes.TrimRight(f.input[item.start:item.end], " \t"))
+			buf.WriteByte('\n')
+			i++
+			continue
+		}
+		switch item.kind {
+		case astComment, astDirective:
+			buf.WriteString(formatComment(item.text.text))
+			buf.WriteByte('\n')
+			i++
+		case astDecl:
+			// neighboring declarations with the same keyword are aligned.
+			// all the precedence declarations in a block are aligned together.
+			j := i + 1
+			for ; j < len(f.items) && f.isDeclRunOf(item, f.items[j]); j++ {
+				//
+			}
+			formatDecls(buf, f.items[i:j])
+			i = j
+		case astRule:
+			j := i + 1
+			for ; j < len(f.items) && f.items[j].kind == astRule && !f.items[j].blankBefore && !f.items[j].verbatim; j++ {
+				//
+			}
+			formatRules(buf, f.items[i:j])
+			i = j
+		}
+	}
+}
+
+// isDeclRunOf returns true if next continues the block of declarations started by first.
+func (f *astFile) isDeclRunOf(first, next *astItem) bool {
+	if next.kind != astDecl || next.blankBefore || next.verbatim {
+		return false
+	} else if isPrecedenceKeyword(first.keyword.text) {
+		return isPrecedenceKeyword(next.keyword.text)
+	}
+	return first.keyword.text == next.keyword.text && declShapeOf(first.keyword.text) == declSymbol
+}
+
+// formatDecls writes a block of related declarations.
+func formatDecls(buf *bytes.Buffer, items []*astItem) {
+	// width of the keyword and the first argument, used for alignment
+	kwWidth, symWidth := 0, 0
+	for _, item := range items {
+		kwWidth = max(kwWidth, len(item.keyword.text)+1)
+		if declShapeOf(item.keyword.text) == declSymbol {
+			symWidth = max(symWidth, len(item.args[0].text))
+		}
+	}
+	for _, item := range items {
+		line := &strings.Builder{}
+		line.WriteString("%" + item.keyword.text)
+		switch declShapeOf(item.keyword.text) {
+		case declSingle:
+			line.WriteString(" " + formatCode(item.args[0].text, ""))
+		case declSymbol:
+			line.WriteString(" " + padRight(item.args[0].text, symWidth) + " " + formatCode(item.args[1].text, ""))
+		default:
+			if len(items) > 1 {
+				line.WriteString(strings.Repeat(" ", kwWidth-len(item.keyword.text)-1))
+			}
+			if len(item.args) == 1 && !item.terminated {
+				line.WriteString(" " + formatCode(item.args[0].text, ""))
+				break
+			}
+			col, indent := line.Len(), line.Len()+1
+			for _, arg := range item.args {
+				if col+1+len(arg.text) > formatWidth && col > indent {
+					line.WriteString("\n" + strings.Repeat(" ", indent-1))
+					col = indent - 1
+				}
+				line.WriteString(" " + arg.text)
+				col += 1 + len(arg.text)
+			}
+			if item.terminated {
+				line.WriteString(".")
+			}
+		}
+		buf.WriteString(line.String())
+		if item.trailing != nil {
+			buf.WriteString(" " + formatComment(item.trailing.text))
+		}
+		buf.WriteByte('\n')
+	}
+}
+
+// formatRules writes a block of neighboring rules with their "::=" aligned.
+// The code blocks are aligned, too, unless the rule is too long.
+func formatRules(buf *bytes.Buffer, items []*astItem) {
+	lhsWidth := 0
+	for _, item := range items {
+		lhsWidth = max(lhsWidth, len(formatLHS(item)))
+	}
+	rules, codeWidth := make([]string, len(items)), 0
+	for i, item := range items {
+		line := &strings.Builder{}
+		line.WriteString(padRight(formatLHS(item), lhsWidth))
+		line.WriteString(" ::=")
+		if rhs := formatRHS(item.rhs); rhs != "" {
+			line.WriteString(" " + rhs + ".")
+		} else {
+			line.WriteString(" .")
+		}
+		if item.prec != nil {
+			line.WriteString(" [" + item.prec.text + "]")
+		}
+		rules[i] = line.String()
+		if item.code != nil && len(rules[i]) < formatWidth/2 {
+			codeWidth = max(codeWidth, len(rules[i]))
+		}
+	}
+	for i, item := range items {
+		buf.WriteString(rules[i])
+		if item.code != nil {
+			buf.WriteString(strings.Repeat(" ", max(1, codeWidth+1-len(rules[i]))))
+			buf.WriteString(formatCode(item.code.text, ""))
+		}
+		if item.trailing != nil {
+			buf.WriteString(" " + formatComment(item.trailing.text))
+		}
+		buf.WriteByte('\n')
+	}
+}
+
+// formatLHS returns the left-hand side of a rule with its alias.
+func formatLHS(item *astItem) string {
+	if item.lhsalias == nil {
+		return item.lhs.text
+	}
+	return item.lhs.text + "(" + item.lhsalias.text + ")"
+}
+
+// formatRHS returns the right-hand side of a rule.
+// Aliases, the parts of a multi-terminal and the EBNF "?", "*" and "+"
+// are attached to their symbol. Groups are written as "(a | b)" and the
+// arguments of a template as "list(COMMA, expr)".
+func formatRHS(rhs []astToken) string {
+	isAlias := func(i int) bool {
+		if i > 0 && i+3 < len(rhs) && rhs[i].offset > rhs[i-1].end() && strings.Contains("?*+", rhs[i+3].text) {
+			return false // a group, like "A (B)*"
+		}
+		return i > 0 && i+2 < len(rhs) && rhs[i].text == "(" && isalpha(rhs[i+1].text[0]) && rhs[i+2].text == ")" &&
+			rhs[i-1].text != "(" && rhs[i-1].text != "[" && rhs[i-1].text != "|"
+	}
+	// isCall is true for the arguments of a template, like list(COMMA, expr)
+	isCall := func(i int) bool {
+		if i == 0 || rhs[i].text != "(" || !isalnum(rhs[i-1].text[0]) {
+			return false
+		}
+		for j, depth := i+1, 1; j < len(rhs) && depth > 0; j++ {
+			switch rhs[j].text {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			case ",":
+				if depth == 1 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	sb := &strings.Builder{}
+	for i, tok := range rhs {
+		attach := false
+		switch {
+		case isAlias(i), i > 1 && isAlias(i-1), i > 2 && isAlias(i-2), isCall(i):
+			attach = true
+		case tok.text == ")" || tok.text == "]" || tok.text == "," || tok.text == "?" || tok.text == "*" || tok.text == "+":
+			attach = true
+		case len(tok.text) > 1 && (tok.text[0] == '|' || tok.text[0] == '/'):
+			attach = true
+		case i > 0 && (rhs[i-1].text == "(" || rhs[i-1].text == "["):
+			attach = true
+		}
+		if i > 0 && !attach {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(tok.text)
+	}
+	return sb.String()
+}
+
+// formatCode re-indents a block of code.
+// Single line blocks are not changed.
+// The body of a multi-line block is indented one level past the given indent
+// and the closing brace is put on its own line.
+func formatCode(code string, indent string) string {
+	if !strings.HasPrefix(code, "{") || !strings.HasSuffix(code, "}") {
+		return code
+	}
+	body := code[1 : len(code)-1]
+	if !strings.Contains(body, "\n") {
+		return code
+	}
+
+	lines := strings.Split(body, "\n")
+	// a line that starts inside a raw string or a comment is copied as it
+	// is, and a line that ends inside one keeps its trailing white-space,
+	// so that re-indenting doesn't change the value of the string.
+	startsInside, endsInside := codeLineStates(lines)
+	first := strings.TrimLeft(lines[0], " \t")
+	if !endsInside[0] {
+		first = strings.TrimRight(first, " \t")
+	}
+	rest := lines[1:]
+	// the common leading white-space is replaced by the new indentation.
+	// preprocessor lines are ignored since they must stay in column one.
+	prefix, found := "", false
+	for i, line := range rest {
+		if strings.TrimSpace(line) == "" || isCodeDirective(line) || startsInside[i+1] {
+			continue
+		}
+		lead := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !found {
+			prefix, found = lead, true
+		} else {
+			prefix = commonPrefix(prefix, lead)
+		}
+	}
+
+	// the indentation left after the prefix is written with tabs. a level is
+	// a tab or the smallest run of spaces that any line is indented by.
+	unit := 0
+	for i, line := range rest {
+		if strings.TrimSpace(line) == "" || isCodeDirective(line) || startsInside[i+1] || !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		lead := strings.TrimPrefix(line, prefix)
+		if spaces := len(lead) - len(strings.TrimLeft(lead, " ")); spaces != 0 && (unit == 0 || spaces < unit) {
+			unit = spaces
+		}
+	}
+
+	sb := &strings.Builder{}
+	sb.WriteString("{")
+	if first != "" {
+		sb.WriteString(" " + first)
+	}
+	for i, line := range rest {
+		if startsInside[i+1] {
+			sb.WriteString("\n" + line)
+			continue
+		} else if !endsInside[i+1] {
+			line = strings.TrimRight(line, " \t")
+		}
+		if i == len(rest)-1 && strings.TrimSpace(line) == "" {
+			// the line with the closing brace
+			break
+		}
+		sb.WriteByte('\n')
+		if line == "" {
+			continue
+		} else if isCodeDirective(line) {
+			sb.WriteString(line)
+			continue
+		}
+		sb.WriteString(indent + formatIndent + retab(strings.TrimPrefix(line, prefix), unit))
+	}
+	sb.WriteString("\n" + indent + "}")
+	return sb.String()
+}
+
+// retab replaces the leading white-space of a line with a tab for each
+// level of indentation. A level is a tab or a run of unit spaces; spaces
+// left over are kept since they line the code up rather than indent it.
+func retab(line string, unit int) string {
+	unit = max(unit, 1)
+	levels, spaces, i := 0, 0, 0
+	for ; i < len(line) && (line[i] == ' ' || line[i] == '\t'); i++ {
+		if line[i] == '\t' {
+			levels, spaces = levels+1+spaces/unit, 0
+		} else {
+			spaces++
+		}
+	}
+	levels += spaces / unit
+	return strings.Repeat("\t", levels) + strings.Repeat(" ", spaces%unit) + line[i:]
+}
+
+// codeLineStates returns, for each line of code, whether the line starts
+// inside a raw string or a block comment and whether it ends inside one.
+// Strings and character constants end with their line.
+func codeLineStates(lines []string) (startsInside, endsInside []bool) {
+	startsInside, endsInside = make([]bool, len(lines)), make([]bool, len(lines))
+	var open string // "`" or "*/" while inside a raw string or block comment
+	for n, line := range lines {
+		startsInside[n] = open != ""
+		for i := 0; i < len(line); i++ {
+			switch {
+			case open != "":
+				if strings.HasPrefix(line[i:], open) {
+					i += len(open) - 1
+					open = ""
+				}
+			case line[i] == '`':
+				open = "`"
+			case strings.HasPrefix(line[i:], "/*"):
+				open, i = "*/", i+1
+			case strings.HasPrefix(line[i:], "//"):
+				i = len(line)
+			case line[i] == '"' || line[i] == '\'':
+				quote := line[i]
+				for i++; i < len(line) && line[i] != quote; i++ {
+					if line[i] == '\\' {
+						i++
+					}
+				}
+			}
+		}
+		endsInside[n] = open != ""
+	}
+	return startsInside, endsInside
+}
+
+// isCodeDirective returns true if the line of code is a C or lemon preprocessor line.
+func isCodeDirective(line string) bool {
+	return strings.HasPrefix(line, "#") || isPreprocessorLine([]byte(line))
+}
+
+// formatComment strips trailing white-space from each line of a comment.
+func formatComment(comment string) string {
+	lines := strings.Split(comment, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func commonPrefix(a, b string) string {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return a[:n]
+}
+
+func padRight(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-len(s))
+}
@@ -0,0 +1,81 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	type test_case struct {
+		id     int
+		input  string
+		expect string
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			input:  "a ::= B.\nlong(X) ::=   a  C(Y). {X=Y;}\nlong ::= . // empty\n",
+			expect: "a       ::= B.\nlong(X) ::= a C(Y). {X=Y;}\nlong    ::= . // empty\n",
+		},
+		{id: 2,
+			input:  "%left  PLUS   MINUS .\n%nonassoc EQ.\n%right EXP .\n",
+			expect: "%left     PLUS MINUS.\n%nonassoc EQ.\n%right    EXP.\n",
+		},
+		{id: 3,
+			input:  "a ::= B. {\n\t\tif (x) {\n\t\t\ty();\n\t\t}\n\t\t}\n",
+			expect: "a ::= B. {\n\tif (x) {\n\t\ty();\n\t}\n}\n",
+		},
+		{id: 4,
+			input:  "/* header */\n\n\n\n%type a {int}\n%type bcd {char *}\n%ifdef X\na ::= B.\n%endif\n",
+			expect: "/* header */\n\n%type a   {int}\n%type bcd {char *}\n%ifdef X\na ::= B.\n%endif\n",
+		},
+		{id: 5,
+			input:  "a ::= B /* keep */ C.\n",
+			expect: "a ::= B /* keep */ C.\n",
+		},
+		{id: 6,
+			input:  "%include {\n    #include <stdio.h>\n    int x;\n}\n",
+			expect: "%include {\n\t#include <stdio.h>\n\tint x;\n}\n",
+		},
+		{id: 7,
+			input:  "list ::= LP [ item ( COMMA item ) * ] RP.\nx(X) ::= a  (  B |  C  ) + d(D) ? ( E  F ).\n",
+			expect: "list ::= LP [item (COMMA item)*] RP.\nx(X) ::= a (B | C)+ d(D)? (E F).\n",
+		},
+		{id: 8,
+			input:  "%template pair A B.\npair ::= A B.\nx ::= pair ( COMMA ,  pair(LP,RP) ) opt (x).\n",
+			expect: "%template pair A B.\npair ::= A B.\nx    ::= pair(COMMA, pair(LP, RP)) opt(x).\n",
+		},
+		{id: 9,
+			input:  "a ::= B. {\n\t\ts := `one  \n\t\t  two\n    three`\n\t\t/* a\n\t\t   b */\n\t\tf(s)\n\t}\n",
+			expect: "a ::= B. {\n\ts := `one  \n\t\t  two\n    three`\n\t/* a\n\t\t   b */\n\tf(s)\n}\n",
+		},
+		{id: 10,
+			input:  "x ::= A (B)* C (D) E(F)+.\n",
+			expect: "x ::= A (B)* C(D) E(F)+.\n",
+		},
+	} {
+		got, err := Format("test.y", []byte(tc.input))
+		if err != nil {
+			t.Errorf("%2d: want success: got %+v\n", tc.id, err)
+		} else if tc.expect != string(got) {
+			t.Errorf("%2d: want\nvvvvv\n%s^^^^\n%2d: got\nvvvv\n%s^^^^\n", tc.id, tc.expect, tc.id, got)
+		} else if again, _ := Format("test.y", got); string(again) != string(got) {
+			t.Errorf("%2d: formatting is not stable:\nvvvv\n%s^^^^\n", tc.id, again)
+		}
+	}
+}
+
+func TestFormatExample(t *testing.T) {
+	input, err := os.ReadFile("example.y")
+	if err != nil {
+		t.Fatalf("example.y: %v\n", err)
+	}
+	got, err := Format("example.y", input)
+	if err != nil {
+		t.Fatalf("example.y: want success: got %+v\n", err)
+	} else if string(got) != string(input) {
+		t.Errorf("example.y: is not formatted\n")
+	}
+}
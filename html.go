@@ -0,0 +1,258 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// htmlReport is the data for the HTML report of the automaton.
+type htmlReport struct {
+	Grammar      string
+	ShiftReduce  int
+	ReduceReduce int
+	Symbols      []*htmlSymbol
+	Rules        []*htmlRule
+	States       []*htmlState
+}
+
+type htmlSymbol struct {
+	htmlSymbolRef
+	Token    string // the name of a terminal that is shown by its spelling
+	Terminal bool
+	Prec     string // "left 1" or "" if no precedence
+	Nullable bool
+	First    []htmlSymbolRef
+	Rules    []int // the rules with the symbol on the left
+}
+
+// htmlSymbolRef is a link to a symbol. The index is used for the anchor
+// because a symbol name like "$" isn't kept as is in a URL.
+type htmlSymbolRef struct {
+	Name  string // the spelling of a terminal that has one
+	Index int
+}
+
+type htmlRule struct {
+	Index     int
+	Line      int
+	Text      string
+	ReducedIn []int // the states that reduce by the rule
+}
+
+type htmlState struct {
+	Index     int
+	Configs   []htmlConfig
+	Actions   []htmlAction
+	Conflicts []string // the lookaheads with conflicts
+}
+
+type htmlConfig struct {
+	Rule  int
+	Text  string
+	Basis bool
+}
+
+type htmlAction struct {
+	Lookahead htmlSymbolRef
+	Kind      string // "shift", "reduce", "accept", or the name of the e_action in lower case
+	State     int    // the next state of a shift
+	Rule      int    // the rule of a reduce
+	Conflict  bool
+	Resolved  bool // true if the action lost a conflict to precedence
+}
+
+// ReportHTML writes the states, rules and symbols as a single HTML page.
+// Each shift links to the next state, each reduce links to the rule, and
+// each rule lists the states that reduce it. It must be called after
+// FindActions.
+func ReportHTML(w io.Writer, lemp *lemon) error {
+	r := &htmlReport{Grammar: lemp.filename, ShiftReduce: lemp.nsrconflict, ReduceReduce: lemp.nrrconflict}
+
+	rules := make(map[*rule]*htmlRule)
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		text := &bytes.Buffer{}
+		rp.printCursor(text, -1)
+		hr := &htmlRule{Index: rp.iRule, Line: rp.ruleline, Text: text.String() + "."}
+		rules[rp] = hr
+		r.Rules = append(r.Rules, hr)
+	}
+
+	for i := 0; i < lemp.nsymbol; i++ {
+		sp := lemp.symbols[i]
+		hs := &htmlSymbol{htmlSymbolRef: htmlSymbolRef{Name: sp.displayName(), Index: sp.index}, Terminal: i < lemp.nterminal, Nullable: sp.lambda}
+		if sp.spelling != "" {
+			hs.Token = sp.name
+		}
+		if sp.prec >= 0 {
+			hs.Prec = strings.ToLower(sp.assoc.String())
+			if sp.assoc == NONE {
+				hs.Prec = "nonassoc"
+			}
+			hs.Prec = hs.Prec + " " + strconv.Itoa(sp.prec)
+		}
+		if !hs.Terminal {
+			for j := 0; j < lemp.nterminal; j++ {
+				if sp.firstset.Has(j) {
+					hs.First = append(hs.First, htmlSymbolRef{Name: lemp.symbols[j].displayName(), Index: j})
+				}
+			}
+			for rp := sp.rule; rp != nil; rp = rp.nextlhs {
+				hs.Rules = append([]int{rp.iRule}, hs.Rules...)
+			}
+		}
+		r.Symbols = append(r.Symbols, hs)
+	}
+
+	for _, stp := range lemp.sorted {
+		hs := &htmlState{Index: stp.statenum}
+		basis := make(map[*config]bool)
+		for cfp := stp.bp; cfp != nil; cfp = cfp.bp {
+			basis[cfp] = true
+		}
+		for cfp := stp.cfp; cfp != nil; cfp = cfp.next {
+			text := &bytes.Buffer{}
+			cfp.rp.printCursor(text, cfp.dot)
+			hs.Configs = append(hs.Configs, htmlConfig{Rule: cfp.rp.iRule, Text: text.String(), Basis: basis[cfp]})
+		}
+		for ap := stp.ap; ap != nil; ap = ap.next {
+			ha := htmlAction{Lookahead: htmlSymbolRef{Name: ap.sp.displayName(), Index: ap.sp.index}, Kind: strings.ToLower(ap.type_.String())}
+			switch ap.type_ {
+			case SHIFT, SSCONFLICT, SH_RESOLVED:
+				ha.State = ap.x.stp.statenum
+			case REDUCE, SRCONFLICT, RRCONFLICT, RD_RESOLVED:
+				ha.Rule = ap.x.rp.iRule
+			case ACCEPT:
+			default:
+				continue
+			}
+			switch ap.type_ {
+			case SSCONFLICT, SRCONFLICT, RRCONFLICT:
+				ha.Conflict = true
+				if n := len(hs.Conflicts); n == 0 || hs.Conflicts[n-1] != ap.sp.displayName() {
+					hs.Conflicts = append(hs.Conflicts, ap.sp.displayName())
+				}
+			case SH_RESOLVED, RD_RESOLVED:
+				ha.Resolved = true
+			}
+			if ap.type_ == REDUCE {
+				hr := rules[ap.x.rp]
+				if n := len(hr.ReducedIn); n == 0 || hr.ReducedIn[n-1] != stp.statenum {
+					hr.ReducedIn = append(hr.ReducedIn, stp.statenum)
+				}
+			}
+			hs.Actions = append(hs.Actions, ha)
+		}
+		// the action that won a conflict is highlighted with the losers
+		for i, ha := range hs.Actions {
+			for _, la := range hs.Conflicts {
+				if ha.Lookahead.Name == la && !ha.Resolved {
+					hs.Actions[i].Conflict = true
+				}
+			}
+		}
+		r.States = append(r.States, hs)
+	}
+
+	return htmlTemplate.Execute(w, r)
+}
+
+// htmlTemplate is the page for ReportHTML. The style sheet and the script
+// for searching are in the page so that it can be opened from anywhere.
+var htmlTemplate = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Grammar}} - lemon report</title>
+<style>
+body { font-family: sans-serif; margin: 0; }
+header { position: sticky; top: 0; background: #eee; padding: 0.5em 1em; border-bottom: 1px solid #ccc; }
+main { padding: 0 1em; }
+pre, code, td { font-family: monospace; }
+section.state, li.rule { margin: 0.5em 0; }
+section.state { border: 1px solid #ddd; padding: 0.25em 0.75em; }
+section.conflict { border-color: #c00; background: #fff0f0; }
+tr.conflict td { color: #c00; font-weight: bold; }
+tr.resolved td { color: #999; }
+.basis { font-weight: bold; }
+.hidden { display: none; }
+:target { outline: 2px solid #06c; }
+</style>
+</head>
+<body>
+<header>
+<strong>{{.Grammar}}</strong>:
+{{len .States}} states, {{len .Rules}} rules,
+<a href="#conflicts">{{.ShiftReduce}} shift/reduce and {{.ReduceReduce}} reduce/reduce conflicts</a>.
+<input id="search" type="search" placeholder="search states">
+<label><input id="conflicts-only" type="checkbox"> conflicts only</label>
+</header>
+<main>
+<h2 id="conflicts">Conflicts</h2>
+<ul>
+{{- range .States}}{{if .Conflicts}}
+<li><a href="#s{{.Index}}">state {{.Index}}</a> on {{range $i, $la := .Conflicts}}{{if $i}} {{end}}{{$la}}{{end}}</li>
+{{- end}}{{end}}
+</ul>
+
+<h2 id="states">States</h2>
+{{- range .States}}
+<section id="s{{.Index}}" class="state{{if .Conflicts}} conflict{{end}}">
+<h3>State {{.Index}}{{if .Conflicts}} (conflicts on {{range $i, $la := .Conflicts}}{{if $i}} {{end}}{{$la}}{{end}}){{end}}</h3>
+<pre>
+{{- range .Configs}}
+<span{{if .Basis}} class="basis"{{end}}><a href="#r{{.Rule}}">{{printf "%4d" .Rule}}</a> {{.Text}}</span>
+{{- end}}
+</pre>
+<table>
+{{- range .Actions}}
+<tr{{if .Conflict}} class="conflict"{{else if .Resolved}} class="resolved"{{end}}><td><a href="#y{{.Lookahead.Index}}">{{.Lookahead.Name}}</a></td><td>{{.Kind}}</td><td>
+{{- if eq .Kind "shift" "ssconflict" "sh_resolved"}}<a href="#s{{.State}}">state {{.State}}</a>
+{{- else if eq .Kind "accept"}}
+{{- else}}<a href="#r{{.Rule}}">rule {{.Rule}}</a>{{end}}</td></tr>
+{{- end}}
+</table>
+</section>
+{{- end}}
+
+<h2 id="rules">Rules</h2>
+<ol start="0">
+{{- range .Rules}}
+<li id="r{{.Index}}" class="rule" value="{{.Index}}"><code>{{.Text}}</code> (line {{.Line}})
+{{- if .ReducedIn}}, reduced in {{range $i, $n := .ReducedIn}}{{if $i}}, {{end}}<a href="#s{{$n}}">state {{$n}}</a>{{end}}
+{{- else}}, never reduced{{end}}</li>
+{{- end}}
+</ol>
+
+<h2 id="symbols">Symbols</h2>
+<table>
+<tr><th>symbol</th><th>kind</th><th>precedence</th><th>nullable</th><th>first</th><th>rules</th></tr>
+{{- range .Symbols}}
+<tr id="y{{.Index}}"><td>{{.Name}}{{if .Token}} ({{.Token}}){{end}}</td><td>{{if .Terminal}}terminal{{else}}nonterminal{{end}}</td><td>{{.Prec}}</td><td>{{if .Nullable}}yes{{end}}</td>
+<td>{{range $i, $sp := .First}}{{if $i}} {{end}}<a href="#y{{$sp.Index}}">{{$sp.Name}}</a>{{end}}</td>
+<td>{{range $i, $n := .Rules}}{{if $i}} {{end}}<a href="#r{{$n}}">{{$n}}</a>{{end}}</td></tr>
+{{- end}}
+</table>
+</main>
+<script>
+const search = document.getElementById("search");
+const conflictsOnly = document.getElementById("conflicts-only");
+function filterStates() {
+  const text = search.value.toLowerCase();
+  for (const section of document.querySelectorAll("section.state")) {
+    const hide = (conflictsOnly.checked && !section.classList.contains("conflict")) ||
+      (text !== "" && !section.textContent.toLowerCase().includes(text));
+    section.classList.toggle("hidden", hide);
+  }
+}
+search.addEventListener("input", filterStates);
+conflictsOnly.addEventListener("change", filterStates);
+</script>
+</body>
+</html>
+`))
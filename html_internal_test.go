@@ -0,0 +1,49 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestReportHTML(t *testing.T) {
+	lem := parseGrammar(t, "%left TIMES.\nprog ::= expr.\nexpr ::= expr PLUS expr.\nexpr ::= expr TIMES expr.\nexpr ::= NUM.\n")
+	lem.warnings = newWarningFlags()
+	lem.warnings.enabled[CONFLICTS] = false
+	analyzeGrammar(lem)
+	w := &bytes.Buffer{}
+	if err := ReportHTML(w, lem); err != nil {
+		t.Fatalf("html: %v\n", err)
+	}
+	page := w.String()
+
+	// every link in the page goes to an anchor in the page
+	ids := make(map[string]bool)
+	for _, m := range regexp.MustCompile(`id="([^"]+)"`).FindAllStringSubmatch(page, -1) {
+		ids[m[1]] = true
+	}
+	for _, m := range regexp.MustCompile(`href="#([^"]+)"`).FindAllStringSubmatch(page, -1) {
+		if !ids[m[1]] {
+			t.Errorf("html: link to missing anchor %q\n", m[1])
+		}
+	}
+
+	for _, want := range []string{
+		`<strong>` + lem.filename + `</strong>`,
+		`3 shift/reduce and 0 reduce/reduce conflicts`,
+		`class="state conflict"`,
+		`<td>srconflict</td>`,
+		`<tr class="resolved"><td><a href="#y1">TIMES</a></td><td>sh_resolved</td>`,
+		`<code>expr ::= NUM.</code> (line 5), reduced in`,
+		`<td>left 1</td>`,
+		`<input id="search" type="search"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("html: want %s\n", want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"github.com/mdhender/lemon/internal/macros"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A grammar can be split across files. The declaration
+//
+//	%include_grammar "expr.y"
+//
+// reads the other file at that point, as if its text were part of the
+// including file. The file is looked for in the directory of the including
+// file and then in the directories given with -I, in order. A file can't
+// include itself, directly or through other files. (%include is the code
+// that is copied into the generated parser.)
+//
+// The lines of each file that is read are numbered after the lines of the
+// files read before it, so a line number still names a single line of the
+// grammar after the files are parsed. ErrorMsg and the #line macros turn it
+// back into the name of the file and the line in that file.
+
+// sourceFile is a file that was read while parsing the grammar.
+type sourceFile struct {
+	name  string // the name of the file, as it is reported
+	base  int    // the line numbers of the file start after this one
+	lines int    // the number of lines in the file
+}
+
+// sourceFiles are the files of the grammar being parsed, in the order they
+// were read. The first is the grammar file.
+var sourceFiles []sourceFile
+
+// sourcePosition returns the name of the file and the line in that file
+// for a line number of the grammar. A message for any other file, or one
+// without a line, is left as it is.
+func sourcePosition(filename string, lineno int) (string, int) {
+	if len(sourceFiles) < 2 || lineno <= 0 || filename != sourceFiles[0].name {
+		return filename, lineno
+	}
+	for i := len(sourceFiles) - 1; i > 0; i-- {
+		if sf := sourceFiles[i]; lineno > sf.base && lineno <= sf.base+sf.lines {
+			return sf.name, lineno - sf.base
+		}
+	}
+	return filename, lineno
+}
+
+// sourceLine returns a line number of the grammar for a message, like
+// "line 12", or "line 12 of expr.y" when the line is in an included file.
+func sourceLine(filename string, lineno int) string {
+	name, line := sourcePosition(filename, lineno)
+	if name != filename {
+		return fmt.Sprintf("line %d of %s", line, name)
+	}
+	return fmt.Sprintf("line %d", line)
+}
+
+// includePath is the list of directories from -I.
+type includePath []string
+
+// String implements the flag.Value interface.
+func (p *includePath) String() string {
+	return strings.Join(*p, string(filepath.ListSeparator))
+}
+
+// Set implements the flag.Value interface.
+func (p *includePath) Set(dir string) error {
+	*p = append(*p, dir)
+	return nil
+}
+
+// includeFile reads the grammar file named by %include_grammar and passes
+// its tokens to the parser.
+func (psp *pstate) includeFile(literal string) {
+	name := strings.TrimSuffix(strings.TrimPrefix(literal, `"`), `"`)
+	path, ok := psp.findInclude(name)
+	if !ok {
+		ErrorMsg(psp.filename, psp.tokenlineno, "can't find the grammar file %q to include.", name)
+		psp.errorcnt++
+		return
+	}
+	for i, including := range psp.including {
+		if samePath(including, path) {
+			ErrorMsg(psp.filename, psp.tokenlineno, "%q includes itself: %s.", including, strings.Join(append(append([]string{}, psp.including[i:]...), path), " -> "))
+			psp.errorcnt++
+			return
+		}
+	}
+	input, err := os.ReadFile(path)
+	if err != nil {
+		ErrorMsg(psp.filename, psp.tokenlineno, "can't read the grammar file %q: %v.", path, err)
+		psp.errorcnt++
+		return
+	}
+	for name := range macros.Names(input) {
+		psp.tested[name] = true
+	}
+	input, err = macros.PreProcess(input, psp.symtab)
+	if err != nil {
+		ErrorMsg(path, 0, "%v", err)
+		psp.errorcnt++
+		return
+	}
+	psp.scan(path, input)
+}
+
+// findInclude returns the path of a file to include. A relative name is
+// looked for next to the including file and then in the -I directories.
+func (psp *pstate) findInclude(name string) (string, bool) {
+	var candidates []string
+	if filepath.IsAbs(name) {
+		candidates = append(candidates, name)
+	} else {
+		candidates = append(candidates, filepath.Join(filepath.Dir(psp.including[len(psp.including)-1]), name))
+		for _, dir := range psp.gp.includeDirs {
+			candidates = append(candidates, filepath.Join(dir, name))
+		}
+	}
+	for _, path := range candidates {
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// samePath returns true if two paths name the same file.
+func samePath(a, b string) bool {
+	if absA, err := filepath.Abs(a); err == nil {
+		a = absA
+	}
+	if absB, err := filepath.Abs(b); err == nil {
+		b = absB
+	}
+	return a == b
+}
@@ -0,0 +1,109 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncludeGrammar(t *testing.T) {
+	type test_case struct {
+		id      int
+		files   map[string]string // the grammar is "main.y"
+		dirs    []string          // the -I directories
+		expect  []string          // the messages, as file:line: message
+		include string            // the %include code, if expected
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			files: map[string]string{
+				"main.y": "prog ::= expr.\n%include_grammar \"expr.y\"\n",
+				"expr.y": "expr ::= expr PLUS NUM.\nexpr ::= NUM.\n",
+			},
+		},
+		{id: 2,
+			files: map[string]string{
+				"main.y": "prog ::= expr.\n%include_grammar \"expr.y\"\nprog ::= ].\n",
+				"expr.y": "expr ::= NUM.\n\nexpr ::= NUM ].\n",
+			},
+			expect: []string{
+				`expr.y:3: "]" does not close a group.`,
+				`main.y:3: "]" does not close a group.`,
+			},
+		},
+		{id: 3,
+			files: map[string]string{
+				"main.y":     "prog ::= expr.\n%include_grammar \"expr.y\"\n",
+				"inc/expr.y": "%include {\n#include <stdio.h>\n}\nexpr ::= term.\n",
+			},
+			dirs:    []string{"inc"},
+			expect:  []string{`inc/expr.y:4: Nonterminal "term" is used but has no rules.`},
+			include: "#line 1 inc/expr.y\n{\n#include <stdio.h>\n}",
+		},
+		{id: 4,
+			files: map[string]string{
+				"main.y": "%include_grammar \"a.y\"\nprog ::= A.\n",
+				"a.y":    "a ::= A.\n%include_grammar \"b.y\"\n",
+				"b.y":    "%include_grammar \"a.y\"\nb ::= B.\n",
+			},
+			expect: []string{`b.y:1: "a.y" includes itself: a.y -> b.y -> a.y.`},
+		},
+		{id: 5,
+			files:  map[string]string{"main.y": "%include_grammar \"missing.y\"\nprog ::= A.\n"},
+			expect: []string{`main.y:1: can't find the grammar file "missing.y" to include.`},
+		},
+		{id: 6,
+			files:  map[string]string{"main.y": "%include_grammar missing\nprog ::= A.\n"},
+			expect: []string{`main.y:1: %include_grammar needs the name of a file in quotes, not "missing".`},
+		},
+	} {
+		dir := t.TempDir()
+		for name, text := range tc.files {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		Symbol_init()
+		State_init()
+		Symbol_new("$")
+		lem := &lemon{filename: filepath.Join(dir, "main.y"), warnings: newWarningFlags()}
+		for _, name := range tc.dirs {
+			lem.includeDirs = append(lem.includeDirs, filepath.Join(dir, name))
+		}
+		var got []string
+		msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+			got = append(got, fmt.Sprintf("%s:%d: %s", filename, lineno, msg))
+		}
+		Parse(lem, map[string]string{})
+		if lem.errorcnt == 0 {
+			if err := numberGrammar(lem); err != nil {
+				t.Fatal(err)
+			}
+			FindRulePrecedences(lem.rule)
+			FindFirstSets(lem)
+			Lint(lem)
+		}
+		msgHook = nil
+		for i := range got {
+			got[i] = strings.ReplaceAll(got[i], dir+string(filepath.Separator), "")
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.expect, "\n") {
+			t.Errorf("%d: want\n%s\n%d: got\n%s\n", tc.id, strings.Join(tc.expect, "\n"), tc.id, strings.Join(got, "\n"))
+		}
+		if include := strings.ReplaceAll(lem.include, dir+string(filepath.Separator), ""); include != tc.include {
+			t.Errorf("%d: include: want %q: got %q\n", tc.id, tc.include, include)
+		}
+		if tc.id == 1 && (lem.nrule != 3 || lem.startSymbol().name != "prog") {
+			t.Errorf("%d: want 3 rules for prog: got %d for %s\n", tc.id, lem.nrule, lem.startSymbol().name)
+		}
+	}
+}
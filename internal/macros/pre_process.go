@@ -114,3 +114,32 @@ func PreProcess(input []byte, symtab map[string]string) ([]byte, error) {
 	// join the lines back together and return them
 	return bytes.Join(lines, []byte{'\n'}), nil
 }
+
+// Names returns the names of the macros that are tested by the
+// "%if," "%ifdef," and "%ifndef" lines in the input.
+// Lines with malformed expressions are ignored.
+func Names(input []byte) map[string]bool {
+	names := make(map[string]bool)
+	for _, line := range bytes.Split(input, []byte{'\n'}) {
+		var expr []byte
+		if ismacro(line, "%ifndef") {
+			expr = line[7:]
+		} else if ismacro(line, "%ifdef") {
+			expr = line[6:]
+		} else if ismacro(line, "%if") {
+			expr = line[3:]
+		} else {
+			continue
+		}
+		tokens, err := parseExpression(expr)
+		if err != nil {
+			continue
+		}
+		for _, tok := range tokens {
+			if tok.kind == cVariable {
+				names[string(tok.value)] = true
+			}
+		}
+	}
+	return names
+}
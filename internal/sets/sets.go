@@ -41,3 +41,8 @@ func (s *Set) Union(s2 *Set) bool {
 	}
 	return updatedCount != 0
 }
+
+// Has returns TRUE if the element is in the set.
+func (s *Set) Has(e int) bool {
+	return 0 <= e && e < len(s.elements) && s.elements[e]
+}
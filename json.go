@@ -0,0 +1,234 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// jsonVersion is the version of the document written by ReportJSON.
+// It changes when a field is removed or its meaning changes; adding a
+// field does not change the version.
+const jsonVersion = 1
+
+// jsonModel is the document written by ReportJSON.
+// Lists are never null, and fields are never omitted; a missing value is
+// written as "", -1 or null.
+type jsonModel struct {
+	Version      int           `json:"version"`
+	Grammar      string        `json:"grammar"` // the name of the grammar file
+	Name         string        `json:"name"`
+	Start        string        `json:"start"` // the first start symbol
+	Entries      []jsonEntry   `json:"entries"`
+	TokenPrefix  string        `json:"tokenPrefix"`
+	TokenType    string        `json:"tokenType"`
+	DefaultType  string        `json:"defaultType"`
+	LocationType string        `json:"locationType"` // "" if there is no %location_type
+	NTerminal    int           `json:"nterminal"`    // symbols with a smaller index are terminals
+	Conflicts    jsonConflicts `json:"conflicts"`
+	Symbols      []jsonSymbol  `json:"symbols"`
+	Rules        []jsonRule    `json:"rules"`
+	States       []jsonState   `json:"states"`
+}
+
+// jsonEntry is an entry point of the parser.
+type jsonEntry struct {
+	Symbol string `json:"symbol"` // the start symbol
+	Accept string `json:"accept"` // the symbol that is accepted, the start symbol or its helper
+	State  int    `json:"state"`  // the start state
+}
+
+type jsonConflicts struct {
+	ShiftReduce  int `json:"shiftReduce"`
+	ReduceReduce int `json:"reduceReduce"`
+}
+
+type jsonSymbol struct {
+	Index         int      `json:"index"`
+	Name          string   `json:"name"`
+	Type          string   `json:"type"`          // "terminal", "nonterminal" or "multiterminal"
+	Precedence    int      `json:"precedence"`    // -1 if none
+	Associativity string   `json:"associativity"` // "left", "right", "nonassoc", or "" if no precedence
+	Datatype      string   `json:"datatype"`
+	Fallback      string   `json:"fallback"`
+	First         []string `json:"first"` // the first set of a nonterminal
+	Nullable      bool     `json:"nullable"`
+	Subsymbols    []string `json:"subsymbols"` // the terminals of a multiterminal
+	Spelling      string   `json:"spelling"`   // the literal from %token, like "\"+\"", or ""
+	Line          int      `json:"line"`       // where the symbol is first seen
+}
+
+type jsonRule struct {
+	Index      int       `json:"index"` // the rule number in the generated tables
+	Line       int       `json:"line"`
+	Lhs        string    `json:"lhs"`
+	LhsAlias   string    `json:"lhsAlias"`
+	Rhs        []jsonRhs `json:"rhs"`
+	Precedence string    `json:"precedence"` // the precedence symbol
+	Code       string    `json:"code"`       // the action, without the braces
+	CodeLine   int       `json:"codeLine"`
+	Locations  []string  `json:"locations"` // the aliases whose locations the code uses, like "@A"
+	CanReduce  bool      `json:"canReduce"`
+}
+
+type jsonRhs struct {
+	Symbol     string   `json:"symbol"`
+	Alias      string   `json:"alias"`
+	Subsymbols []string `json:"subsymbols"` // the terminals if the symbol is a multiterminal like A|B
+}
+
+type jsonState struct {
+	Index   int          `json:"index"`
+	Configs []jsonConfig `json:"configs"`
+	Actions []jsonAction `json:"actions"`
+}
+
+type jsonConfig struct {
+	Rule       int      `json:"rule"`
+	Dot        int      `json:"dot"`
+	Basis      bool     `json:"basis"`
+	Lookaheads []string `json:"lookaheads"`
+}
+
+type jsonAction struct {
+	Lookahead string `json:"lookahead"`
+	Type      string `json:"type"`  // the e_action in lower case, like "shift" or "srconflict"
+	State     *int   `json:"state"` // the next state of a shift
+	Rule      *int   `json:"rule"`  // the rule of a reduce
+}
+
+// ReportJSON writes the symbols, rules and states of the grammar as a
+// JSON document. It must be called after FindActions.
+func ReportJSON(w io.Writer, lemp *lemon) error {
+	m := jsonModel{
+		Version:      jsonVersion,
+		Grammar:      lemp.filename,
+		Name:         lemp.name,
+		Start:        lemp.startSymbol().name,
+		TokenPrefix:  lemp.tokenprefix,
+		TokenType:    jsonType(lemp.tokentype),
+		DefaultType:  jsonType(lemp.vartype),
+		LocationType: jsonType(lemp.loctype),
+		NTerminal:    lemp.nterminal,
+		Conflicts:    jsonConflicts{ShiftReduce: lemp.nsrconflict, ReduceReduce: lemp.nrrconflict},
+		Entries:      []jsonEntry{},
+		Symbols:      []jsonSymbol{},
+		Rules:        []jsonRule{},
+		States:       []jsonState{},
+	}
+	for _, ep := range lemp.entries {
+		m.Entries = append(m.Entries, jsonEntry{Symbol: ep.sp.name, Accept: ep.goal.name, State: ep.stp.statenum})
+	}
+
+	for _, sp := range lemp.symbols {
+		if sp.name == "{default}" {
+			continue
+		}
+		js := jsonSymbol{
+			Index:      sp.index,
+			Name:       sp.name,
+			Type:       strings.ToLower(sp.type_.String()),
+			Precedence: sp.prec,
+			Datatype:   jsonType(sp.datatype),
+			First:      []string{},
+			Nullable:   sp.lambda,
+			Subsymbols: []string{},
+			Spelling:   sp.spelling,
+			Line:       sp.lineno,
+		}
+		if sp.index < lemp.nterminal {
+			// "$" is created as a nonterminal, but it is the end of input
+			js.Type = "terminal"
+		}
+		if sp.prec >= 0 {
+			switch sp.assoc {
+			case LEFT:
+				js.Associativity = "left"
+			case RIGHT:
+				js.Associativity = "right"
+			default:
+				js.Associativity = "nonassoc"
+			}
+		}
+		if sp.fallback != nil {
+			js.Fallback = sp.fallback.name
+		}
+		if sp.type_ == NONTERMINAL && sp.firstset != nil {
+			for i := 0; i < lemp.nterminal; i++ {
+				if sp.firstset.Has(i) {
+					js.First = append(js.First, lemp.symbols[i].name)
+				}
+			}
+		}
+		for _, subsym := range sp.subsym {
+			js.Subsymbols = append(js.Subsymbols, subsym.name)
+		}
+		m.Symbols = append(m.Symbols, js)
+	}
+
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		jr := jsonRule{
+			Index:     rp.iRule,
+			Line:      rp.ruleline,
+			Lhs:       rp.lhs.name,
+			LhsAlias:  rp.lhsalias,
+			Rhs:       []jsonRhs{},
+			CanReduce: rp.canReduce,
+			Locations: append([]string{}, rp.locations...),
+		}
+		for i, sp := range rp.rhs {
+			jrhs := jsonRhs{Symbol: sp.name, Alias: rp.rhsalias[i], Subsymbols: []string{}}
+			for _, subsym := range sp.subsym {
+				jrhs.Subsymbols = append(jrhs.Subsymbols, subsym.name)
+			}
+			jr.Rhs = append(jr.Rhs, jrhs)
+		}
+		if rp.precsym != nil {
+			jr.Precedence = rp.precsym.name
+		}
+		if rp.code != "" {
+			jr.Code, jr.CodeLine = strings.TrimSuffix(rp.code, "}"), rp.line
+		}
+		m.Rules = append(m.Rules, jr)
+	}
+
+	for _, stp := range lemp.sorted {
+		js := jsonState{Index: stp.statenum, Configs: []jsonConfig{}, Actions: []jsonAction{}}
+		basis := make(map[*config]bool)
+		for cfp := stp.bp; cfp != nil; cfp = cfp.bp {
+			basis[cfp] = true
+		}
+		for cfp := stp.cfp; cfp != nil; cfp = cfp.next {
+			jc := jsonConfig{Rule: cfp.rp.iRule, Dot: cfp.dot, Basis: basis[cfp], Lookaheads: []string{}}
+			for i := 0; i < lemp.nterminal; i++ {
+				if cfp.fws.Has(i) {
+					jc.Lookaheads = append(jc.Lookaheads, lemp.symbols[i].name)
+				}
+			}
+			js.Configs = append(js.Configs, jc)
+		}
+		for ap := stp.ap; ap != nil; ap = ap.next {
+			ja := jsonAction{Lookahead: ap.sp.name, Type: strings.ToLower(ap.type_.String())}
+			switch ap.type_ {
+			case SHIFT, SSCONFLICT, SH_RESOLVED:
+				ja.State = &ap.x.stp.statenum
+			case REDUCE, SRCONFLICT, RRCONFLICT, RD_RESOLVED:
+				ja.Rule = &ap.x.rp.iRule
+			}
+			js.Actions = append(js.Actions, ja)
+		}
+		m.States = append(m.States, js)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// jsonType returns a type from a declaration without its braces.
+func jsonType(datatype string) string {
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(datatype, "{"), "}"))
+}
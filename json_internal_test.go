@@ -0,0 +1,75 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestReportJSON(t *testing.T) {
+	lem := parseGrammar(t, "%left PLUS.\n%type expr {int}\nprog ::= expr.\nexpr(A) ::= expr(B) PLUS expr(C). { A = B + C; }\nexpr ::= NUM|ID.\n")
+	analyzeGrammar(lem)
+	w := &bytes.Buffer{}
+	if err := ReportJSON(w, lem); err != nil {
+		t.Fatalf("json: %v\n", err)
+	}
+	var m jsonModel
+	if err := json.Unmarshal(w.Bytes(), &m); err != nil {
+		t.Fatalf("json: %v\n", err)
+	}
+	if m.Version != jsonVersion || m.Start != "prog" || m.Conflicts.ShiftReduce != 0 {
+		t.Errorf("json: want version %d, start prog, no conflicts: got %d, %q, %d\n", jsonVersion, m.Version, m.Start, m.Conflicts.ShiftReduce)
+	}
+	if len(m.Entries) != 1 || m.Entries[0].Symbol != "prog" || m.Entries[0].Accept != "prog" || m.Entries[0].State != 0 {
+		t.Errorf("json: want entry prog in state 0: got %+v\n", m.Entries)
+	}
+
+	symbols := make(map[string]jsonSymbol)
+	for _, js := range m.Symbols {
+		symbols[js.Name] = js
+	}
+	if got := symbols["$"]; got.Type != "terminal" || got.Index != 0 {
+		t.Errorf("$: want terminal 0: got %+v\n", got)
+	}
+	if got := symbols["PLUS"]; got.Precedence != 1 || got.Associativity != "left" {
+		t.Errorf("PLUS: want 1 left: got %+v\n", got)
+	}
+	if got := symbols["expr"]; got.Type != "nonterminal" || got.Datatype != "int" || len(got.First) != 2 || got.Nullable {
+		t.Errorf("expr: want nonterminal int with 2 first: got %+v\n", got)
+	}
+	if _, ok := symbols["{default}"]; ok {
+		t.Errorf("{default}: want omitted\n")
+	}
+
+	var plus *jsonRule
+	for i, jr := range m.Rules {
+		if len(jr.Rhs) == 3 {
+			plus = &m.Rules[i]
+		} else if jr.Lhs == "expr" && len(jr.Rhs[0].Subsymbols) != 2 {
+			t.Errorf("rule: want NUM|ID: got %+v\n", jr)
+		}
+	}
+	if plus == nil || plus.LhsAlias != "A" || plus.Rhs[2].Alias != "C" || plus.Precedence != "PLUS" || plus.Code != " A = B + C; " || plus.Line != 4 {
+		t.Fatalf("rule: want expr(A) ::= expr(B) PLUS expr(C): got %+v\n", plus)
+	}
+
+	var shifts, reduces int
+	for _, js := range m.States {
+		for _, ja := range js.Actions {
+			if ja.Type == "shift" && ja.State == nil || ja.Type == "reduce" && ja.Rule == nil {
+				t.Errorf("state %d: want target for %+v\n", js.Index, ja)
+			}
+			if ja.Type == "shift" {
+				shifts++
+			} else if ja.Type == "reduce" && *ja.Rule == plus.Index {
+				reduces++
+			}
+		}
+	}
+	if len(m.States) != len(lem.sorted) || shifts == 0 || reduces == 0 {
+		t.Errorf("states: want %d states with shifts and reduces: got %d, %d, %d\n", len(lem.sorted), len(m.States), shifts, reduces)
+	}
+}
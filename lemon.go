@@ -8,50 +8,64 @@ package main
 // static variables.  Fields in the following structure can be thought
 // of as begin global variables in the program.)
 type lemon struct {
-	sorted            []*state  // Table of states sorted by state number
-	rule              *rule     // List of all rules
-	startRule         *rule     // First rule
-	nstate            int       // Number of states
-	nxstate           int       // nstate with tail degenerate states removed
-	nrule             int       // Number of rules
-	nruleWithAction   int       // Number of rules with actions
-	nsymbol           int       // Number of terminal and nonterminal symbols
-	nterminal         int       // Number of terminal symbols
-	minShiftReduce    int       // Minimum shift-reduce action value
-	errAction         int       // Error action value
-	accAction         int       // Accept action value
-	noAction          int       // No-op action value
-	minReduce         int       // Minimum reduce action
-	maxAction         int       // Maximum action value of any kind
-	symbols           []*symbol // Sorted array of pointers to symbols
-	errorcnt          int       // Number of errors
-	errsym            *symbol   // The error symbol
-	wildcard          *symbol   // Token that matches anything
-	name              string    // Name of the generated parser
-	arg               string    // Declaration of the 3th argument to parser
-	ctx               string    // Declaration of 2nd argument to constructor
-	tokentype         string    // Type of terminal symbols in the parser stack
-	vartype           string    // The default type of non-terminal symbols
-	start             string    // Name of the start symbol for the gram
-	stacksize         string    // Size of the parser stack
-	include           string    // Code to put at the start of the C file
-	error             string    // Code to execute when an error is seen
-	overflow          string    // Code to execute on a stack overflow
-	failure           string    // Code to execute on parser failure
-	accept            string    // Code to execute when the parser excepts
-	extracode         string    // Code appended to the generated file
-	tokendest         string    // Code to execute to destroy token data
-	vardest           string    // Code for the default non-terminal destructor
-	filename          string    // Name of the input file
-	outname           string    // Name of the current output file
-	tokenprefix       string    // A prefix added to token names in the .h file
-	nconflict         int       // Number of parsing conflicts
-	nactiontab        int       // Number of entries in the yy_action[] table
-	nlookaheadtab     int       // Number of entries in yy_lookahead[]
-	tablesize         int       // Total table size of all tables in bytes
-	basisflag         bool      // Print only basis configurations
-	printPreprocessed bool      // Show preprocessor output on stdout
-	has_fallback      bool      // True if any %fallback is seen in the grammar
-	nolinenosflag     bool      // True if #line statements should not be printed
-	argv0             string    // Name of the program
+	sorted            []*state        // Table of states sorted by state number
+	rule              *rule           // List of all rules
+	startRule         *rule           // First rule
+	nstate            int             // Number of states
+	nxstate           int             // nstate with tail degenerate states removed
+	nrule             int             // Number of rules
+	nruleWithAction   int             // Number of rules with actions
+	nsymbol           int             // Number of terminal and nonterminal symbols
+	nterminal         int             // Number of terminal symbols
+	minShiftReduce    int             // Minimum shift-reduce action value
+	errAction         int             // Error action value
+	accAction         int             // Accept action value
+	noAction          int             // No-op action value
+	minReduce         int             // Minimum reduce action
+	maxAction         int             // Maximum action value of any kind
+	symbols           []*symbol       // Sorted array of pointers to symbols
+	errorcnt          int             // Number of errors
+	errsym            *symbol         // The error symbol
+	wildcard          *symbol         // Token that matches anything
+	name              string          // Name of the generated parser
+	arg               string          // Declaration of the 3th argument to parser
+	ctx               string          // Declaration of 2nd argument to constructor
+	tokentype         string          // Type of terminal symbols in the parser stack
+	vartype           string          // The default type of non-terminal symbols
+	loctype           string          // The type of the location of each symbol, from %location_type
+	patterns          []*lexPattern   // The patterns of the lexer, in the order they were declared
+	lexer             *lexer          // The lexer built from the patterns, or nil
+	starts            []string        // Names of the start symbols, one for each %start_symbol
+	entries           []*entryPoint   // The start symbols and their start states
+	templates         []*ruleTemplate // The templates, in the order they are declared
+	stacksize         string          // Size of the parser stack
+	expect            string          // Number of shift/reduce conflicts declared by %expect
+	expectRR          string          // Number of reduce/reduce conflicts declared by %expect_rr
+	expectLineno      int             // Line number of the %expect declaration
+	expectRRLineno    int             // Line number of the %expect_rr declaration
+	include           string          // Code to put at the start of the C file
+	error             string          // Code to execute when an error is seen
+	overflow          string          // Code to execute on a stack overflow
+	failure           string          // Code to execute on parser failure
+	accept            string          // Code to execute when the parser excepts
+	extracode         string          // Code appended to the generated file
+	tokendest         string          // Code to execute to destroy token data
+	vardest           string          // Code for the default non-terminal destructor
+	filename          string          // Name of the input file
+	includeDirs       includePath     // Directories searched for %include_grammar files (-I)
+	outname           string          // Name of the current output file
+	tokenprefix       string          // A prefix added to token names in the .h file
+	nconflict         int             // Number of parsing conflicts
+	nsrconflict       int             // Number of shift/reduce conflicts that were not resolved
+	nrrconflict       int             // Number of reduce/reduce conflicts that were not resolved
+	nwarning          int             // Number of warnings
+	warnings          *warningFlags   // Warning categories that are enabled or are errors
+	nactiontab        int             // Number of entries in the yy_action[] table
+	nlookaheadtab     int             // Number of entries in yy_lookahead[]
+	tablesize         int             // Total table size of all tables in bytes
+	basisflag         bool            // Print only basis configurations
+	printPreprocessed bool            // Show preprocessor output on stdout
+	has_fallback      bool            // True if any %fallback is seen in the grammar
+	nolinenosflag     bool            // True if #line statements should not be printed
+	argv0             string          // Name of the program
 }
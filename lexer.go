@@ -0,0 +1,521 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// A grammar may describe its tokens as well as its rules. The declaration
+//
+//	%token_pattern ID "[A-Za-z_][A-Za-z0-9_]*"
+//
+// gives a terminal a regular expression, in the syntax of Go's regexp
+// package, and
+//
+//	%skip_pattern "[ \t\r\n]+"
+//	%skip_pattern "//[^\n]*"
+//
+// describes the text that is skipped between tokens, like white space and
+// comments. The spelling of a token, like %token PLUS "+", matches itself.
+// A pattern is written in quotes, which can't be escaped, so a quote in a
+// pattern is written as \x22. A terminal may have more than one pattern.
+//
+// With -lexer, lemon writes a lexer in Go to the *_lexer.go file. The lexer
+// runs a DFA that is built from all of the patterns. At each point in the
+// input it takes the longest text that any pattern matches, and when more
+// than one pattern matches that text, the one declared first wins. Keywords
+// are declared before the pattern for identifiers:
+//
+//	%token IF "if" ELSE "else".
+//	%token_pattern ID "[a-z]+"
+
+// lexPattern is a pattern of the lexer.
+type lexPattern struct {
+	sp      *symbol        // the terminal that the pattern matches, or nil for %skip_pattern
+	text    string         // the pattern as it is written, in quotes
+	literal bool           // true for the spelling of a token from %token
+	lineno  int            // where the pattern is declared
+	re      *syntax.Regexp // the parsed pattern
+}
+
+// owner returns what the pattern is for, for messages.
+func (pp *lexPattern) owner() string {
+	if pp.sp == nil {
+		return "%skip_pattern"
+	}
+	return fmt.Sprintf("%q", pp.sp.name)
+}
+
+// unsupportedOps are the parts of a regular expression that need to look
+// outside the text being matched, which the lexer can't do.
+var unsupportedOps = map[syntax.Op]string{
+	syntax.OpBeginLine:      "^",
+	syntax.OpEndLine:        "$",
+	syntax.OpBeginText:      `\A`,
+	syntax.OpEndText:        `\z`,
+	syntax.OpWordBoundary:   `\b`,
+	syntax.OpNoWordBoundary: `\B`,
+}
+
+// addPattern adds a pattern for a terminal, or a %skip_pattern when sp is
+// nil. The text is in quotes. A literal matches its text exactly.
+func (psp *pstate) addPattern(sp *symbol, text string, literal bool) {
+	pp := &lexPattern{sp: sp, text: text, literal: literal, lineno: psp.tokenlineno}
+	body := strings.TrimSuffix(strings.TrimPrefix(text, `"`), `"`)
+	if literal {
+		body = regexp.QuoteMeta(body)
+	}
+	re, err := syntax.Parse(body, syntax.Perl)
+	if err != nil {
+		ErrorMsg(psp.filename, psp.tokenlineno, "the pattern %s of %s is not a regular expression: %v.", text, pp.owner(), err)
+		psp.errorcnt++
+		return
+	}
+	pp.re = re.Simplify()
+	if op := findUnsupportedOp(pp.re); op != "" {
+		ErrorMsg(psp.filename, psp.tokenlineno, "the lexer can't match %q in the pattern %s of %s.", op, text, pp.owner())
+		psp.errorcnt++
+		return
+	} else if matchesEmpty(pp.re) {
+		ErrorMsg(psp.filename, psp.tokenlineno, "the pattern %s of %s matches the empty string.", text, pp.owner())
+		psp.errorcnt++
+		return
+	}
+	psp.gp.patterns = append(psp.gp.patterns, pp)
+}
+
+// findUnsupportedOp returns the first part of the regular expression that
+// the lexer can't match, or "" if it can match all of it.
+func findUnsupportedOp(re *syntax.Regexp) string {
+	if op, ok := unsupportedOps[re.Op]; ok {
+		return op
+	}
+	for _, sub := range re.Sub {
+		if op := findUnsupportedOp(sub); op != "" {
+			return op
+		}
+	}
+	return ""
+}
+
+// matchesEmpty returns true if the regular expression matches the empty
+// string.
+func matchesEmpty(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpStar, syntax.OpQuest:
+		return true
+	case syntax.OpLiteral:
+		return len(re.Rune) == 0
+	case syntax.OpCapture, syntax.OpPlus:
+		return matchesEmpty(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min == 0 || matchesEmpty(re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !matchesEmpty(sub) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if matchesEmpty(sub) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// lexNFA is the nondeterministic automaton for the patterns.
+type lexNFA struct {
+	states []lexNFAState
+}
+
+// lexNFAState is a state of the NFA. A state that reads a rune has a
+// single transition, on the runes in the ranges, to next.
+type lexNFAState struct {
+	eps    []int  // the states that are reached without reading a rune
+	ranges []rune // pairs of the first and last runes of each range
+	next   int    // the state after reading a rune in the ranges
+	accept int    // the index of the pattern that is matched here, or -1
+}
+
+// add adds a state and returns its index.
+func (n *lexNFA) add() int {
+	n.states = append(n.states, lexNFAState{next: -1, accept: -1})
+	return len(n.states) - 1
+}
+
+// read adds the states that read a rune in the ranges, reached from start,
+// and returns the state after the rune.
+func (n *lexNFA) read(start int, ranges []rune) int {
+	s, end := n.add(), n.add()
+	n.states[start].eps = append(n.states[start].eps, s)
+	n.states[s].ranges, n.states[s].next = ranges, end
+	return end
+}
+
+// compile adds the states that match the regular expression, reached from
+// start, and returns the state at the end of the match.
+func (n *lexNFA) compile(re *syntax.Regexp, start int) int {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return n.add()
+	case syntax.OpEmptyMatch:
+		return start
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			ranges := []rune{r, r}
+			if re.Flags&syntax.FoldCase != 0 {
+				for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+					ranges = append(ranges, f, f)
+				}
+			}
+			start = n.read(start, ranges)
+		}
+		return start
+	case syntax.OpCharClass:
+		return n.read(start, re.Rune)
+	case syntax.OpAnyCharNotNL:
+		return n.read(start, []rune{0, '\n' - 1, '\n' + 1, unicode.MaxRune})
+	case syntax.OpAnyChar:
+		return n.read(start, []rune{0, unicode.MaxRune})
+	case syntax.OpCapture:
+		return n.compile(re.Sub[0], start)
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			start = n.compile(sub, start)
+		}
+		return start
+	case syntax.OpAlternate:
+		end := n.add()
+		for _, sub := range re.Sub {
+			e := n.compile(sub, start)
+			n.states[e].eps = append(n.states[e].eps, end)
+		}
+		return end
+	case syntax.OpStar, syntax.OpPlus:
+		loop, end := n.add(), n.add()
+		n.states[start].eps = append(n.states[start].eps, loop)
+		e := n.compile(re.Sub[0], loop)
+		n.states[e].eps = append(n.states[e].eps, loop, end)
+		if re.Op == syntax.OpStar {
+			n.states[loop].eps = append(n.states[loop].eps, end)
+		}
+		return end
+	case syntax.OpQuest:
+		end := n.add()
+		e := n.compile(re.Sub[0], start)
+		n.states[e].eps = append(n.states[e].eps, end)
+		n.states[start].eps = append(n.states[start].eps, end)
+		return end
+	}
+	panic(fmt.Sprintf("assert(op %v is simplified away)", re.Op))
+}
+
+// closure returns the states reached from the set without reading a rune,
+// sorted.
+func (n *lexNFA) closure(set []int) []int {
+	seen := make(map[int]bool)
+	stack := append([]int{}, set...)
+	for len(stack) != 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		stack = append(stack, n.states[s].eps...)
+	}
+	closure := make([]int, 0, len(seen))
+	for s := range seen {
+		closure = append(closure, s)
+	}
+	sort.Ints(closure)
+	return closure
+}
+
+// lexer is the DFA for the patterns of a grammar.
+type lexer struct {
+	patterns []*lexPattern
+	states   []*lexState // the start state is first
+}
+
+// lexState is a state of the DFA.
+type lexState struct {
+	edges   []lexEdge // the transitions, sorted by rune
+	accept  int       // the index of the pattern that is matched here, or -1
+	accepts []int     // the indexes of all of the patterns that match here
+}
+
+// lexEdge is a transition of the DFA on the runes from lo to hi.
+type lexEdge struct {
+	lo, hi rune
+	next   int
+}
+
+// newLexer builds the DFA for the patterns by the subset construction.
+func newLexer(patterns []*lexPattern) *lexer {
+	nfa := &lexNFA{}
+	root := nfa.add()
+	for i, pp := range patterns {
+		start := nfa.add()
+		nfa.states[root].eps = append(nfa.states[root].eps, start)
+		nfa.states[nfa.compile(pp.re, start)].accept = i
+	}
+
+	lx := &lexer{patterns: patterns}
+	var sets [][]int
+	index := make(map[string]int)
+	stateOf := func(set []int) int {
+		key := fmt.Sprint(set)
+		if i, ok := index[key]; ok {
+			return i
+		}
+		ds := &lexState{accept: -1}
+		for _, s := range set {
+			if i := nfa.states[s].accept; i != -1 {
+				ds.accepts = append(ds.accepts, i)
+				if ds.accept == -1 || i < ds.accept {
+					ds.accept = i
+				}
+			}
+		}
+		sort.Ints(ds.accepts)
+		index[key] = len(lx.states)
+		lx.states, sets = append(lx.states, ds), append(sets, set)
+		return index[key]
+	}
+	stateOf(nfa.closure([]int{root}))
+	for i := 0; i < len(lx.states); i++ {
+		// split the runes at the start and after the end of every range so
+		// that each piece leads to a single set of states.
+		var points []rune
+		for _, s := range sets[i] {
+			ranges := nfa.states[s].ranges
+			for j := 0; j < len(ranges); j += 2 {
+				points = append(points, ranges[j], ranges[j+1]+1)
+			}
+		}
+		sort.Slice(points, func(a, b int) bool { return points[a] < points[b] })
+		for j := 0; j+1 < len(points); j++ {
+			lo, hi := points[j], points[j+1]-1
+			if hi < lo {
+				continue
+			}
+			var next []int
+			for _, s := range sets[i] {
+				ranges := nfa.states[s].ranges
+				for k := 0; k < len(ranges); k += 2 {
+					if ranges[k] <= lo && hi <= ranges[k+1] {
+						next = append(next, nfa.states[s].next)
+						break
+					}
+				}
+			}
+			if len(next) == 0 {
+				continue
+			}
+			target := stateOf(nfa.closure(next))
+			ds := lx.states[i]
+			if n := len(ds.edges); n != 0 && ds.edges[n-1].next == target && ds.edges[n-1].hi+1 == lo {
+				ds.edges[n-1].hi = hi
+			} else {
+				ds.edges = append(ds.edges, lexEdge{lo: lo, hi: hi, next: target})
+			}
+		}
+	}
+	return lx
+}
+
+// FindLexer builds the lexer for the patterns of the grammar. When the
+// grammar declares a %token_pattern or %skip_pattern, it warns about the
+// terminals that have no pattern and about the patterns that never win.
+func FindLexer(lemp *lemon) {
+	lemp.lexer = nil
+	if len(lemp.patterns) == 0 {
+		return
+	}
+	lemp.lexer = newLexer(lemp.patterns)
+	explicit := false
+	for _, pp := range lemp.patterns {
+		explicit = explicit || !pp.literal
+	}
+	if !explicit {
+		return
+	}
+
+	hasPattern := make(map[*symbol]bool)
+	for _, pp := range lemp.patterns {
+		hasPattern[pp.sp] = true
+	}
+	for i := 1; i < lemp.nterminal; i++ {
+		sp := lemp.symbols[i]
+		if !hasPattern[sp] && !sp.filler && sp != lemp.wildcard {
+			lemp.warningMsg(LEXER, lemp.filename, sp.lineno, "Token \"%s\" has no pattern, so the lexer never returns it.", sp.name)
+		}
+	}
+
+	// a pattern that never wins is shadowed by one declared before it
+	wins := make(map[int]bool)
+	for _, ds := range lemp.lexer.states {
+		if ds.accept != -1 {
+			wins[ds.accept] = true
+		}
+	}
+	for i, pp := range lemp.patterns {
+		if wins[i] {
+			continue
+		}
+		for _, ds := range lemp.lexer.states {
+			if ds.accept == -1 || !intIn(i, ds.accepts) {
+				continue
+			}
+			winner := lemp.patterns[ds.accept]
+			lemp.warningMsg(LEXER, lemp.filename, pp.lineno, "The pattern %s of %s never matches; the pattern %s of %s on %s matches the same text first.", pp.text, pp.owner(), winner.text, winner.owner(), sourceLine(lemp.filename, winner.lineno))
+			break
+		}
+	}
+}
+
+// intIn returns true if n is in the list.
+func intIn(n int, list []int) bool {
+	for _, i := range list {
+		if i == n {
+			return true
+		}
+	}
+	return false
+}
+
+// runeText returns a rune as a Go constant.
+func runeText(r rune) string {
+	if unicode.IsPrint(r) || strings.ContainsRune("\a\b\f\n\r\t\v", r) {
+		return fmt.Sprintf("%q", r)
+	}
+	return fmt.Sprintf("0x%x", r)
+}
+
+// ReportLexer writes the lexer for the grammar as a Go source file in the
+// package.
+func ReportLexer(w io.Writer, lemp *lemon, pkg string) error {
+	if lemp.lexer == nil {
+		return fmt.Errorf("%s: the grammar has no token patterns", lemp.filename)
+	}
+	grammar := filepath.Base(lemp.filename)
+	typeName := "Lexer"
+	if lemp.name != "" {
+		typeName = lemp.name + "Lexer"
+	}
+	prefix := strings.ToLower(typeName[:1]) + typeName[1:]
+
+	b := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(b, "// Code generated by lemon from %s. DO NOT EDIT.\n\n", grammar)
+	_, _ = fmt.Fprintf(b, "package %s\n\n", pkg)
+	_, _ = fmt.Fprintf(b, "import \"unicode/utf8\"\n\n")
+
+	_, _ = fmt.Fprintf(b, "// The tokens of %s. The lexer returns 0 at the end of the input.\n", grammar)
+	_, _ = fmt.Fprintf(b, "const (\n")
+	for i := 1; i < lemp.nterminal; i++ {
+		if sp := lemp.symbols[i]; !sp.filler {
+			_, _ = fmt.Fprintf(b, "%s%s = %d\n", lemp.tokenprefix, sp.name, sp.index)
+		}
+	}
+	_, _ = fmt.Fprintf(b, ")\n\n")
+
+	_, _ = fmt.Fprintf(b, "// %s splits its input into the tokens of %s.\n", typeName, grammar)
+	_, _ = fmt.Fprintf(b, "// At each point it takes the longest text that a pattern matches, using\n")
+	_, _ = fmt.Fprintf(b, "// the pattern declared first when more than one matches. The text of a\n")
+	_, _ = fmt.Fprintf(b, "// %%skip_pattern is skipped.\n")
+	_, _ = fmt.Fprintf(b, "type %s struct {\ninput []byte\npos int\n}\n\n", typeName)
+	_, _ = fmt.Fprintf(b, "// New%s returns a lexer for the input.\n", typeName)
+	_, _ = fmt.Fprintf(b, "func New%s(input []byte) *%s {\nreturn &%s{input: input}\n}\n\n", typeName, typeName, typeName)
+	_, _ = fmt.Fprintf(b, "// Next returns the next token, its text and the offset of the text in\n")
+	_, _ = fmt.Fprintf(b, "// the input. At the end of the input the token is 0. When no pattern\n")
+	_, _ = fmt.Fprintf(b, "// matches, the token is -1 and the text is the rune that can't be matched.\n")
+	_, _ = fmt.Fprintf(b, `func (lx *%[1]s) Next() (token int, text []byte, offset int) {
+	for lx.pos < len(lx.input) {
+		start, state := lx.pos, 0
+		match, end := 0, start
+		for pos := start; pos < len(lx.input); {
+			r, size := utf8.DecodeRune(lx.input[pos:])
+			next := -1
+			for _, t := range %[2]sTrans[state] {
+				if r < t.lo {
+					break
+				} else if r <= t.hi {
+					next = t.next
+					break
+				}
+			}
+			if next == -1 {
+				break
+			}
+			state, pos = next, pos+size
+			if %[2]sAccept[state] != 0 {
+				match, end = %[2]sAccept[state], pos
+			}
+		}
+		if match == 0 {
+			_, size := utf8.DecodeRune(lx.input[start:])
+			lx.pos = start + size
+			return -1, lx.input[start:lx.pos], start
+		}
+		lx.pos = end
+		if match != -1 {
+			return match, lx.input[start:end], start
+		}
+	}
+	return 0, nil, lx.pos
+}
+
+`, typeName, prefix)
+
+	_, _ = fmt.Fprintf(b, "// %sRange is a transition of the DFA on the runes from lo to hi.\n", prefix)
+	_, _ = fmt.Fprintf(b, "type %sRange struct {\nlo, hi rune\nnext int\n}\n\n", prefix)
+	_, _ = fmt.Fprintf(b, "// %sTrans are the transitions from each state of the DFA, sorted by rune.\n", prefix)
+	_, _ = fmt.Fprintf(b, "var %sTrans = [...][]%sRange{\n", prefix, prefix)
+	for i, ds := range lemp.lexer.states {
+		var edges []string
+		for _, e := range ds.edges {
+			edges = append(edges, fmt.Sprintf("{%s, %s, %d}", runeText(e.lo), runeText(e.hi), e.next))
+		}
+		_, _ = fmt.Fprintf(b, "%d: {%s},\n", i, strings.Join(edges, ", "))
+	}
+	_, _ = fmt.Fprintf(b, "}\n\n")
+	_, _ = fmt.Fprintf(b, "// %sAccept is the token that is matched in each state of the DFA, or -1\n", prefix)
+	_, _ = fmt.Fprintf(b, "// for text that is skipped, or 0 if nothing is matched.\n")
+	_, _ = fmt.Fprintf(b, "var %sAccept = [...]int{\n", prefix)
+	for i, ds := range lemp.lexer.states {
+		token := 0
+		if ds.accept != -1 {
+			if sp := lemp.lexer.patterns[ds.accept].sp; sp != nil {
+				token = sp.index
+			} else {
+				token = -1
+			}
+		}
+		_, _ = fmt.Fprintf(b, "%d: %d,\n", i, token)
+	}
+	_, _ = fmt.Fprintf(b, "}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return fmt.Errorf("%s: lexer: %w", lemp.filename, err)
+	}
+	_, err = w.Write(src)
+	return err
+}
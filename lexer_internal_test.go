@@ -0,0 +1,185 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// lexTokens runs the DFA of the lexer over the input the way the generated
+// lexer does and returns each token as NAME:text. Skipped text is left out.
+func lexTokens(lx *lexer, input string) []string {
+	var tokens []string
+	for pos := 0; pos < len(input); {
+		state, match, end := 0, -1, pos
+		for p := pos; p < len(input); {
+			r, size := utf8.DecodeRuneInString(input[p:])
+			next := -1
+			for _, e := range lx.states[state].edges {
+				if e.lo <= r && r <= e.hi {
+					next = e.next
+					break
+				}
+			}
+			if next == -1 {
+				break
+			}
+			state, p = next, p+size
+			if lx.states[state].accept != -1 {
+				match, end = lx.states[state].accept, p
+			}
+		}
+		if match == -1 {
+			_, size := utf8.DecodeRuneInString(input[pos:])
+			tokens = append(tokens, "?:"+input[pos:pos+size])
+			pos += size
+			continue
+		}
+		if sp := lx.patterns[match].sp; sp != nil {
+			tokens = append(tokens, sp.name+":"+input[pos:end])
+		}
+		pos = end
+	}
+	return tokens
+}
+
+func TestLexer(t *testing.T) {
+	grammar := "%name Calc\n%token_prefix TK_\n" +
+		"%token PLUS \"+\" IF \"if\" EQ \"=\" EQEQ \"==\".\n" +
+		"%token_pattern KW \"(?i)begin\"\n" +
+		"%token_pattern ID \"[A-Za-z_][A-Za-z0-9_]*\"\n" +
+		"%token_pattern NUM \"[0-9]+(\\.[0-9]+)?\"\n" +
+		"%token_pattern STR \"\\x22[^\\x22]*\\x22\"\n" +
+		"%skip_pattern \"[ \\t\\n]+\"\n" +
+		"%skip_pattern \"//[^\\n]*\"\n" +
+		"prog ::= IF expr EQ expr.\nprog ::= expr EQEQ expr KW.\n" +
+		"expr ::= expr PLUS term.\nexpr ::= term.\nterm ::= ID.\nterm ::= NUM.\nterm ::= STR.\n"
+	type test_case struct {
+		id     int
+		input  string
+		expect string
+	}
+	lem := parseGrammar(t, grammar)
+	lem.warnings = newWarningFlags()
+	var got []string
+	msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+		got = append(got, fmt.Sprintf("%d: %s", lineno, msg))
+	}
+	analyzeGrammar(lem)
+	msgHook = nil
+	if len(got) != 0 || lem.lexer == nil {
+		t.Fatalf("lexer: want a lexer and no messages: got\n%s\n", strings.Join(got, "\n"))
+	}
+	for _, tc := range []test_case{
+		{id: 1, input: "if x = 1", expect: "IF:if ID:x EQ:= NUM:1"},
+		{id: 2, input: "iffy == 3.25", expect: "ID:iffy EQEQ:== NUM:3.25"},
+		{id: 3, input: "a+b // c + d\n+ \"e f\"", expect: "ID:a PLUS:+ ID:b PLUS:+ STR:\"e f\""},
+		{id: 4, input: "BeGiN begins", expect: "KW:BeGiN ID:begins"},
+		{id: 5, input: "x # é", expect: "ID:x ?:# ?:é"},
+		{id: 6, input: "3. ===", expect: "NUM:3 ?:. EQEQ:== EQ:="},
+	} {
+		if got := strings.Join(lexTokens(lem.lexer, tc.input), " "); got != tc.expect {
+			t.Errorf("%d: %q: want %s: got %s\n", tc.id, tc.input, tc.expect, got)
+		}
+	}
+
+	w := &bytes.Buffer{}
+	if err := ReportLexer(w, lem, "calc"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"package calc\n",
+		"\tTK_PLUS = 1\n",
+		"\tTK_KW   = 5\n",
+		"func NewCalcLexer(input []byte) *CalcLexer {",
+		"var calcLexerTrans = [...][]calcLexerRange{",
+	} {
+		if !strings.Contains(w.String(), want) {
+			t.Errorf("report: want %q in\n%s\n", want, w.String())
+		}
+	}
+
+	w.Reset()
+	Reprint(w, lem, false)
+	if want := "%token_pattern STR \"\\x22[^\\x22]*\\x22\"\n%skip_pattern \"[ \\t\\n]+\"\n"; !strings.Contains(w.String(), want) {
+		t.Errorf("reprint: want %q in\n%s\n", want, w.String())
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	type test_case struct {
+		id      int
+		grammar string
+		expect  []string
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			grammar: "%token_pattern ID \"[a-z\"\nprog ::= ID.\n",
+			expect:  []string{"1: error: the pattern \"[a-z\" of \"ID\" is not a regular expression: error parsing regexp: missing closing ]: `[a-z`."},
+		},
+		{id: 2,
+			grammar: "%token_pattern ID \"^[a-z]+\"\nprog ::= ID.\n",
+			expect:  []string{`1: error: the lexer can't match "\\A" in the pattern "^[a-z]+" of "ID".`},
+		},
+		{id: 3,
+			grammar: "%skip_pattern \"[ ]*\"\nprog ::= ID.\n",
+			expect:  []string{`1: error: the pattern "[ ]*" of %skip_pattern matches the empty string.`},
+		},
+		{id: 4,
+			grammar: "%token_pattern id \"[a-z]+\"\nprog ::= ID.\n",
+			expect:  []string{`1: error: %token_pattern needs the name of a token, not "id".`},
+		},
+		{id: 5,
+			grammar: "%token_pattern ID {[a-z]+}\n%skip_pattern ID\nprog ::= ID.\n",
+			expect: []string{
+				`1: error: the pattern of "ID" must be in quotes, not "{[a-z]+}".`,
+				`2: error: %skip_pattern needs a pattern in quotes, not "ID".`,
+			},
+		},
+		{id: 6,
+			grammar: "%token_pattern ID \"[a-z]+\"\n%token IF \"if\".\nprog ::= ID IF NUM.\n",
+			expect: []string{
+				`3: warning: Token "NUM" has no pattern, so the lexer never returns it. [-Wlexer]`,
+				`2: warning: The pattern "if" of "IF" never matches; the pattern "[a-z]+" of "ID" on line 1 matches the same text first. [-Wlexer]`,
+			},
+		},
+		{id: 7,
+			grammar: "%token IF \"if\".\n%wildcard ANY.\nprog ::= IF NUM ANY.\n",
+		},
+	} {
+		filename := filepath.Join(t.TempDir(), "test.y")
+		if err := os.WriteFile(filename, []byte(tc.grammar), 0644); err != nil {
+			t.Fatal(err)
+		}
+		Symbol_init()
+		State_init()
+		Symbol_new("$")
+		lem := &lemon{filename: filename, warnings: newWarningFlags()}
+		var got []string
+		msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+			kind := "error"
+			if isWarning {
+				kind = "warning"
+			}
+			got = append(got, fmt.Sprintf("%d: %s: %s", lineno, kind, msg))
+		}
+		Parse(lem, map[string]string{})
+		if lem.errorcnt == 0 {
+			if err := numberGrammar(lem); err != nil {
+				t.Fatal(err)
+			}
+			analyzeGrammar(lem)
+		}
+		msgHook = nil
+		if strings.Join(got, "\n") != strings.Join(tc.expect, "\n") {
+			t.Errorf("%d: want\n%s\n%d: got\n%s\n", tc.id, strings.Join(tc.expect, "\n"), tc.id, strings.Join(got, "\n"))
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+// this file contains the checks that are run over the symbol table and
+// the rules before the states are built. each problem is reported with the
+// line of the symbol or rule that causes it.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lint checks the grammar for symbols that are used but never defined,
+// defined but never used, joined in a class with terminals of other types,
+// can't derive a string of terminals, or can't be reached from the
+// start symbol.
+// A nonterminal without rules is an error, as is a start symbol that
+// can't derive a string of terminals. Everything else is a warning.
+func Lint(lemp *lemon) {
+	FindUndefinedSymbols(lemp)
+	FindNonProductiveSymbols(lemp)
+	FindUnusedSymbols(lemp)
+	FindTerminalTypes(lemp)
+	FindUnreachableSymbols(lemp)
+}
+
+// FindUndefinedSymbols reports nonterminals that are used on the
+// right-hand side of a rule but have no rules of their own.
+func FindUndefinedSymbols(lemp *lemon) {
+	for i := lemp.nterminal; i < lemp.nsymbol; i++ {
+		sp := lemp.symbols[i]
+		if sp.rule != nil || sp == lemp.errsym {
+			continue
+		}
+		// the line of the first rule that uses the symbol
+		lineno := 0
+		for rp := lemp.rule; rp != nil; rp = rp.next {
+			for _, rhs := range rp.rhs {
+				if rhs == sp && (lineno == 0 || rp.ruleline < lineno) {
+					lineno = rp.ruleline
+				}
+			}
+		}
+		if lineno != 0 {
+			ErrorMsg(lemp.filename, lineno, "Nonterminal \"%s\" is used but has no rules.", sp.name)
+			lemp.errorcnt++
+		}
+	}
+}
+
+// FindUnusedSymbols warns about symbols that aren't used by any rule.
+//
+// A token that falls back to another token is used even if it isn't in
+// a rule, since the parser will accept it in place of the other token.
+func FindUnusedSymbols(lemp *lemon) {
+	used := make(map[*symbol]bool)
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		used[rp.lhs] = true
+		if rp.precsym != nil {
+			used[rp.precsym] = true
+		}
+		for _, sp := range rp.rhs {
+			used[sp] = true
+			for _, subsym := range sp.subsym {
+				used[subsym] = true
+			}
+		}
+	}
+	for i := 1; i < lemp.nsymbol; i++ {
+		sp := lemp.symbols[i]
+		if used[sp] || sp == lemp.errsym || sp.fallback != nil || sp.filler || sp.vocabulary != "" {
+			continue
+		}
+		lemp.warningMsg(UNUSED_SYMBOL, lemp.filename, sp.lineno, "Symbol \"%s\" is not used by any rule.", sp.name)
+	}
+}
+
+// FindNonProductiveSymbols reports nonterminals that can't derive any
+// string made only of terminals, such as "a" in "a ::= a B." when "a" has no
+// other rule. Each symbol is reported with the chain of rules that traps it.
+//
+// A nonterminal is productive if one of its rules has only productive
+// symbols on the right-hand side; terminals are always productive. This is
+// repeated until no more productive symbols are found. Nonterminals without
+// rules are reported by FindUndefinedSymbols, so they are taken to be
+// productive here to keep from reporting every symbol that uses them.
+func FindNonProductiveSymbols(lemp *lemon) {
+	productive := make(map[*symbol]bool)
+	for i := 0; i < lemp.nsymbol; i++ {
+		if sp := lemp.symbols[i]; sp.type_ != NONTERMINAL || sp.rule == nil {
+			productive[sp] = true
+		}
+	}
+	isProductive := func(sp *symbol) bool {
+		return sp.type_ == MULTITERMINAL || productive[sp]
+	}
+	for progress := true; progress; {
+		progress = false
+		for rp := lemp.rule; rp != nil; rp = rp.next {
+			if productive[rp.lhs] {
+				continue
+			}
+			allProductive := true
+			for _, sp := range rp.rhs {
+				if !isProductive(sp) {
+					allProductive = false
+					break
+				}
+			}
+			if allProductive {
+				productive[rp.lhs], progress = true, true
+			}
+		}
+	}
+
+	starts := lemp.startSymbols()
+	for i := lemp.nterminal; i < lemp.nsymbol; i++ {
+		sp := lemp.symbols[i]
+		if isProductive(sp) {
+			continue
+		}
+		// follow the first rule of each symbol to a symbol that isn't
+		// productive until a symbol repeats. every rule of a symbol that
+		// isn't productive has such a symbol on its right-hand side.
+		var trap []string
+		seen := make(map[*symbol]bool)
+		for cur := sp; !seen[cur]; {
+			seen[cur] = true
+			rp := cur.firstRule()
+			sb := &strings.Builder{}
+			rp.print(sb)
+			trap = append(trap, fmt.Sprintf("%s. (%s)", sb.String(), sourceLine(lemp.filename, rp.ruleline)))
+			for _, rhs := range rp.rhs {
+				if !isProductive(rhs) {
+					cur = rhs
+					break
+				}
+			}
+		}
+		msg := fmt.Sprintf("Nonterminal \"%s\" can't derive a string of terminals; it is trapped by %s", sp.name, strings.Join(trap, " -> "))
+		if symbolIn(sp, starts) {
+			ErrorMsg(lemp.filename, sp.firstRule().ruleline, "%s. The parser can never accept its input.", msg)
+			lemp.errorcnt++
+		} else {
+			lemp.warningMsg(NON_PRODUCTIVE_SYMBOL, lemp.filename, sp.firstRule().ruleline, "%s", msg)
+		}
+	}
+}
+
+// FindTerminalTypes warns about token classes, and terminals joined with
+// "|" in a rule, whose terminals carry values of different types. A
+// terminal carries the %token_type unless it has a %type of its own, and
+// the code for the rule can't tell which of the types it was given.
+func FindTerminalTypes(lemp *lemon) {
+	valueType := func(sp *symbol) string {
+		if sp.datatype != "" {
+			return sp.datatype
+		}
+		return lemp.tokentype
+	}
+	check := func(sp *symbol, name string, lineno int) {
+		for _, subsym := range sp.subsym[1:] {
+			if valueType(subsym) != valueType(sp.subsym[0]) {
+				lemp.warningMsg(TERMINAL_TYPE, lemp.filename, lineno, "The terminals of \"%s\" carry different types: \"%s\" is %s and \"%s\" is %s.", name, sp.subsym[0].name, typeText(valueType(sp.subsym[0])), subsym.name, typeText(valueType(subsym)))
+				return
+			}
+		}
+	}
+	for _, sp := range lemp.symbols {
+		if sp.type_ == MULTITERMINAL {
+			check(sp, sp.name, sp.lineno)
+		}
+	}
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		for _, sp := range rp.rhs {
+			if sp.type_ == MULTITERMINAL && Symbol_find(sp.name) != sp {
+				check(sp, symbolText(sp), rp.ruleline)
+			}
+		}
+	}
+}
+
+// typeText returns a type for a message, without its braces.
+func typeText(datatype string) string {
+	if datatype == "" {
+		return "untyped"
+	}
+	return fmt.Sprintf("%q", jsonType(datatype))
+}
+
+// FindUnreachableSymbols warns about nonterminals that can't be derived
+// from a start symbol. Their rules are never used by the parser.
+// An EBNF helper is only unreachable when the nonterminal that uses it
+// is, and that nonterminal is reported instead.
+func FindUnreachableSymbols(lemp *lemon) {
+	starts := lemp.startSymbols()
+	reached := make(map[*symbol]bool)
+	for _, sp := range starts {
+		reached[sp] = true
+	}
+	for queue := starts; len(queue) != 0; queue = queue[1:] {
+		for rp := queue[0].rule; rp != nil; rp = rp.nextlhs {
+			for _, sp := range rp.rhs {
+				if sp.type_ == NONTERMINAL && !reached[sp] {
+					reached[sp] = true
+					queue = append(queue, sp)
+				}
+			}
+		}
+	}
+	for i := lemp.nterminal; i < lemp.nsymbol; i++ {
+		sp := lemp.symbols[i]
+		if reached[sp] || sp.rule == nil || sp.helper != "" {
+			continue
+		}
+		if len(starts) == 1 {
+			lemp.warningMsg(UNREACHABLE_SYMBOL, lemp.filename, sp.firstRule().ruleline, "Nonterminal \"%s\" can't be reached from the start symbol \"%s\".", sp.name, starts[0].name)
+		} else {
+			lemp.warningMsg(UNREACHABLE_SYMBOL, lemp.filename, sp.firstRule().ruleline, "Nonterminal \"%s\" can't be reached from any of the start symbols %s.", sp.name, lemp.startSymbolNames())
+		}
+	}
+}
+
+// firstRule returns the rule for a nonterminal that comes first in the input.
+func (sp *symbol) firstRule() *rule {
+	first := sp.rule
+	for rp := sp.rule; rp != nil; rp = rp.nextlhs {
+		if rp.ruleline < first.ruleline {
+			first = rp
+		}
+	}
+	return first
+}
@@ -0,0 +1,82 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	type test_case struct {
+		id      int
+		grammar string
+		expect  []string // "line: message" for each message from the lint pass
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			grammar: "prog ::= expr.\nexpr ::= NUM.\n",
+		},
+		{id: 2,
+			grammar: "prog ::= expr.\nexpr ::= term PLUS.\nexpr ::= NUM.\n",
+			expect:  []string{`2: error: Nonterminal "term" is used but has no rules.`},
+		},
+		{id: 3,
+			grammar: "%token NUM UNUSED.\nprog ::= NUM.\n",
+			expect:  []string{`1: warning: Symbol "UNUSED" is not used by any rule. [-Wunused-symbol]`},
+		},
+		{id: 4,
+			grammar: "%token_type {Token}\n%type NUM {int}\nprog ::= NUM|ID.\nprog ::= NUM.\n",
+			expect:  []string{`3: warning: The terminals of "NUM|ID" carry different types: "NUM" is "int" and "ID" is "Token". [-Wterminal-type]`},
+		},
+		{id: 5,
+			grammar: "prog ::= expr.\nexpr ::= NUM.\ndead ::= expr.\ndead ::= .\n",
+			expect:  []string{`3: warning: Nonterminal "dead" can't be reached from the start symbol "prog". [-Wunreachable-symbol]`},
+		},
+		{id: 6,
+			grammar: "%start_symbol other\nprog ::= expr.\nexpr ::= NUM.\nother ::= expr NUM.\n",
+			expect:  []string{`2: warning: Nonterminal "prog" can't be reached from the start symbol "other". [-Wunreachable-symbol]`},
+		},
+		{id: 7,
+			grammar: "prog ::= expr.\nprog ::= a.\nexpr ::= NUM.\na ::= b C.\nb ::= a D.\n",
+			expect: []string{
+				`4: warning: Nonterminal "a" can't derive a string of terminals; it is trapped by a ::= b C. (line 4) -> b ::= a D. (line 5) [-Wnon-productive-symbol]`,
+				`5: warning: Nonterminal "b" can't derive a string of terminals; it is trapped by b ::= a D. (line 5) -> a ::= b C. (line 4) [-Wnon-productive-symbol]`,
+			},
+		},
+		{id: 8,
+			grammar: "a ::= a B.\n",
+			expect:  []string{`1: error: Nonterminal "a" can't derive a string of terminals; it is trapped by a ::= a B. (line 1). The parser can never accept its input.`},
+		},
+		{id: 9,
+			grammar: "prog ::= list.\nlist ::= list ITEM.\nlist ::= .\n",
+		},
+		{id: 10,
+			grammar: "%type STR {char *}\n%token_class value NUM|STR.\nprog ::= value.\n",
+			expect:  []string{`2: warning: The terminals of "value" carry different types: "NUM" is untyped and "STR" is "char *". [-Wterminal-type]`},
+		},
+	} {
+		lem := parseGrammar(t, tc.grammar)
+		lem.warnings = newWarningFlags()
+		var got []string
+		msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+			kind := "error"
+			if isWarning {
+				kind = "warning"
+			}
+			got = append(got, fmt.Sprintf("%d: %s: %s", lineno, kind, msg))
+		}
+		FindRulePrecedences(lem.rule)
+		FindFirstSets(lem)
+		Lint(lem)
+		msgHook = nil
+		if strings.Join(got, "\n") != strings.Join(tc.expect, "\n") {
+			t.Errorf("%d: want\n%s\n%d: got\n%s\n", tc.id, strings.Join(tc.expect, "\n"), tc.id, strings.Join(got, "\n"))
+		}
+		if wantErrors := strings.Count(strings.Join(tc.expect, "\n"), ": error:"); lem.errorcnt != wantErrors {
+			t.Errorf("%d: errors: want %d: got %d\n", tc.id, wantErrors, lem.errorcnt)
+		}
+	}
+}
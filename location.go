@@ -0,0 +1,124 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// A grammar may declare a type for source locations:
+//
+//	%location_type {struct Span}
+//
+// The code for a rule can then use "@A" for the location of the symbol
+// with the alias A, on either side of the rule:
+//
+//	expr(A) ::= expr(B) PLUS expr(C). { A = add(B, C, @A); }
+//
+// The code of a mid-rule action can use the locations of the symbols to
+// its left. Each "@A" must name an alias of the rule. Without a
+// %location_type, an "@" in the code is left alone. The aliases whose
+// locations a rule uses are kept with the rule and written by -json.
+//
+// This program doesn't generate a parser, so nothing here keeps a location
+// with each entry on the parser stack or sets the location of the left-hand
+// side when a rule is reduced. That is left to a code generator, which gets
+// the type and the uses of the locations from the -json output.
+
+// locationRefs returns the aliases used as "@A" in a block of code. Strings,
+// character constants and comments are skipped.
+func locationRefs(code string) (refs []string) {
+	for i := 0; i < len(code); {
+		switch {
+		case code[i] == '"' || code[i] == '\'' || code[i] == '`':
+			quote := code[i]
+			for i++; i < len(code) && code[i] != quote; i++ {
+				if code[i] == '\\' && quote != '`' {
+					i++
+				}
+			}
+			i++
+		case strings.HasPrefix(code[i:], "//"):
+			if end := strings.IndexByte(code[i:], '\n'); end != -1 {
+				i += end
+			} else {
+				i = len(code)
+			}
+		case strings.HasPrefix(code[i:], "/*"):
+			if end := strings.Index(code[i+2:], "*/"); end != -1 {
+				i += end + 4
+			} else {
+				i = len(code)
+			}
+		case code[i] == '@' && i+1 < len(code) && (isalpha(code[i+1]) || code[i+1] == '_'):
+			j := i + 2
+			for j < len(code) && (isalnum(code[j]) || code[j] == '_') {
+				j++
+			}
+			refs = append(refs, code[i+1:j])
+			i = j
+		default:
+			i++
+		}
+	}
+	return refs
+}
+
+// checkLocations reports the "@A" in the code of each rule that doesn't
+// name an alias of the rule. The rules of a template are checked instead of
+// the rules of its instances. Without a %location_type, the code isn't
+// scanned at all, since an "@" may mean something else in the code, like
+// an Objective-C string or a tag in a comment.
+func (psp *pstate) checkLocations() {
+	if psp.gp.loctype == "" {
+		return
+	}
+	var rules []*rule
+	for rp := psp.firstrule; rp != nil; rp = rp.next {
+		rules = append(rules, rp)
+	}
+	var templates []*ruleTemplate
+	for _, t := range psp.templates {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].lineno < templates[j].lineno
+	})
+	for _, t := range templates {
+		rules = append(rules, t.rules...)
+	}
+	for _, rp := range rules {
+		rp.locations = nil
+		for _, name := range locationRefs(rp.code) {
+			if rp.hasAlias(name) {
+				rp.locations = append(rp.locations, name)
+			} else if rp.lhs.instance != "" {
+				// reported for the rule of the template
+			} else {
+				ErrorMsg(psp.filename, rp.line, "\"@%s\" doesn't name an alias of the rule.", name)
+				psp.errorcnt++
+			}
+		}
+	}
+}
+
+// hasAlias returns true if the alias names a symbol of the rule. A mid-rule
+// action has the aliases of the symbols to its left.
+func (rp *rule) hasAlias(name string) bool {
+	if name == rp.lhsalias {
+		return true
+	}
+	for _, alias := range rp.rhsalias {
+		if alias == name {
+			return true
+		}
+	}
+	for _, alias := range rp.contextAlias {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
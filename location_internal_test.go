@@ -0,0 +1,92 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocationRefs(t *testing.T) {
+	type test_case struct {
+		id     int
+		code   string
+		expect string
+	}
+	for _, tc := range []test_case{
+		{id: 1, code: " A = add(B, C, @A); }", expect: "A"},
+		{id: 2, code: " report(@B, \"at @C\"); /* @D */ // @E\n x = '@'; }", expect: "B"},
+		{id: 3, code: " A = B; }", expect: ""},
+		{id: 4, code: " span(@A, @_b2); }", expect: "A _b2"},
+	} {
+		if got := strings.Join(locationRefs(tc.code), " "); got != tc.expect {
+			t.Errorf("%d: want %q: got %q\n", tc.id, tc.expect, got)
+		}
+	}
+}
+
+func TestLocations(t *testing.T) {
+	type test_case struct {
+		id      int
+		grammar string
+		expect  []string // the messages, or the locations of each rule with code
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			grammar: "%location_type {struct Span}\nexpr(A) ::= expr(B) PLUS expr(C). { A = add(B, C); @A = span(@B, @C); }\nexpr ::= NUM.\n",
+			expect:  []string{"expr: A B C"},
+		},
+		{id: 2,
+			grammar: "%location_type {struct Span}\nblock ::= LB(L) { open(@L); } RB.\n",
+			expect:  []string{"mid_1: L"},
+		},
+		{id: 3,
+			grammar: "%location_type {struct Span}\nexpr(A) ::= expr(B) PLUS NUM. { A = B; @A = @N; }\nexpr ::= NUM.\n",
+			expect:  []string{`2: "@N" doesn't name an alias of the rule.`, "expr: A"},
+		},
+		{id: 4,
+			grammar: "expr(A) ::= NUM(B). { A = B; report(@B); }\n",
+			expect:  nil, // without a %location_type, "@B" is left alone
+		},
+		{id: 5,
+			grammar: "%location_type {struct Span}\nblock ::= LB { open(@R); } RB(R).\n",
+			expect:  []string{`2: "@R" doesn't name an alias of the rule.`},
+		},
+		{id: 6,
+			grammar: "%template opt X.\nopt(A) ::= X(B). { A = B; @A = @Y; }\nopt ::= .\nprog ::= opt(NUM) opt(ID).\n%location_type {struct Span}\n",
+			expect:  []string{`2: "@Y" doesn't name an alias of the rule.`, "opt_NUM: A", "opt_ID: A"},
+		},
+		{id: 7,
+			grammar: "expr(A) ::= NUM(B). { /* @param B */ A = [Num from:B name:@\"num\"]; @foo; }\n",
+		},
+	} {
+		filename := filepath.Join(t.TempDir(), "test.y")
+		if err := os.WriteFile(filename, []byte(tc.grammar), 0644); err != nil {
+			t.Fatal(err)
+		}
+		Symbol_init()
+		Symbol_new("$")
+		lem := &lemon{filename: filename}
+		var got []string
+		msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+			got = append(got, fmt.Sprintf("%d: %s", lineno, msg))
+		}
+		Parse(lem, map[string]string{})
+		msgHook = nil
+		if tc.expect == nil && lem.errorcnt != 0 {
+			t.Errorf("%d: errors: want 0: got %d\n", tc.id, lem.errorcnt)
+		}
+		for rp := lem.rule; rp != nil; rp = rp.next {
+			if len(rp.locations) != 0 {
+				got = append(got, fmt.Sprintf("%s: %s", rp.lhs.name, strings.Join(rp.locations, " ")))
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.expect, "\n") {
+			t.Errorf("%d: want\n%s\n%d: got\n%s\n", tc.id, strings.Join(tc.expect, "\n"), tc.id, strings.Join(got, "\n"))
+		}
+	}
+}
@@ -0,0 +1,605 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+// this file contains a language server for grammar files.
+// it speaks the Language Server Protocol over stdin and stdout.
+// the documents are re-parsed on every change to publish diagnostics;
+// navigation uses the tokens from astTokenize so that it keeps working
+// while the grammar has errors.
+//
+// positions are sent as byte offsets into the line. that is the same as
+// the UTF-16 offsets the protocol asks for as long as the grammar is ASCII.
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lspCommand implements "lemon lsp".
+// It returns the exit code for the program.
+func lspCommand(args []string) int {
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "usage: lemon lsp\n")
+		_, _ = fmt.Fprintf(fs.Output(), "Runs a language server for grammar files on stdin and stdout.\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	s := newLspServer(os.Stdin, os.Stdout)
+	if err := s.run(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "lsp: %v\n", err)
+		return 1
+	}
+	return s.exitCode
+}
+
+// The JSON-RPC error codes used by the server.
+const (
+	lspParseError     = -32700
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+)
+
+// The diagnostic severities.
+const (
+	lspSeverityError   = 1
+	lspSeverityWarning = 2
+)
+
+// The completion item kinds.
+const (
+	lspCompletionFunction = 3
+	lspCompletionKeyword  = 14
+	lspCompletionConstant = 21
+)
+
+type lspRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspTextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type lspTextDocumentPositionParams struct {
+	TextDocument lspTextDocumentIdentifier `json:"textDocument"`
+	Position     lspPosition               `json:"position"`
+}
+
+type lspCompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// lspSymbol is what the last successful analysis of a document knows about a symbol.
+type lspSymbol struct {
+	name     string
+	terminal bool
+	datatype string
+	prec     int
+	assoc    e_assoc
+	lambda   bool
+	first    []string
+	nrules   int
+}
+
+// lspDocument is a grammar file that is open in the editor.
+type lspDocument struct {
+	uri      string
+	filename string
+	text     []byte
+	tokens   []astToken            // nil if the text can't be tokenized
+	symbols  map[string]*lspSymbol // from the last analysis without errors
+}
+
+type lspServer struct {
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]*lspDocument
+	shutdown bool // true after the shutdown request
+	exitCode int
+}
+
+func newLspServer(in io.Reader, out io.Writer) *lspServer {
+	return &lspServer{
+		in:       bufio.NewReader(in),
+		out:      out,
+		docs:     make(map[string]*lspDocument),
+		exitCode: 1,
+	}
+}
+
+// run reads and handles messages until the exit notification or the end of the input.
+func (s *lspServer) run() error {
+	for {
+		body, err := s.read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var req lspRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.reply(nil, nil, &lspError{Code: lspParseError, Message: err.Error()})
+			continue
+		}
+		if req.Method == "exit" {
+			if s.shutdown {
+				s.exitCode = 0
+			}
+			return nil
+		}
+		s.handle(req)
+	}
+}
+
+// read returns the body of the next message.
+func (s *lspServer) read() ([]byte, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length == -1 {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// write sends a message to the client.
+func (s *lspServer) write(msg map[string]any) {
+	msg["jsonrpc"] = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		panic(fmt.Sprintf("lsp: marshal: %v", err))
+	}
+	_, _ = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// reply sends the response to a request.
+func (s *lspServer) reply(id json.RawMessage, result any, err *lspError) {
+	msg := map[string]any{"id": id}
+	if id == nil {
+		msg["id"] = nil
+	}
+	if err != nil {
+		msg["error"] = err
+	} else {
+		msg["result"] = result
+	}
+	s.write(msg)
+}
+
+// notify sends a notification to the client.
+func (s *lspServer) notify(method string, params any) {
+	s.write(map[string]any{"method": method, "params": params})
+}
+
+func (s *lspServer) handle(req lspRequest) {
+	isRequest := req.ID != nil
+	var result any
+	var err error
+	switch req.Method {
+	case "initialize":
+		result = map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":   1, // the full text is sent on every change
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"hoverProvider":      true,
+				"completionProvider": map[string]any{"triggerCharacters": []string{"%"}},
+			},
+			"serverInfo": map[string]any{"name": "lemon"},
+		}
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument   lspTextDocumentIdentifier `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err = json.Unmarshal(req.Params, &params); err == nil && len(params.ContentChanges) != 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument lspTextDocumentIdentifier `json:"textDocument"`
+		}
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			delete(s.docs, params.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics", map[string]any{"uri": params.TextDocument.URI, "diagnostics": []lspDiagnostic{}})
+		}
+	case "textDocument/definition", "textDocument/references", "textDocument/hover", "textDocument/completion":
+		var params lspTextDocumentPositionParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			doc := s.docs[params.TextDocument.URI]
+			if doc == nil {
+				break
+			}
+			switch req.Method {
+			case "textDocument/definition":
+				result = doc.definition(params.Position)
+			case "textDocument/references":
+				result = doc.references(params.Position)
+			case "textDocument/hover":
+				result = doc.hover(params.Position)
+			case "textDocument/completion":
+				result = doc.completion(params.Position)
+			}
+		}
+	default:
+		if isRequest {
+			s.reply(req.ID, nil, &lspError{Code: lspMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)})
+		}
+		return
+	}
+	if !isRequest {
+		return
+	} else if err != nil {
+		s.reply(req.ID, nil, &lspError{Code: lspInvalidParams, Message: err.Error()})
+		return
+	}
+	s.reply(req.ID, result, nil)
+}
+
+// update replaces the text of a document and publishes its diagnostics.
+func (s *lspServer) update(uri, text string) {
+	doc := s.docs[uri]
+	if doc == nil {
+		doc = &lspDocument{uri: uri, filename: uriToFilename(uri)}
+		s.docs[uri] = doc
+	}
+	doc.text = []byte(text)
+	doc.tokens, _ = astTokenize(doc.filename, doc.text)
+	diagnostics := doc.analyze()
+	s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diagnostics})
+}
+
+// uriToFilename returns the path for a "file:" URI.
+// Other URIs are returned unchanged.
+func uriToFilename(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
+	return uri
+}
+
+// analyze runs the document through the same steps as main and returns
+// the errors and warnings as diagnostics. If there are no errors, the
+// symbols of the document are updated from the analysis.
+func (doc *lspDocument) analyze() (diagnostics []lspDiagnostic) {
+	diagnostics = []lspDiagnostic{}
+	msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+		if filename != doc.filename {
+			return
+		}
+		severity := lspSeverityError
+		if isWarning {
+			severity = lspSeverityWarning
+		}
+		diagnostics = append(diagnostics, lspDiagnostic{Range: doc.lineRange(lineno), Severity: severity, Source: "lemon", Message: msg})
+	}
+	defer func() {
+		msgHook = nil
+		if r := recover(); r != nil {
+			diagnostics = append(diagnostics, lspDiagnostic{Range: doc.lineRange(0), Severity: lspSeverityError, Source: "lemon", Message: fmt.Sprintf("internal error: %v", r)})
+		}
+	}()
+
+	Symbol_init()
+	State_init()
+	Symbol_new("$")
+	lem := &lemon{filename: doc.filename, nolinenosflag: true, warnings: newWarningFlags()}
+	ParseInput(lem, doc.text, map[string]string{})
+	if lem.errorcnt != 0 {
+		return diagnostics
+	} else if lem.nrule == 0 {
+		ErrorMsg(lem.filename, 0, "grammar file contains no rules.")
+		return diagnostics
+	} else if err := numberGrammar(lem); err != nil {
+		ErrorMsg(lem.filename, 0, "%v", err)
+		return diagnostics
+	}
+	analyzeGrammar(lem)
+
+	doc.symbols = make(map[string]*lspSymbol)
+	for i := 1; i < lem.nsymbol; i++ {
+		sp := lem.symbols[i]
+		info := &lspSymbol{name: sp.name, terminal: sp.type_ == TERMINAL, datatype: sp.datatype, prec: sp.prec, assoc: sp.assoc, lambda: sp.lambda}
+		if sp.type_ == NONTERMINAL {
+			for j := 0; j < lem.nterminal; j++ {
+				if sp.firstset != nil && sp.firstset.Has(j) {
+					info.first = append(info.first, lem.symbols[j].name)
+				}
+			}
+			for rp := sp.rule; rp != nil; rp = rp.nextlhs {
+				info.nrules++
+			}
+		}
+		doc.symbols[sp.name] = info
+	}
+	return diagnostics
+}
+
+// lineRange returns the range that covers a line of the document.
+// Line numbers are 1-based; zero means the first line.
+func (doc *lspDocument) lineRange(lineno int) lspRange {
+	line := max(lineno-1, 0)
+	lines := strings.Split(string(doc.text), "\n")
+	width := 0
+	if line < len(lines) {
+		width = len(strings.TrimRight(lines[line], "\r"))
+	}
+	return lspRange{Start: lspPosition{Line: line}, End: lspPosition{Line: line, Character: width}}
+}
+
+// lspOccurrence is a place where a symbol appears in the document.
+type lspOccurrence struct {
+	name         string
+	tok          astToken
+	isDefinition bool // the LHS of a rule, or the declaration of a token
+}
+
+// occurrences returns every place a symbol appears in the document.
+// Declaration keywords, aliases, code and the arguments of declarations
+// like %name that don't take a symbol are skipped.
+func (doc *lspDocument) occurrences() (occurrences []lspOccurrence) {
+	text := func(i int) string {
+		if 0 <= i && i < len(doc.tokens) {
+			return doc.tokens[i].text
+		}
+		return ""
+	}
+	keyword := ""
+	for i, tok := range doc.tokens {
+		if tok.isComment() || tok.isCode() || isPreprocessorLine([]byte(tok.text)) {
+			continue
+		} else if tok.text == "." || tok.text == "::=" {
+			keyword = ""
+			continue
+		} else if text(i-1) == "%" {
+			keyword = tok.text
+			continue
+		}
+		name := strings.TrimLeft(tok.text, "|/")
+		if name == "" || !isalpha(name[0]) {
+			continue
+		} else if text(i-1) == "(" && text(i+1) == ")" {
+			// an alias
+			continue
+		}
+		name = tok.text[len(tok.text)-len(name):]
+		occ := lspOccurrence{name: name, tok: tok}
+		occ.tok.col += len(tok.text) - len(name)
+		occ.tok.offset += len(tok.text) - len(name)
+		occ.tok.text = name
+		switch {
+		case text(i+1) == "::=" || (text(i+1) == "(" && text(i+3) == ")" && text(i+4) == "::="):
+			occ.isDefinition, keyword = true, ""
+		case keyword == "":
+			// a symbol in a rule
+		case declShapeOf(keyword) == declSingle && keyword != "start_symbol":
+			continue
+		case keyword == "token" || (keyword == "token_class" && text(i-2) == "%"):
+			occ.isDefinition = true
+		}
+		occurrences = append(occurrences, occ)
+	}
+	return occurrences
+}
+
+// symbolAt returns the symbol at the position, if any.
+func (doc *lspDocument) symbolAt(pos lspPosition) (lspOccurrence, bool) {
+	for _, occ := range doc.occurrences() {
+		if occ.tok.line == pos.Line+1 && occ.tok.col-1 <= pos.Character && pos.Character <= occ.tok.col-1+len(occ.name) {
+			return occ, true
+		}
+	}
+	return lspOccurrence{}, false
+}
+
+// location returns the location of a token in the document.
+func (doc *lspDocument) location(tok astToken) lspLocation {
+	start := lspPosition{Line: tok.line - 1, Character: tok.col - 1}
+	end := lspPosition{Line: start.Line, Character: start.Character + len(tok.text)}
+	return lspLocation{URI: doc.uri, Range: lspRange{Start: start, End: end}}
+}
+
+// definition returns the rules for the nonterminal at the position,
+// or the declarations of the token at the position.
+func (doc *lspDocument) definition(pos lspPosition) []lspLocation {
+	locations := []lspLocation{}
+	target, ok := doc.symbolAt(pos)
+	if !ok {
+		return locations
+	}
+	for _, occ := range doc.occurrences() {
+		if occ.isDefinition && occ.name == target.name {
+			locations = append(locations, doc.location(occ.tok))
+		}
+	}
+	return locations
+}
+
+// references returns every use of the symbol at the position.
+func (doc *lspDocument) references(pos lspPosition) []lspLocation {
+	locations := []lspLocation{}
+	target, ok := doc.symbolAt(pos)
+	if !ok {
+		return locations
+	}
+	for _, occ := range doc.occurrences() {
+		if occ.name == target.name {
+			locations = append(locations, doc.location(occ.tok))
+		}
+	}
+	return locations
+}
+
+// hover describes the symbol at the position.
+// The description is empty until the grammar has been analyzed without errors.
+func (doc *lspDocument) hover(pos lspPosition) any {
+	target, ok := doc.symbolAt(pos)
+	if !ok {
+		return nil
+	}
+	info := doc.symbols[target.name]
+	if info == nil {
+		return nil
+	}
+	sb := &strings.Builder{}
+	if info.terminal {
+		_, _ = fmt.Fprintf(sb, "**%s** terminal\n\n", info.name)
+	} else {
+		_, _ = fmt.Fprintf(sb, "**%s** nonterminal, %d rules\n\n", info.name, info.nrules)
+	}
+	if info.datatype != "" {
+		_, _ = fmt.Fprintf(sb, "- type: `%s`\n", strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(info.datatype, "{"), "}")))
+	}
+	if info.prec >= 0 {
+		assoc := "nonassoc"
+		switch info.assoc {
+		case LEFT:
+			assoc = "left"
+		case RIGHT:
+			assoc = "right"
+		}
+		_, _ = fmt.Fprintf(sb, "- precedence: %d %s\n", info.prec, assoc)
+	}
+	if !info.terminal {
+		nullable := "no"
+		if info.lambda {
+			nullable = "yes"
+		}
+		_, _ = fmt.Fprintf(sb, "- nullable: %s\n", nullable)
+		_, _ = fmt.Fprintf(sb, "- first: %s\n", strings.Join(info.first, " "))
+	}
+	r := doc.location(target.tok).Range
+	return map[string]any{
+		"contents": map[string]any{"kind": "markdown", "value": sb.String()},
+		"range":    r,
+	}
+}
+
+// completion returns the declaration keywords after a "%" and the symbol
+// names everywhere else.
+func (doc *lspDocument) completion(pos lspPosition) []lspCompletionItem {
+	items := []lspCompletionItem{}
+	lines := strings.Split(string(doc.text), "\n")
+	if pos.Line >= len(lines) {
+		return items
+	}
+	line := lines[pos.Line]
+	end := min(pos.Character, len(line))
+	start := end
+	for start > 0 && (line[start-1] == '_' || isalnum(line[start-1])) {
+		start--
+	}
+	prefix := line[start:end]
+
+	if start > 0 && line[start-1] == '%' {
+		for _, keyword := range declKeywords() {
+			if strings.HasPrefix(keyword, prefix) {
+				items = append(items, lspCompletionItem{Label: keyword, Kind: lspCompletionKeyword})
+			}
+		}
+		return items
+	}
+
+	// the symbols from the last analysis, plus any typed since then
+	names := make(map[string]bool)
+	for name := range doc.symbols {
+		names[name] = true
+	}
+	for _, occ := range doc.occurrences() {
+		if !(occ.tok.line == pos.Line+1 && occ.tok.col-1 == start) {
+			names[occ.name] = true
+		}
+	}
+	var sorted []string
+	for name := range names {
+		if strings.HasPrefix(name, prefix) && name != prefix {
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		item := lspCompletionItem{Label: name, Kind: lspCompletionFunction, Detail: "nonterminal"}
+		if isupper(name[0]) {
+			item.Kind, item.Detail = lspCompletionConstant, "terminal"
+		}
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,151 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// lspSession runs the server over a list of messages and returns the messages it sent.
+func lspSession(t *testing.T, messages ...map[string]any) (replies []map[string]any) {
+	t.Helper()
+	in, out := &bytes.Buffer{}, &bytes.Buffer{}
+	for _, msg := range messages {
+		msg["jsonrpc"] = "2.0"
+		body, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = fmt.Fprintf(in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	s := newLspServer(in, out)
+	if err := s.run(); err != nil {
+		t.Fatalf("lsp: %v\n", err)
+	}
+	r := &lspServer{in: bufio.NewReader(out)}
+	for {
+		body, err := r.read()
+		if err != nil {
+			break
+		}
+		var reply map[string]any
+		if err := json.Unmarshal(body, &reply); err != nil {
+			t.Fatalf("lsp: reply: %v\n", err)
+		}
+		replies = append(replies, reply)
+	}
+	return replies
+}
+
+// lspResult returns the result of the reply to the request with the given id.
+func lspResult(t *testing.T, replies []map[string]any, id int) string {
+	t.Helper()
+	for _, reply := range replies {
+		if reply["id"] == float64(id) {
+			result, _ := json.Marshal(reply["result"])
+			return string(result)
+		}
+	}
+	t.Fatalf("lsp: no reply to request %d\n", id)
+	return ""
+}
+
+func TestLsp(t *testing.T) {
+	const uri = "file:///tmp/calc.y"
+	grammar := strings.Join([]string{
+		"%left PLUS.",              // 0
+		"%type expr {int}",         // 1
+		"prog ::= expr.",           // 2
+		"expr ::= expr PLUS expr.", // 3
+		"expr ::= .",               // 4
+		"expr(A) ::= NUM.",         // 5
+	}, "\n")
+	at := func(id int, method string, line, character int) map[string]any {
+		return map[string]any{"id": id, "method": method, "params": map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     map[string]any{"line": line, "character": character},
+		}}
+	}
+	replies := lspSession(t,
+		map[string]any{"id": 1, "method": "initialize", "params": map[string]any{}},
+		map[string]any{"method": "initialized", "params": map[string]any{}},
+		map[string]any{"method": "textDocument/didOpen", "params": map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": "lemon", "version": 1, "text": grammar},
+		}},
+		at(2, "textDocument/definition", 2, 10),
+		at(3, "textDocument/references", 3, 15),
+		at(4, "textDocument/hover", 2, 10),
+		at(5, "textDocument/completion", 5, 13),
+		at(9, "textDocument/hover", 0, 7),
+		map[string]any{"method": "textDocument/didChange", "params": map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": 2},
+			"contentChanges": []any{map[string]any{"text": grammar + "\n%tokn X.\n"}},
+		}},
+		map[string]any{"id": 6, "method": "textDocument/completion", "params": map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     map[string]any{"line": 6, "character": 4},
+		}},
+		map[string]any{"id": 7, "method": "bogus"},
+		map[string]any{"id": 8, "method": "shutdown"},
+		map[string]any{"method": "exit"},
+	)
+
+	if got := lspResult(t, replies, 1); !strings.Contains(got, `"definitionProvider":true`) {
+		t.Errorf("initialize: want capabilities: got %s\n", got)
+	}
+
+	var diagnostics []string
+	for _, reply := range replies {
+		if reply["method"] == "textDocument/publishDiagnostics" {
+			body, _ := json.Marshal(reply["params"])
+			diagnostics = append(diagnostics, string(body))
+		}
+	}
+	if len(diagnostics) != 2 {
+		t.Fatalf("diagnostics: want 2 notifications: got %d\n", len(diagnostics))
+	}
+	// the first version has an unused alias on line 5 (0-based)
+	if !strings.Contains(diagnostics[0], `"severity":2`) || !strings.Contains(diagnostics[0], `"start":{"character":0,"line":5}`) {
+		t.Errorf("diagnostics: want unused alias warning: got %s\n", diagnostics[0])
+	}
+	if !strings.Contains(diagnostics[1], `Did you mean \"%token\"?`) || !strings.Contains(diagnostics[1], `"severity":1`) {
+		t.Errorf("diagnostics: want unknown keyword error: got %s\n", diagnostics[1])
+	}
+
+	// the definition of "expr" is the LHS of its three rules
+	if got := lspResult(t, replies, 2); strings.Count(got, `"uri"`) != 3 || !strings.Contains(got, `"start":{"character":0,"line":3}`) {
+		t.Errorf("definition: want 3 rules: got %s\n", got)
+	}
+	// "PLUS" is used in the %left and in one rule
+	if got := lspResult(t, replies, 3); strings.Count(got, `"uri"`) != 2 {
+		t.Errorf("references: want 2: got %s\n", got)
+	}
+	if got := lspResult(t, replies, 4); !strings.Contains(got, "nonterminal, 3 rules") ||
+		!strings.Contains(got, "type: `int`") ||
+		!strings.Contains(got, "nullable: yes") ||
+		strings.Contains(got, "precedence") ||
+		!strings.Contains(got, "first: PLUS NUM") {
+		t.Errorf("hover: want expr: got %s\n", got)
+	}
+	if got := lspResult(t, replies, 9); !strings.Contains(got, "**PLUS** terminal") || !strings.Contains(got, "precedence: 1 left") {
+		t.Errorf("hover: want PLUS: got %s\n", got)
+	}
+	// "N" is the prefix at character 13 of line 5
+	if got := lspResult(t, replies, 5); !strings.Contains(got, `"label":"NUM"`) || strings.Contains(got, `"label":"expr"`) {
+		t.Errorf("completion: want NUM: got %s\n", got)
+	}
+	if got := lspResult(t, replies, 6); !strings.Contains(got, `"label":"token"`) || !strings.Contains(got, `"label":"token_class"`) || strings.Contains(got, `"label":"type"`) {
+		t.Errorf("completion: want keywords: got %s\n", got)
+	}
+	for _, reply := range replies {
+		if reply["id"] == float64(7) && reply["error"] == nil {
+			t.Errorf("bogus: want error: got %v\n", reply)
+		}
+	}
+}
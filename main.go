@@ -6,25 +6,50 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 )
 
 // parse the command line and do it...
 func main() {
+	// commands that don't generate a parser are dispatched before the flags are parsed
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fmt":
+			os.Exit(fmtCommand(os.Args[2:]))
+		case "lsp":
+			os.Exit(lspCommand(os.Args[2:]))
+		}
+	}
+
 	var compress bool
+	var dotFlag bool
+	var dotStates string
+	dotNear, dotRadius := -1, 1
+	var jsonFlag bool
+	var lexerFlag bool
+	lexerPackage := "main"
+	var htmlFlag bool
+	var railroad string
 	var mhflag bool
 	var noResort bool
 	var quiet bool
 	rpflag := false
+	var rpActions bool
 	var showPrecedenceConflict bool
+	var setsFlag bool
+	var setsSymbol string
 	var sqlFlag bool
+	statePath := -1
 	var statistics bool
+	var tokensFlag bool
 	var version bool
 
 	var macdefs macroSymbolTable = make(map[string]string)
 
 	lem := &lemon{
-		argv0: os.Args[0],
+		argv0:    os.Args[0],
+		warnings: newWarningFlags(),
 	}
 
 	flag.BoolVar(&lem.basisflag, "b", lem.basisflag, "Print only the basis in report.")
@@ -32,23 +57,39 @@ func main() {
 	flag.BoolVar(&lem.printPreprocessed, "E", lem.printPreprocessed, "Print input file after preprocessing.")
 
 	flag.BoolVar(&compress, "c", compress, "Don't compress the action table.")
+	flag.BoolVar(&dotFlag, "dot", dotFlag, "Write the automaton as a Graphviz DOT graph to the *.dot file.")
+	flag.StringVar(&dotStates, "dot-states", dotStates, "Only graph the states in the `list`, like \"1,4-7\". Implies -dot.")
+	flag.IntVar(&dotNear, "dot-near", dotNear, "Only graph the states near state `N`. Implies -dot.")
+	flag.IntVar(&dotRadius, "dot-radius", dotRadius, "The number of transitions that -dot-near reaches.")
 	flag.BoolVar(&rpflag, "g", rpflag, "Print grammar without actions.")
+	flag.BoolVar(&rpActions, "G", rpActions, "Print grammar with actions.")
+	flag.BoolVar(&htmlFlag, "html", htmlFlag, "Write the report as a web page to the *.html file.")
+	flag.BoolVar(&jsonFlag, "json", jsonFlag, "Write the symbols, rules and states to the *.json file.")
+	flag.BoolVar(&lexerFlag, "lexer", lexerFlag, "Write a lexer in Go for the token patterns to the *_lexer.go file.")
+	flag.StringVar(&lexerPackage, "lexer-package", lexerPackage, "The Go `package` of the lexer from -lexer.")
 	flag.BoolVar(&mhflag, "m", mhflag, "Output a makeheaders compatible file.")
 	flag.BoolVar(&showPrecedenceConflict, "p", showPrecedenceConflict, "Show conflicts resolved by precedence rules")
 	flag.BoolVar(&quiet, "q", quiet, "(Quiet) Don't print the report file.")
+	flag.StringVar(&railroad, "railroad", railroad, "Write railroad diagrams of the nonterminals to a web page (`format` \"html\") or to SVG files and a Markdown page (\"md\").")
 	flag.BoolVar(&noResort, "r", noResort, "Do not sort or renumber states.")
+	flag.BoolVar(&setsFlag, "sets", setsFlag, "Print the nullable flag and the first and follow sets of the nonterminals.")
+	flag.StringVar(&setsSymbol, "sets-symbol", setsSymbol, "Only print the sets for the nonterminal `name`. Implies -sets.")
 	flag.BoolVar(&statistics, "s", statistics, "Print parser stats to standard output.")
 	flag.BoolVar(&sqlFlag, "S", sqlFlag, "Generate the *.sql file describing the parser tables.")
+	flag.BoolVar(&tokensFlag, "tokens", tokensFlag, "Write the token vocabulary to the *.tokens file for %import_tokens.")
 	flag.BoolVar(&version, "x", version, "Print the version number.")
+	flag.IntVar(&statePath, "state-path", statePath, "Print the shortest input that reaches state `N`.")
 	flag.StringVar(&outputDir, "d", outputDir, "Output directory.")
 	flag.StringVar(&lem.filename, "i", lem.filename, "Grammar file to process.")
 	flag.StringVar(&user_templatename, "T", user_templatename, "Specify a template file.")
 	flag.Var(macdefs, "D", "Define macro.")
+	flag.Var(&lem.includeDirs, "I", "Search the `directory` for files named by %include_grammar. May be repeated.")
+	flag.Var(warningFlag{lem.warnings}, "W", "Enable (name) or disable (no-name) a category of warnings, or \"all\" or \"none\".")
+	flag.Var(werrorFlag{lem.warnings}, "Werror", "Treat warnings as errors; -Werror=name for a single category.")
 	//{type_: OPT_FSTR, label: "f", message: "Ignored.  (Placeholder for '-f' compiler options.)"},
-	//{type_: OPT_FSTR, label: "I", message: "Ignored.  (Placeholder for '-I' compiler options.)"},
 	//{type_: OPT_FSTR, label: "O", message: "Ignored.  (Placeholder for '-O' compiler options.)"},
-	//{type_: OPT_FSTR, label: "W", message: "Ignored.  (Placeholder for '-W' compiler options.)"},
-	flag.Parse()
+	// accept the "-Wname" spelling of the warning options
+	_ = flag.CommandLine.Parse(normalizeWarningArgs(os.Args[1:]))
 	if version {
 		fmt.Printf("Lemon version 1.0\n")
 		os.Exit(0)
@@ -83,9 +124,166 @@ func main() {
 		_, _ = fmt.Fprintf(os.Stderr, "error: grammar file contains no rules.\n")
 		os.Exit(1)
 	}
+	if err := numberGrammar(lem); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	/* Generate a reprint of the grammar, if requested on the command line */
+	if rpflag || rpActions {
+		Reprint(os.Stdout, lem, !rpActions)
+	} else {
+		// build the automaton and report the conflicts
+		analyzeGrammar(lem)
+
+		///* Compress the action tables */
+		//if (compress == 0) {
+		//	CompressTables(&lem);
+		//}
+		//
+		///* Reorder and renumber the states so that states with fewer choices
+		// ** occur at the end.  This is an optimization that helps make the
+		// ** generated parser tables smaller. */
+		//if (noResort == 0) {
+		//	ResortStates(&lem);
+		//}
+		//
+		///* Generate a report of the parser generated.  (the "y.output" file) */
+		//if (!quiet) {
+		//	ReportOutput(&lem);
+		//}
+		//
+		///* Generate the source code for the parser */
+		//ReportTable(&lem, mhflag, sqlFlag);
+		//
+		///* Produce a header file for use by the scanner.  (This step is
+		// ** omitted if the "-m" option is used because makeheaders will
+		// ** generate the file for us.) */
+		//if (!mhflag) {
+		//	ReportHeader(&lem);
+		//}
+
+		if lem.errorcnt != 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "error: %d errors.\n", lem.errorcnt)
+			os.Exit(1)
+		}
+
+		if dotFlag || dotStates != "" || dotNear >= 0 {
+			if err := writeDot(lem, dotStates, dotNear, dotRadius); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if htmlFlag {
+			if err := writeReport(lem, ".html", ReportHTML); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if railroad != "" {
+			var err error
+			switch railroad {
+			case "html":
+				err = writeReport(lem, ".railroad.html", ReportRailroadHTML)
+			case "md":
+				dir := file_makename(lem, ".railroad")
+				err = writeReport(lem, ".railroad.md", func(w io.Writer, lemp *lemon) error {
+					return ReportRailroadMarkdown(w, lemp, dir)
+				})
+			default:
+				err = fmt.Errorf("unknown railroad format %q (want html or md)", railroad)
+			}
+			if err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if jsonFlag {
+			if err := writeReport(lem, ".json", ReportJSON); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if lexerFlag {
+			err := writeReport(lem, "_lexer.go", func(w io.Writer, lemp *lemon) error {
+				return ReportLexer(w, lemp, lexerPackage)
+			})
+			if err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if tokensFlag {
+			if err := writeReport(lem, ".tokens", ReportTokens); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if setsFlag || setsSymbol != "" {
+			if err := ReportSets(os.Stdout, lem, setsSymbol); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if statePath >= 0 {
+			if err := ReportStatePath(os.Stdout, lem, statePath); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// analyzeGrammar computes the sets and states for a numbered grammar and
+// the actions for each state. The warnings for the grammar are reported here.
+func analyzeGrammar(lem *lemon) {
+	// Find the precedence for every production rule (that has one)
+	FindRulePrecedences(lem.rule)
+
+	// Compute the lambda-nonterminals and the first-sets for every nonterminal
+	FindFirstSets(lem)
+
+	FindMisspelledSymbols(lem)
+	Lint(lem)
+	FindUnusedAliases(lem)
+	FindLexer(lem)
+	if lem.errorcnt != 0 {
+		return
+	}
+
+	// Compute all LR(0) states.  Also record follow-set propagation
+	// links so that the follow-set can be computed later
+	lem.nstate = 0
+	FindStates(lem)
+	lem.sorted = State_arrayof()
+
+	// Tie up loose ends on the propagation links
+	FindLinks(lem)
+
+	// Compute the follow set of every reducible configuration
+	FindFollowSets(lem)
+
+	// Compute the action tables
+	FindActions(lem)
+
+	FindUselessPrecedence(lem)
+}
+
+// numberGrammar counts and indexes the symbols of the grammar and
+// assigns the rule numbers. It must be called after the grammar is
+// parsed and before any of the sets or states are computed.
+func numberGrammar(lem *lemon) error {
 	lem.errsym = Symbol_find("error")
 
 	// count and index the symbols of the grammar
+	numberTokens()
 	Symbol_new("{default}")
 	lem.nsymbol = Symbol_count()
 	lem.symbols = Symbol_sortedSlice()
@@ -95,8 +293,7 @@ func main() {
 		i--
 	}
 	if lem.symbols[i-1].name != "{default}" {
-		_, _ = fmt.Fprintf(os.Stderr, "error: internal error: want symbols[%d] to be %q, got %q\n", i-1, "{default}", lem.symbols[i-1].name)
-		os.Exit(1)
+		return fmt.Errorf("internal error: want symbols[%d] to be %q, got %q", i-1, "{default}", lem.symbols[i-1].name)
 	}
 	lem.nsymbol = i - 1
 	// count the number of terminal symbols and update the index
@@ -130,59 +327,50 @@ func main() {
 	lem.startRule = lem.rule
 	lem.rule = lem.rule.sort()
 
-	/* Generate a reprint of the grammar, if requested on the command line */
-	if rpflag {
-		Reprint(os.Stdout, lem)
-	} else {
-		///* Initialize the size for all follow and first sets */
-		//sets.SetSize(lem.nterminal + 1)
-
-		// Find the precedence for every production rule (that has one)
-		FindRulePrecedences(lem.rule)
+	return nil
+}
 
-		// Compute the lambda-nonterminals and the first-sets for every nonterminal
-		FindFirstSets(lem)
+// writeDot writes the automaton, or the states selected by the list or
+// the neighborhood of a state, to the *.dot file.
+func writeDot(lem *lemon, states string, near, radius int) error {
+	var filter dotFilter
+	var err error
+	if states != "" {
+		if filter, err = parseStateList(states); err != nil {
+			return err
+		}
+	}
+	if near >= 0 {
+		nearby, err := lem.nearFilter(near, radius)
+		if err != nil {
+			return err
+		}
+		if filter == nil {
+			filter = nearby
+		} else {
+			for n := range nearby {
+				filter[n] = true
+			}
+		}
+	}
+	fp, err := file_open(lem, ".dot")
+	if err != nil {
+		return err
+	}
+	ReportDot(fp, lem, filter)
+	return fp.Close()
+}
 
-		///* Compute all LR(0) states.  Also record follow-set propagation
-		// ** links so that the follow-set can be computed later */
-		//lem.nstate = 0;
-		//FindStates(&lem);
-		//lem.sorted = State_arrayof();
-		//
-		///* Tie up loose ends on the propagation links */
-		//FindLinks(&lem);
-		//
-		///* Compute the follow set of every reducible configuration */
-		//FindFollowSets(&lem);
-		//
-		///* Compute the action tables */
-		//FindActions(&lem);
-		//
-		///* Compress the action tables */
-		//if (compress == 0) {
-		//	CompressTables(&lem);
-		//}
-		//
-		///* Reorder and renumber the states so that states with fewer choices
-		// ** occur at the end.  This is an optimization that helps make the
-		// ** generated parser tables smaller. */
-		//if (noResort == 0) {
-		//	ResortStates(&lem);
-		//}
-		//
-		///* Generate a report of the parser generated.  (the "y.output" file) */
-		//if (!quiet) {
-		//	ReportOutput(&lem);
-		//}
-		//
-		///* Generate the source code for the parser */
-		//ReportTable(&lem, mhflag, sqlFlag);
-		//
-		///* Produce a header file for use by the scanner.  (This step is
-		// ** omitted if the "-m" option is used because makeheaders will
-		// ** generate the file for us.) */
-		//if (!mhflag) {
-		//	ReportHeader(&lem);
-		//}
+// writeReport creates the output file with the given suffix and writes
+// a report to it.
+func writeReport(lem *lemon, suffix string, report func(w io.Writer, lemp *lemon) error) error {
+	fp, err := file_open(lem, suffix)
+	if err != nil {
+		return err
+	}
+	if err := report(fp, lem); err != nil {
+		_ = fp.Close()
+		return err
 	}
+	return fp.Close()
 }
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"github.com/mdhender/lemon/internal/macros"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -18,33 +20,41 @@ import (
 //
 // symtab is a table of the macro names defined on the command line with -D.
 func Parse(gp *lemon, symtab map[string]string) {
-	ps := pstate{
-		//debug:    true,
-		gp:       gp,
-		filename: gp.filename,
-		state:    INITIALIZE,
-	}
-
 	/* Begin by reading the input file */
-	input, err := os.ReadFile(ps.filename)
+	input, err := os.ReadFile(gp.filename)
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "%s: can't open this file for reading.\n", ps.filename)
+		ErrorMsg(gp.filename, 0, "can't open this file for reading.")
 		gp.errorcnt++
 		return
 	} else if len(input) == 0 {
-		_, _ = fmt.Fprintf(os.Stderr, "%s: can't read in all %d bytes of this file.\n", ps.filename, len(input))
+		ErrorMsg(gp.filename, 0, "can't read in all %d bytes of this file.", len(input))
 		gp.errorcnt++
 		return
 	} else if len(input) > 100_000_000 {
-		_, _ = fmt.Fprintf(os.Stderr, "%s: input file too large.\n", ps.filename)
+		ErrorMsg(gp.filename, 0, "input file too large.")
 		gp.errorcnt++
 		return
 	}
+	ParseInput(gp, input, symtab)
+}
+
+// ParseInput scans the text of a grammar. It is Parse without the file
+// handling, which lets the language server parse the text in an editor.
+func ParseInput(gp *lemon, input []byte, symtab map[string]string) {
+	ps := pstate{
+		//debug:    true,
+		gp:       gp,
+		filename: gp.filename,
+		state:    INITIALIZE,
+		symtab:   symtab,
+		tested:   macros.Names(input),
+	}
+	sourceFiles = nil
 
 	// pre-process the input. this evaluates the macros to include and exclude text blocks.
-	input, err = macros.PreProcess(input, symtab)
+	input, err := macros.PreProcess(input, symtab)
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "%s: %v\n", ps.filename, err)
+		ErrorMsg(ps.filename, 0, "%v", err)
 		gp.errorcnt++
 		return
 	} else if gp.printPreprocessed {
@@ -52,75 +62,115 @@ func Parse(gp *lemon, symtab map[string]string) {
 		return
 	}
 
+	// scan the text of the input file and the files that it includes
+	ps.scan(gp.filename, input)
+
+	// warn about macros defined on the command line that the grammar never tests
+	var untested []string
+	for name := range symtab {
+		if !ps.tested[name] {
+			untested = append(untested, name)
+		}
+	}
+	sort.Strings(untested)
+	for _, name := range untested {
+		gp.warningMsg(PREPROCESSOR, ps.filename, 0, "Macro \"%s\" is defined but never tested.", name)
+	}
+
+	ps.addHelperRules()
+	ps.expandTemplates()
+	ps.typeHelpers()
+	ps.addEntryRules()
+	ps.checkLocations()
+	ps.checkVocabulary()
+	gp.rule = ps.firstrule
+	gp.errorcnt += ps.errorcnt
+}
+
+// scan passes each token of a pre-processed grammar file to parseSingleToken.
+// The lines of the file are numbered after the lines of the files that were
+// read before it. The tokens of an included file are passed while the token
+// that includes it is parsed.
+func (psp *pstate) scan(name string, input []byte) {
+	base := 0
+	if len(sourceFiles) != 0 {
+		last := sourceFiles[len(sourceFiles)-1]
+		base = last.base + last.lines
+	}
+	sourceFiles = append(sourceFiles, sourceFile{name: name, base: base, lines: bytes.Count(input, []byte{'\n'}) + 1})
+	psp.including = append(psp.including, name)
+	defer func() {
+		psp.including = psp.including[:len(psp.including)-1]
+	}()
+
 	/* Now scan the text of the input file */
-	pos, lineno, startline := 0, 1, 0
+	pos, lineno, startline, spaced := 0, base+1, 0, false
 	for pos < len(input) {
 		if input[pos] == '\n' {
 			lineno++ /* Keep track of the line number */
 		}
 		if isspace(input[pos]) { /* Skip all white space */
-			pos++
+			pos, spaced = pos+1, true
 			continue
 		} else if comments := scanCPPComment(input[pos:]); len(comments) != 0 { // skip c++ style comments
-			pos += len(comments)
+			pos, spaced = pos+len(comments), true
 			continue
 		} else if comments := scanCComment(input[pos:]); len(comments) != 0 { // skip c style comments
-			lineno = bytes.Count(comments, []byte{'\n'})
-			pos += len(comments)
+			lineno += bytes.Count(comments, []byte{'\n'})
+			pos, spaced = pos+len(comments), true
 			continue
 		}
 
 		tokenStart := pos                                              /* Mark the beginning of the token */
-		ps.tokenlineno = lineno                                        /* Line number on which token begins */
+		psp.tokenlineno = lineno                                       /* Line number on which token begins */
 		if literal := scanStringLiteral(input[pos:]); literal != nil { /* String literals */
 			lineno += bytes.Count(literal, []byte{'\n'})
 			pos += len(literal)
 			if len(literal) == 1 || literal[len(literal)-1] != '"' {
-				_, _ = fmt.Fprintf(os.Stderr, "%s:%d: string starting on this line is not terminated before the end of the file.\n", ps.filename, startline)
-				ps.errorcnt++
+				ErrorMsg(psp.filename, startline, "string starting on this line is not terminated before the end of the file.")
+				psp.errorcnt++
 			}
-			ps.tokenstart = literal
+			psp.tokenstart = literal
 		} else if codeBlock, err := scanCodeBlock(input[pos:]); codeBlock != nil { /* A block of C code */
 			lineno += bytes.Count(codeBlock, []byte{'\n'})
 			pos += len(codeBlock)
 			if err != nil {
-				_, _ = fmt.Fprintf(os.Stderr, "%s:%d: C code starting on this line: %v.\n", ps.filename, ps.tokenlineno, err)
-				ps.errorcnt++
+				ErrorMsg(psp.filename, psp.tokenlineno, "C code starting on this line: %v.", err)
+				psp.errorcnt++
 			} else if len(codeBlock) == 1 || codeBlock[len(codeBlock)-1] != '}' {
-				_, _ = fmt.Fprintf(os.Stderr, "%s:%d: C code starting on this line is not terminated before the end of the file.\n", ps.filename, ps.tokenlineno)
-				ps.errorcnt++
+				ErrorMsg(psp.filename, psp.tokenlineno, "C code starting on this line is not terminated before the end of the file.")
+				psp.errorcnt++
 			}
-			ps.tokenstart = codeBlock
+			psp.tokenstart = codeBlock
 		} else if isalnum(input[pos]) { /* Identifiers */
 			pos += 1
 			for pos < len(input) && (input[pos] == '_' || isalnum(input[pos])) {
 				pos++
 			}
-			ps.tokenstart = input[tokenStart:pos]
+			psp.tokenstart = input[tokenStart:pos]
 		} else if bytes.HasPrefix(input[pos:], []byte{':', ':', '='}) { /* The operator "::=" */
 			pos += 3
-			ps.tokenstart = input[tokenStart:pos]
+			psp.tokenstart = input[tokenStart:pos]
 		} else if len(input[pos:]) > 1 && input[pos] == '/' && isalpha(input[pos+1]) {
 			pos += 1
 			for pos < len(input) && (input[pos] == '_' || isalnum(input[pos])) {
 				pos++
 			}
-			ps.tokenstart = input[tokenStart:pos]
+			psp.tokenstart = input[tokenStart:pos]
 		} else if len(input[pos:]) > 1 && input[pos] == '|' && isalpha(input[pos+1]) {
 			pos += 1
 			for pos < len(input) && (input[pos] == '_' || isalnum(input[pos])) {
 				pos++
 			}
-			ps.tokenstart = input[tokenStart:pos]
+			psp.tokenstart = input[tokenStart:pos]
 		} else { // all other (one character) operators */
 			pos++
-			ps.tokenstart = input[tokenStart:pos]
+			psp.tokenstart = input[tokenStart:pos]
 		}
 		// and parse the token
-		parseSingleToken(&ps)
+		psp.spaced, spaced = spaced, false
+		parseSingleToken(psp)
 	}
-	gp.rule = ps.firstrule
-	gp.errorcnt = ps.errorcnt
 }
 
 // parse a single token
@@ -140,18 +190,38 @@ func parseSingleToken(psp *pstate) {
 	case WAITING_FOR_DECL_OR_RULE:
 		if x[0] == '%' {
 			psp.state = WAITING_FOR_DECL_KEYWORD
+		} else if psp.importing != "" {
+			ErrorMsg(psp.filename, psp.tokenlineno, "the token vocabulary %q can only declare tokens, not %q.", psp.importing, x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_RULE_ERROR
 		} else if isNonTerminalName(x) {
-			psp.lhs = Symbol_new(x)
+			psp.addHelperRules()
+			if psp.tmpl = psp.templates[x]; psp.tmpl != nil {
+				psp.lhs = psp.tmpl.lhs
+			} else {
+				psp.lhs = psp.symbolNew(x)
+			}
 			psp.nrhs = 0
 			psp.rhs = nil
+			psp.alias = nil
 			psp.lhsalias = ""
+			psp.groups = nil
+			psp.pending = nil
+			psp.callStack = nil
 			psp.state = WAITING_FOR_ARROW
+			if psp.lhs.helper != "" {
+				ErrorMsg(psp.filename, psp.tokenlineno, "%q is the name of the helper for %q; the nonterminal needs another name.", x, psp.lhs.helper)
+				psp.errorcnt++
+			} else if psp.lhs.instance != "" {
+				ErrorMsg(psp.filename, psp.tokenlineno, "%q is the name of the instance %q; the nonterminal needs another name.", x, psp.lhs.instance)
+				psp.errorcnt++
+			}
 		} else if x[0] == '{' {
 			if psp.prevrule == nil {
-				_, _ = fmt.Fprintf(os.Stderr, "%s:%d: there is no prior rule upon which to attach the code fragment which begins on this line.\n", psp.filename, psp.tokenlineno)
+				ErrorMsg(psp.filename, psp.tokenlineno, "there is no prior rule upon which to attach the code fragment which begins on this line.")
 				psp.errorcnt++
 			} else if len(psp.prevrule.code) != 0 {
-				_, _ = fmt.Fprintf(os.Stderr, "%s:%d: code fragment beginning on this line is not the first to follow the previous rule.\n", psp.filename, psp.tokenlineno)
+				ErrorMsg(psp.filename, psp.tokenlineno, "code fragment beginning on this line is not the first to follow the previous rule.")
 				psp.errorcnt++
 			} else if x == "{NEVER-REDUCE" {
 				psp.prevrule.neverReduce = true
@@ -163,28 +233,31 @@ func parseSingleToken(psp *pstate) {
 		} else if x[0] == '[' {
 			psp.state = PRECEDENCE_MARK_1
 		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: token %q should be either \"%%\" or a non-terminal name.\n", psp.filename, psp.tokenlineno, x)
+			ErrorMsg(psp.filename, psp.tokenlineno, "token %q should be either \"%%\" or a non-terminal name.", x)
 			psp.errorcnt++
 		}
 		break
 	case PRECEDENCE_MARK_1:
+		if x[0] == '"' && psp.spellings[x] != nil {
+			x = psp.spellings[x].name
+		}
 		if !isTerminalName(x) {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: the precedence symbol must be a terminal.\n", psp.filename, psp.tokenlineno)
+			ErrorMsg(psp.filename, psp.tokenlineno, "the precedence symbol must be a terminal.")
 			psp.errorcnt++
 		} else if psp.prevrule == nil {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: there is no prior rule to assign precedence \"[%s]\".\n", psp.filename, psp.tokenlineno, x)
+			ErrorMsg(psp.filename, psp.tokenlineno, "there is no prior rule to assign precedence \"[%s]\".", x)
 			psp.errorcnt++
 		} else if psp.prevrule.precsym != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: precedence mark on this line is not the first to follow the previous rule.\n", psp.filename, psp.tokenlineno)
+			ErrorMsg(psp.filename, psp.tokenlineno, "precedence mark on this line is not the first to follow the previous rule.")
 			psp.errorcnt++
 		} else {
-			psp.prevrule.precsym = Symbol_new(x)
+			psp.prevrule.precsym = psp.rhsSymbol(x)
 		}
 		psp.state = PRECEDENCE_MARK_2
 		break
 	case PRECEDENCE_MARK_2:
 		if x[0] != ']' {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: missing \"]\" on precedence mark.\n", psp.filename, psp.tokenlineno)
+			ErrorMsg(psp.filename, psp.tokenlineno, "missing \"]\" on precedence mark.")
 			psp.errorcnt++
 		}
 		psp.state = WAITING_FOR_DECL_OR_RULE
@@ -195,7 +268,7 @@ func parseSingleToken(psp *pstate) {
 		} else if x[0] == '(' {
 			psp.state = LHS_ALIAS_1
 		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: expected to see a \":\" following the LHS symbol %q.\n", psp.filename, psp.tokenlineno, psp.lhs.name)
+			ErrorMsg(psp.filename, psp.tokenlineno, "expected to see a \":\" following the LHS symbol %q.", psp.lhs.name)
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_RULE_ERROR
 		}
@@ -205,7 +278,7 @@ func parseSingleToken(psp *pstate) {
 			psp.lhsalias = x
 			psp.state = LHS_ALIAS_2
 		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: %q is not a valid alias for the LHS %q.\n", psp.filename, psp.tokenlineno, x, psp.lhs.name)
+			ErrorMsg(psp.filename, psp.tokenlineno, "%q is not a valid alias for the LHS %q.", x, psp.lhs.name)
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_RULE_ERROR
 		}
@@ -214,7 +287,7 @@ func parseSingleToken(psp *pstate) {
 		if x[0] == ')' {
 			psp.state = LHS_ALIAS_3
 		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: missing \")\" following LHS alias name %q.\n", psp.filename, psp.tokenlineno, psp.lhsalias)
+			ErrorMsg(psp.filename, psp.tokenlineno, "missing \")\" following LHS alias name %q.", psp.lhsalias)
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_RULE_ERROR
 		}
@@ -223,16 +296,32 @@ func parseSingleToken(psp *pstate) {
 		if x[0] == ':' && x[1] == ':' && x[2] == '=' {
 			psp.state = IN_RHS
 		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: missing \".\" following: \"%s(%s)\".\n", psp.filename, psp.tokenlineno, psp.lhs.name, psp.lhsalias)
+			ErrorMsg(psp.filename, psp.tokenlineno, "missing \".\" following: \"%s(%s)\".", psp.lhs.name, psp.lhsalias)
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_RULE_ERROR
 		}
 		break
 	case IN_RHS:
+		if x == "?" || x == "*" || x == "+" {
+			psp.quantify(x)
+			break
+		}
+		psp.flushPending()
 		if x[0] == '.' {
+			for len(psp.groups) != 0 {
+				g := psp.groups[len(psp.groups)-1]
+				closer := ")"
+				if g.optional {
+					closer = "]"
+				}
+				ErrorMsg(psp.filename, psp.tokenlineno, "missing %q to close the group that starts on %s.", closer, sourceLine(psp.filename, g.lineno))
+				psp.errorcnt++
+				psp.closeGroup()
+				psp.flushPending()
+			}
 			rp := &rule{}
 			if rp == nil {
-				_, _ = fmt.Fprintf(os.Stderr, "%s:%d: can't allocate enough memory for this rule.\n", psp.filename, psp.tokenlineno)
+				ErrorMsg(psp.filename, psp.tokenlineno, "can't allocate enough memory for this rule.")
 				psp.errorcnt++
 				psp.prevrule = nil
 			} else {
@@ -249,30 +338,50 @@ func parseSingleToken(psp *pstate) {
 				rp.code = ""
 				rp.noCode = true
 				rp.precsym = nil
-				rp.index = psp.gp.nrule
-				psp.gp.nrule++
-				rp.nextlhs = rp.lhs.rule
-				rp.lhs.rule = rp
-				rp.next = nil
-				if psp.firstrule == nil {
-					psp.firstrule = rp
-					psp.lastrule = rp
+				for _, sp := range rp.rhs {
+					if t := psp.templateOf(sp); t != nil && t != psp.tmpl {
+						ErrorMsg(psp.filename, psp.tokenlineno, "template %q is used without arguments.", t.name)
+						psp.errorcnt++
+					}
+				}
+				if psp.tmpl != nil {
+					psp.tmpl.rules = append(psp.tmpl.rules, rp)
 				} else {
-					psp.lastrule.next = rp
-					psp.lastrule = rp
+					rp.nextlhs = rp.lhs.rule
+					rp.lhs.rule = rp
+					psp.addRule(rp)
+					psp.addHelperRules()
 				}
 				psp.prevrule = rp
 			}
 			psp.state = WAITING_FOR_DECL_OR_RULE
+		} else if x[0] == '"' {
+			if sp := psp.literalSymbol(x); sp != nil {
+				psp.appendRHS(sp, "")
+			}
+		} else if x[0] == '{' {
+			if len(psp.groups) != 0 {
+				ErrorMsg(psp.filename, psp.tokenlineno, "a mid-rule action can't be inside a group.")
+				psp.errorcnt++
+			} else if psp.tmpl != nil {
+				ErrorMsg(psp.filename, psp.tokenlineno, "a mid-rule action can't be used in the rules of template %q.", psp.tmpl.name)
+				psp.errorcnt++
+			} else {
+				psp.midRuleAction(x)
+			}
 		} else if isalpha(x[0]) {
 			if len(psp.rhs) >= MAXRHS {
-				_, _ = fmt.Fprintf(os.Stderr, "%s:%d: too many symbols on RHS of rule beginning at %q.\n", psp.filename, psp.tokenlineno, x)
+				ErrorMsg(psp.filename, psp.tokenlineno, "too many symbols on RHS of rule beginning at %q.", x)
 				psp.errorcnt++
 				psp.state = RESYNC_AFTER_RULE_ERROR
 			} else {
-				psp.rhs = append(psp.rhs, Symbol_new(x))
-				psp.alias = append(psp.alias, "")
-				psp.nrhs = len(psp.rhs)
+				psp.appendRHS(psp.rhsSymbol(x), "")
+			}
+		} else if x[0] == '|' && len(psp.groups) != 0 && (len(psp.rhs) == 0 || len(x) == 1 || !isTerminalName(x[1:]) || psp.rhs[len(psp.rhs)-1].type_ == NONTERMINAL) {
+			// inside a group, a bar that can't form a multi-terminal separates alternatives
+			psp.alternative()
+			if len(x) > 1 {
+				psp.appendRHS(psp.rhsSymbol(x[1:]), "")
 			}
 		} else if (x[0] == '|' || x[0] == '/') && len(psp.rhs) != 0 && isTerminalName(x[1:]) {
 			psp.nrhs = len(psp.rhs)
@@ -288,16 +397,32 @@ func parseSingleToken(psp *pstate) {
 				}
 				psp.rhs[psp.nrhs-1] = msp
 			}
-			msp.subsym = append(msp.subsym, Symbol_new(string(x[1:])))
+			msp.subsym = append(msp.subsym, psp.rhsSymbol(string(x[1:])))
 			msp.nsubsym = len(msp.subsym)
 			if isNonTerminalName(x[1:]) || isNonTerminalName(msp.subsym[0].name) {
-				_, _ = fmt.Fprintf(os.Stderr, "%s:%d: can't form a compound containing a non-terminal.\n", psp.filename, psp.tokenlineno)
+				ErrorMsg(psp.filename, psp.tokenlineno, "can't form a compound containing a non-terminal.")
 				psp.errorcnt++
 			}
+		} else if x[0] == '(' && psp.nrhs > 0 && psp.templateOf(psp.rhs[psp.nrhs-1]) != nil && psp.templateOf(psp.rhs[psp.nrhs-1]) != psp.tmpl {
+			psp.callLast()
 		} else if x[0] == '(' && psp.nrhs > 0 {
+			// either an alias for the last symbol or the start of a group
+			psp.spacedAlias = psp.spaced
 			psp.state = RHS_ALIAS_1
+		} else if x[0] == '(' || x[0] == '[' {
+			if !psp.openGroup(x[0] == '[') {
+				psp.state = RESYNC_AFTER_RULE_ERROR
+			}
+		} else if x[0] == ')' || x[0] == ']' {
+			if len(psp.groups) == 0 || psp.groups[len(psp.groups)-1].optional != (x[0] == ']') {
+				ErrorMsg(psp.filename, psp.tokenlineno, "%q does not close a group.", x)
+				psp.errorcnt++
+				psp.state = RESYNC_AFTER_RULE_ERROR
+			} else {
+				psp.closeGroup()
+			}
 		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: illegal character on RHS of rule: %q.\n", psp.filename, psp.tokenlineno, x)
+			ErrorMsg(psp.filename, psp.tokenlineno, "illegal character on RHS of rule: %q.", x)
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_RULE_ERROR
 		}
@@ -306,23 +431,113 @@ func parseSingleToken(psp *pstate) {
 		if isalpha(x[0]) {
 			psp.alias[psp.nrhs-1] = x
 			psp.state = RHS_ALIAS_2
+		} else if psp.isSelf(psp.rhs[psp.nrhs-1]) {
+			// not an alias, so the "(" starts the arguments of the template
+			psp.callLast()
+			parseSingleToken(psp)
 		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: %q is not a valid alias for the RHS symbol %q\n", psp.filename, psp.tokenlineno, x, psp.rhs[psp.nrhs-1].name)
-			psp.errorcnt++
-			psp.state = RESYNC_AFTER_RULE_ERROR
+			// not an alias, so the "(" starts a group
+			if psp.openGroup(false) {
+				psp.state = IN_RHS
+				parseSingleToken(psp)
+			} else {
+				psp.state = RESYNC_AFTER_RULE_ERROR
+			}
 		}
 		break
 	case RHS_ALIAS_2:
-		if x[0] == ')' {
+		if x[0] == ')' && psp.spacedAlias {
+			// a "?", "*" or "+" next makes "(X)" a group
+			psp.state = RHS_ALIAS_3
+		} else if x[0] == ')' {
+			psp.checkAlias()
 			psp.state = IN_RHS
+		} else if psp.isSelf(psp.rhs[psp.nrhs-1]) {
+			// the "(" started the arguments of the template and the
+			// "alias" is its first argument
+			name := psp.alias[psp.nrhs-1]
+			psp.callLast()
+			call := psp.callStack[len(psp.callStack)-1]
+			call.args = append(call.args, psp.rhsSymbol(name))
+			parseSingleToken(psp)
 		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: missing \")\" following LHS alias name %q.\n", psp.filename, psp.tokenlineno, psp.lhsalias)
+			// the "(" started a group and the "alias" is its first symbol
+			name := psp.alias[psp.nrhs-1]
+			psp.alias[psp.nrhs-1] = ""
+			if psp.openGroup(false) {
+				psp.appendRHS(psp.rhsSymbol(name), "")
+				psp.state = IN_RHS
+				parseSingleToken(psp)
+			} else {
+				psp.state = RESYNC_AFTER_RULE_ERROR
+			}
+		}
+		break
+	case RHS_ALIAS_3:
+		if x == "?" || x == "*" || x == "+" {
+			// "(X)" followed by a "?", "*" or "+" is a group, not an alias
+			name := psp.alias[psp.nrhs-1]
+			psp.alias[psp.nrhs-1] = ""
+			if psp.openGroup(false) {
+				psp.appendRHS(psp.rhsSymbol(name), "")
+				psp.closeGroup()
+				psp.quantify(x)
+				psp.state = IN_RHS
+			} else {
+				psp.state = RESYNC_AFTER_RULE_ERROR
+			}
+		} else {
+			psp.checkAlias()
+			psp.state = IN_RHS
+			parseSingleToken(psp)
+		}
+		break
+	case RHS_TEMPLATE_ARGS:
+		call := psp.callStack[len(psp.callStack)-1]
+		if isalpha(x[0]) {
+			call.args = append(call.args, psp.rhsSymbol(x))
+		} else if x[0] == '"' {
+			if sp := psp.literalSymbol(x); sp != nil {
+				call.args = append(call.args, sp)
+			}
+		} else if x[0] == ',' {
+			// the arguments are separated by commas
+		} else if x[0] == '(' && len(call.args) != 0 && psp.templateOf(call.args[len(call.args)-1]) != nil {
+			t := psp.templateOf(call.args[len(call.args)-1])
+			call.args = call.args[:len(call.args)-1]
+			psp.openCall(t)
+		} else if x[0] == ')' {
+			sp := psp.closeCall()
+			if len(psp.callStack) != 0 {
+				if sp != nil {
+					parent := psp.callStack[len(psp.callStack)-1]
+					parent.args = append(parent.args, sp)
+				}
+			} else {
+				if sp != nil {
+					psp.appendRHS(sp, "")
+				}
+				psp.state = IN_RHS
+			}
+		} else if x[0] == '.' {
+			ErrorMsg(psp.filename, psp.tokenlineno, "missing \")\" after the arguments of template %q.", call.tmpl.name)
+			psp.errorcnt++
+			psp.callStack = nil
+			psp.state = IN_RHS
+			parseSingleToken(psp)
+		} else {
+			ErrorMsg(psp.filename, psp.tokenlineno, "%q can't be an argument of template %q.", x, call.tmpl.name)
 			psp.errorcnt++
+			psp.callStack = nil
 			psp.state = RESYNC_AFTER_RULE_ERROR
 		}
 		break
 	case WAITING_FOR_DECL_KEYWORD:
-		if isalpha(x[0]) {
+		if isalpha(x[0]) && psp.importing != "" && !vocabularyKeywords[x] {
+			ErrorMsg(psp.filename, psp.tokenlineno, "the token vocabulary %q can only declare tokens, not \"%%%s\".", psp.importing, x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		} else if isalpha(x[0]) {
 			psp.declkeyword = x
 			psp.declargslot = nil
 			psp.decllinenoslot = nil
@@ -360,6 +575,9 @@ func parseSingleToken(psp *pstate) {
 			case "token_type":
 				psp.declargslot = &(psp.gp.tokentype)
 				psp.insertLineMacro = false
+			case "location_type":
+				psp.declargslot = &(psp.gp.loctype)
+				psp.insertLineMacro = false
 			case "default_type":
 				psp.declargslot = &(psp.gp.vartype)
 				psp.insertLineMacro = false
@@ -367,7 +585,30 @@ func parseSingleToken(psp *pstate) {
 				psp.declargslot = &(psp.gp.stacksize)
 				psp.insertLineMacro = false
 			case "start_symbol":
-				psp.declargslot = &(psp.gp.start)
+				psp.state = WAITING_FOR_START_SYMBOL
+			case "include_grammar":
+				psp.state = WAITING_FOR_INCLUDE_FILE
+			case "import_tokens":
+				psp.state = WAITING_FOR_VOCABULARY_FILE
+			case "token_pattern":
+				psp.state = WAITING_FOR_PATTERN_TOKEN
+			case "skip_pattern":
+				psp.state = WAITING_FOR_SKIP_PATTERN
+			case "expect":
+				if psp.gp.expectLineno != 0 {
+					ErrorMsg(psp.filename, psp.tokenlineno, "more than one %%expect; the first is on %s.", sourceLine(psp.filename, psp.gp.expectLineno))
+					psp.errorcnt++
+				}
+				psp.declargslot = &(psp.gp.expect)
+				psp.decllinenoslot = &(psp.gp.expectLineno)
+				psp.insertLineMacro = false
+			case "expect_rr":
+				if psp.gp.expectRRLineno != 0 {
+					ErrorMsg(psp.filename, psp.tokenlineno, "more than one %%expect_rr; the first is on %s.", sourceLine(psp.filename, psp.gp.expectRRLineno))
+					psp.errorcnt++
+				}
+				psp.declargslot = &(psp.gp.expectRR)
+				psp.decllinenoslot = &(psp.gp.expectRRLineno)
 				psp.insertLineMacro = false
 			case "left":
 				psp.preccounter++
@@ -394,24 +635,35 @@ func parseSingleToken(psp *pstate) {
 				psp.state = WAITING_FOR_WILDCARD_ID
 			case "token_class":
 				psp.state = WAITING_FOR_CLASS_ID
+			case "template":
+				psp.state = WAITING_FOR_TEMPLATE_NAME
 			default:
-				_, _ = fmt.Fprintf(os.Stderr, "%s:%d: unknown declaration keyword: \"%%%s\".\n", psp.filename, psp.tokenlineno, psp.declkeyword)
+				if match := closestMatch(psp.declkeyword, declKeywords()); match != "" {
+					ErrorMsg(psp.filename, psp.tokenlineno, "unknown declaration keyword: \"%%%s\". Did you mean \"%%%s\"?", psp.declkeyword, match)
+				} else {
+					ErrorMsg(psp.filename, psp.tokenlineno, "unknown declaration keyword: \"%%%s\".", psp.declkeyword)
+				}
 				psp.errorcnt++
 				psp.state = RESYNC_AFTER_DECL_ERROR
 			}
 		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: illegal declaration keyword: %q.\n", psp.filename, psp.tokenlineno, x)
+			ErrorMsg(psp.filename, psp.tokenlineno, "illegal declaration keyword: %q.", x)
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_DECL_ERROR
 		}
 		break
 	case WAITING_FOR_DESTRUCTOR_SYMBOL:
 		if !isalpha(x[0]) {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: symbol name missing after %%destructor keyword.\n", psp.filename, psp.tokenlineno)
+			ErrorMsg(psp.filename, psp.tokenlineno, "symbol name missing after %%destructor keyword.")
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_DECL_ERROR
 		} else {
-			sp := Symbol_new(x)
+			var sp *symbol
+			if t := psp.templates[x]; t != nil {
+				sp = t.lhs
+			} else {
+				sp = psp.symbolNew(x)
+			}
 			psp.declargslot = &sp.destructor
 			psp.decllinenoslot = &sp.destLineno
 			psp.insertLineMacro = true
@@ -420,20 +672,24 @@ func parseSingleToken(psp *pstate) {
 		break
 	case WAITING_FOR_DATATYPE_SYMBOL:
 		if !isalpha(x[0]) {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: symbol name missing after %%type keyword.\n", psp.filename, psp.tokenlineno)
+			ErrorMsg(psp.filename, psp.tokenlineno, "symbol name missing after %%type keyword.")
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_DECL_ERROR
 		} else {
 			sp := Symbol_find(x)
+			if t := psp.templates[x]; t != nil {
+				sp = t.lhs
+			}
 			if sp != nil && sp.datatype != "" {
-				_, _ = fmt.Fprintf(os.Stderr, "%s:%d: symbol %%type %q already defined.\n", psp.filename, psp.tokenlineno, sp.name)
+				ErrorMsg(psp.filename, psp.tokenlineno, "symbol %%type %q already defined.", sp.name)
 				psp.errorcnt++
 				psp.state = RESYNC_AFTER_DECL_ERROR
 			} else {
 				if sp == nil {
-					sp = Symbol_new(x)
+					sp = psp.symbolNew(x)
 				}
 				psp.declargslot = &sp.datatype
+				sp.dtLineno = psp.tokenlineno
 				psp.insertLineMacro = false
 				psp.state = WAITING_FOR_DECL_ARG
 			}
@@ -442,17 +698,24 @@ func parseSingleToken(psp *pstate) {
 	case WAITING_FOR_PRECEDENCE_SYMBOL:
 		if x[0] == '.' {
 			psp.state = WAITING_FOR_DECL_OR_RULE
-		} else if isupper(x[0]) {
-			sp := Symbol_new(x)
-			if sp.prec >= 0 {
-				_, _ = fmt.Fprintf(os.Stderr, "%s:%d: symbol %q has already be given a precedence.\n", psp.filename, psp.tokenlineno, sp.name)
+		} else if isupper(x[0]) || x[0] == '"' {
+			var sp *symbol
+			if x[0] == '"' {
+				sp = psp.literalSymbol(x)
+			} else {
+				sp = psp.symbolNew(x)
+			}
+			if sp == nil {
+				// the spelling is not declared
+			} else if sp.prec >= 0 {
+				ErrorMsg(psp.filename, psp.tokenlineno, "symbol %q has already be given a precedence.", sp.name)
 				psp.errorcnt++
 			} else {
 				sp.prec = psp.preccounter
 				sp.assoc = psp.declassoc
 			}
 		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: can't assign a precedence to %q.\n", psp.filename, psp.tokenlineno, x)
+			ErrorMsg(psp.filename, psp.tokenlineno, "can't assign a precedence to %q.", x)
 			psp.errorcnt++
 		}
 		break
@@ -467,7 +730,8 @@ func parseSingleToken(psp *pstate) {
 				if len(buffer) > 0 && !strings.HasSuffix(buffer, "\n") {
 					buffer = buffer + "\n"
 				}
-				buffer = buffer + fmt.Sprintf("#line %d %s\n", psp.tokenlineno, psp.filename)
+				filename, lineno := sourcePosition(psp.filename, psp.tokenlineno)
+				buffer = buffer + fmt.Sprintf("#line %d %s\n", lineno, filename)
 			}
 			buffer = buffer + x
 			*psp.declargslot = buffer
@@ -476,7 +740,68 @@ func parseSingleToken(psp *pstate) {
 			}
 			psp.state = WAITING_FOR_DECL_OR_RULE
 		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: illegal argument to %%%s: %q.\n", psp.filename, psp.tokenlineno, psp.declkeyword, x)
+			ErrorMsg(psp.filename, psp.tokenlineno, "illegal argument to %%%s: %q.", psp.declkeyword, x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		}
+		break
+	case WAITING_FOR_INCLUDE_FILE:
+		if x[0] == '"' {
+			// the included file starts with the parser waiting for a declaration or rule
+			psp.state = WAITING_FOR_DECL_OR_RULE
+			psp.includeFile(x)
+		} else {
+			ErrorMsg(psp.filename, psp.tokenlineno, "%%include_grammar needs the name of a file in quotes, not %q.", x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		}
+		break
+	case WAITING_FOR_VOCABULARY_FILE:
+		if x[0] == '"' {
+			psp.state = WAITING_FOR_DECL_OR_RULE
+			psp.importTokens(x)
+		} else {
+			ErrorMsg(psp.filename, psp.tokenlineno, "%%import_tokens needs the name of a file in quotes, not %q.", x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		}
+		break
+	case WAITING_FOR_PATTERN_TOKEN:
+		if isupper(x[0]) {
+			psp.patternToken = psp.symbolNew(x)
+			psp.state = WAITING_FOR_TOKEN_PATTERN
+		} else {
+			ErrorMsg(psp.filename, psp.tokenlineno, "%%token_pattern needs the name of a token, not %q.", x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		}
+		break
+	case WAITING_FOR_TOKEN_PATTERN:
+		if x[0] == '"' {
+			psp.addPattern(psp.patternToken, x, false)
+			psp.state = WAITING_FOR_DECL_OR_RULE
+		} else {
+			ErrorMsg(psp.filename, psp.tokenlineno, "the pattern of %q must be in quotes, not %q.", psp.patternToken.name, x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		}
+		break
+	case WAITING_FOR_SKIP_PATTERN:
+		if x[0] == '"' {
+			psp.addPattern(nil, x, false)
+			psp.state = WAITING_FOR_DECL_OR_RULE
+		} else {
+			ErrorMsg(psp.filename, psp.tokenlineno, "%%skip_pattern needs a pattern in quotes, not %q.", x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		}
+		break
+	case WAITING_FOR_START_SYMBOL:
+		if isalpha(x[0]) {
+			psp.declareStartSymbol(x)
+			psp.state = WAITING_FOR_DECL_OR_RULE
+		} else {
+			ErrorMsg(psp.filename, psp.tokenlineno, "illegal argument to %%start_symbol: %q.", x)
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_DECL_ERROR
 		}
@@ -485,14 +810,14 @@ func parseSingleToken(psp *pstate) {
 		if x[0] == '.' {
 			psp.state = WAITING_FOR_DECL_OR_RULE
 		} else if !isupper(x[0]) {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: %%fallback argument %q should be a token.\n", psp.filename, psp.tokenlineno, x)
+			ErrorMsg(psp.filename, psp.tokenlineno, "%%fallback argument %q should be a token.", x)
 			psp.errorcnt++
 		} else {
-			sp := Symbol_new(x)
+			sp := psp.symbolNew(x)
 			if psp.fallback == nil {
 				psp.fallback = sp
 			} else if sp.fallback != nil {
-				_, _ = fmt.Fprintf(os.Stderr, "%s:%d: more than one fallback assigned to token %q.\n", psp.filename, psp.tokenlineno, x)
+				ErrorMsg(psp.filename, psp.tokenlineno, "more than one fallback assigned to token %q.", x)
 				psp.errorcnt++
 			} else {
 				sp.fallback = psp.fallback
@@ -509,43 +834,99 @@ func parseSingleToken(psp *pstate) {
 		//
 		// early in the grammar file, that assigns small consecutive values
 		// to each of the tokens ONE TWO and THREE.
+		//
+		// A token may be followed by its spelling, like %token PLUS "+".
+		// The spelling may then be used in rules in place of the token.
+		// A token may also be given its number, like %token PLUS = 5 "+".
+		// Its number doesn't change when other tokens are added.
 		if x[0] == '.' {
+			psp.lastToken = nil
 			psp.state = WAITING_FOR_DECL_OR_RULE
+		} else if x[0] == '=' {
+			if psp.lastToken == nil {
+				ErrorMsg(psp.filename, psp.tokenlineno, "the number of a token must follow its name.")
+				psp.errorcnt++
+			} else {
+				psp.state = WAITING_FOR_TOKEN_NUMBER
+			}
+		} else if x[0] == '"' {
+			if psp.lastToken == nil {
+				ErrorMsg(psp.filename, psp.tokenlineno, "the spelling %s must follow the name of a token.", x)
+				psp.errorcnt++
+			} else if sp := psp.spellings[x]; sp != nil && sp != psp.lastToken {
+				ErrorMsg(psp.filename, psp.tokenlineno, "%s is already the spelling of %q.", x, sp.name)
+				psp.errorcnt++
+			} else if sp := psp.lastToken; sp.spelling != "" && sp.spelling != x {
+				ErrorMsg(psp.filename, psp.tokenlineno, "token %q already has the spelling %s.", sp.name, sp.spelling)
+				psp.errorcnt++
+			} else {
+				if psp.spellings == nil {
+					psp.spellings = make(map[string]*symbol)
+				}
+				if sp.spelling == "" && x != `""` {
+					psp.addPattern(sp, x, true)
+				}
+				psp.spellings[x], sp.spelling = sp, x
+			}
+			psp.lastToken = nil
 		} else if !isupper(x[0]) {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: %%token argument %q should be a token.\n", psp.filename, psp.tokenlineno, x)
+			ErrorMsg(psp.filename, psp.tokenlineno, "%%token argument %q should be a token.", x)
+			psp.errorcnt++
+			psp.lastToken = nil
+		} else {
+			psp.lastToken = psp.symbolNew(x)
+		}
+		break
+	case WAITING_FOR_TOKEN_NUMBER:
+		sp := psp.lastToken
+		if n, err := strconv.Atoi(x); err != nil || n < 1 {
+			ErrorMsg(psp.filename, psp.tokenlineno, "the number of token %q must be a positive integer, not %q.", sp.name, x)
+			psp.errorcnt++
+		} else if other := psp.tokenNumbers[n]; other != nil && other != sp {
+			ErrorMsg(psp.filename, psp.tokenlineno, "%d is already the number of token %q.", n, other.name)
+			psp.errorcnt++
+		} else if sp.number != 0 && sp.number != n {
+			ErrorMsg(psp.filename, psp.tokenlineno, "token %q already has the number %d.", sp.name, sp.number)
 			psp.errorcnt++
 		} else {
-			Symbol_new(x)
+			if psp.tokenNumbers == nil {
+				psp.tokenNumbers = make(map[int]*symbol)
+			}
+			psp.tokenNumbers[n], sp.number = sp, n
+		}
+		psp.state = WAITING_FOR_TOKEN_NAME
+		if x[0] == '.' {
+			parseSingleToken(psp)
 		}
 		break
 	case WAITING_FOR_WILDCARD_ID:
 		if x[0] == '.' {
 			psp.state = WAITING_FOR_DECL_OR_RULE
 		} else if !isupper(x[0]) {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: %%wildcard argument %q should be a token.\n", psp.filename, psp.tokenlineno, x)
+			ErrorMsg(psp.filename, psp.tokenlineno, "%%wildcard argument %q should be a token.", x)
 			psp.errorcnt++
 		} else {
-			sp := Symbol_new(x)
+			sp := psp.symbolNew(x)
 			if psp.gp.wildcard == nil {
 				psp.gp.wildcard = sp
 			} else {
-				_, _ = fmt.Fprintf(os.Stderr, "%s:%d: extra wildcard to token: %q.\n", psp.filename, psp.tokenlineno, x)
+				ErrorMsg(psp.filename, psp.tokenlineno, "extra wildcard to token: %q.", x)
 				psp.errorcnt++
 			}
 		}
 		break
 	case WAITING_FOR_CLASS_ID:
 		if !ISLOWER(x[0]) {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: %%token_class must be followed by an identifier: %q.\n", psp.filename, psp.tokenlineno, x)
+			ErrorMsg(psp.filename, psp.tokenlineno, "%%token_class must be followed by an identifier: %q.", x)
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_DECL_ERROR
 		} else if Symbol_find(x) != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: symbol %q already used.\n", psp.filename, psp.tokenlineno, x)
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: symbol %q already used.\n", psp.filename, psp.tokenlineno, x)
+			ErrorMsg(psp.filename, psp.tokenlineno, "symbol %q already used.", x)
+			ErrorMsg(psp.filename, psp.tokenlineno, "symbol %q already used.", x)
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_DECL_ERROR
 		} else {
-			psp.tkclass = Symbol_new(x)
+			psp.tkclass = psp.symbolNew(x)
 			psp.tkclass.type_ = MULTITERMINAL
 			psp.state = WAITING_FOR_CLASS_TOKEN
 		}
@@ -555,18 +936,47 @@ func parseSingleToken(psp *pstate) {
 			psp.state = WAITING_FOR_DECL_OR_RULE
 		} else if isupper(x[0]) {
 			msp := psp.tkclass
-			msp.subsym = append(msp.subsym, Symbol_new(x))
+			msp.subsym = append(msp.subsym, psp.symbolNew(x))
 			msp.nsubsym = len(msp.subsym)
 		} else if (x[0] == '|' || x[0] == '/') && isupper(x[1]) {
 			msp := psp.tkclass
-			msp.subsym = append(msp.subsym, Symbol_new(string(x[1:])))
+			msp.subsym = append(msp.subsym, psp.symbolNew(string(x[1:])))
 			msp.nsubsym = len(msp.subsym)
 		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "%s:%d: %%token_class argument %q should be a token.\n", psp.filename, psp.tokenlineno, x)
+			ErrorMsg(psp.filename, psp.tokenlineno, "%%token_class argument %q should be a token.", x)
 			psp.errorcnt++
 			psp.state = RESYNC_AFTER_DECL_ERROR
 		}
 		break
+	case WAITING_FOR_TEMPLATE_NAME:
+		if !ISLOWER(x[0]) {
+			ErrorMsg(psp.filename, psp.tokenlineno, "%%template must be followed by a nonterminal name: %q.", x)
+			psp.errorcnt++
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		} else {
+			psp.declareTemplate(x)
+		}
+		break
+	case WAITING_FOR_TEMPLATE_PARAM:
+		if x[0] == '.' {
+			if len(psp.tmpl.params) == 0 {
+				ErrorMsg(psp.filename, psp.tokenlineno, "%%template %q must have at least one parameter.", psp.tmpl.name)
+				psp.errorcnt++
+			}
+			psp.tmpl = nil
+			psp.state = WAITING_FOR_DECL_OR_RULE
+		} else if !isalpha(x[0]) {
+			ErrorMsg(psp.filename, psp.tokenlineno, "%%template parameter %q should be a symbol name.", x)
+			psp.errorcnt++
+			psp.tmpl = nil
+			psp.state = RESYNC_AFTER_DECL_ERROR
+		} else if psp.tmpl.param(x) != nil || x == psp.tmpl.name {
+			ErrorMsg(psp.filename, psp.tokenlineno, "%%template %q already has a parameter %q.", psp.tmpl.name, x)
+			psp.errorcnt++
+		} else {
+			psp.tmpl.params = append(psp.tmpl.params, placeholder(x))
+		}
+		break
 	case RESYNC_AFTER_RULE_ERROR, RESYNC_AFTER_DECL_ERROR:
 		if x[0] == '.' {
 			psp.state = WAITING_FOR_DECL_OR_RULE
@@ -4,6 +4,11 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -12,6 +17,8 @@ func TestParse(t *testing.T) {
 	symtab["a"] = "true"
 	symtab["b"] = "true"
 
+	Symbol_init()
+	Symbol_new("$")
 	lem := &lemon{
 		filename:          "example.y",
 		printPreprocessed: false,
@@ -44,3 +51,143 @@ func TestParse(t *testing.T) {
 	lem.nterminal = i
 
 }
+
+func TestSpellings(t *testing.T) {
+	lem := parseGrammar(t, "%token PLUS \"+\" LP \"(\" RP \")\".\n%left \"+\".\nexpr ::= expr \"+\" expr.\nexpr ::= \"(\" expr \")\".\nexpr ::= NUM.\n")
+	w := &bytes.Buffer{}
+	lem.rule.printCursor(w, 1)
+	if want := `expr ::= expr * "+" expr`; w.String() != want {
+		t.Errorf("rule: want %s: got %s\n", want, w.String())
+	}
+	if sp := Symbol_find("PLUS"); sp.rule != nil || sp.prec != 1 || sp.displayName() != `"+"` {
+		t.Errorf("PLUS: want a terminal with precedence 1 spelled \"+\"\n")
+	}
+	if Symbol_find(`"+"`) != nil {
+		t.Errorf("want no symbol for the spelling\n")
+	}
+
+	type test_case struct {
+		id      int
+		grammar string
+		expect  []string
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			grammar: "expr ::= expr \"+\" expr.\n",
+			expect:  []string{`1: "+" is not the spelling of a token; declare it with "%token NAME "+"".`},
+		},
+		{id: 2,
+			grammar: "%token PLUS \"+\" ADD \"+\".\nexpr ::= NUM.\n",
+			expect:  []string{`1: "+" is already the spelling of "PLUS".`},
+		},
+		{id: 3,
+			grammar: "%token PLUS \"+\".\n%token PLUS \"plus\".\nexpr ::= NUM.\n",
+			expect:  []string{`2: token "PLUS" already has the spelling "+".`},
+		},
+		{id: 4,
+			grammar: "%token \"+\".\nexpr ::= NUM.\n",
+			expect:  []string{`1: the spelling "+" must follow the name of a token.`},
+		},
+	} {
+		filename := filepath.Join(t.TempDir(), "test.y")
+		if err := os.WriteFile(filename, []byte(tc.grammar), 0644); err != nil {
+			t.Fatal(err)
+		}
+		Symbol_init()
+		Symbol_new("$")
+		lem := &lemon{filename: filename}
+		var got []string
+		msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+			got = append(got, fmt.Sprintf("%d: %s", lineno, msg))
+		}
+		Parse(lem, map[string]string{})
+		msgHook = nil
+		if strings.Join(got, "\n") != strings.Join(tc.expect, "\n") {
+			t.Errorf("%d: want\n%s\n%d: got\n%s\n", tc.id, strings.Join(tc.expect, "\n"), tc.id, strings.Join(got, "\n"))
+		}
+		if lem.errorcnt != len(tc.expect) {
+			t.Errorf("%d: errors: want %d: got %d\n", tc.id, len(tc.expect), lem.errorcnt)
+		}
+	}
+}
+
+func TestTokenNumbers(t *testing.T) {
+	lem := parseGrammar(t, "%token_type {Token}\n%token SELECT = 3 FROM = 1 \"from\".\n%type NUM {int}\nprog ::= SELECT NUM FROM ID.\nprog ::= STAR.\n")
+	var got []string
+	for i := 0; i < lem.nterminal; i++ {
+		sp := lem.symbols[i]
+		got = append(got, fmt.Sprintf("%d %s filler=%v type=%q", sp.index, sp.name, sp.filler, (&pstate{gp: lem}).valueType(sp)))
+	}
+	expect := []string{
+		`0 $ filler=false type="{Token}"`,
+		`1 FROM filler=false type="{Token}"`,
+		`2 NUM filler=false type="{int}"`,
+		`3 SELECT filler=false type="{Token}"`,
+		`4 ID filler=false type="{Token}"`,
+		`5 STAR filler=false type="{Token}"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("numbers: want\n%s\nnumbers: got\n%s\n", strings.Join(expect, "\n"), strings.Join(got, "\n"))
+	}
+
+	lem = parseGrammar(t, "%token A = 4 B.\nprog ::= A B.\n")
+	got = nil
+	for i := 1; i < lem.nterminal; i++ {
+		got = append(got, fmt.Sprintf("%d %s filler=%v", lem.symbols[i].index, lem.symbols[i].name, lem.symbols[i].filler))
+	}
+	expect = []string{"1 B filler=false", "2 UNUSED_2 filler=true", "3 UNUSED_3 filler=true", "4 A filler=false"}
+	if strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("gaps: want\n%s\ngaps: got\n%s\n", strings.Join(expect, "\n"), strings.Join(got, "\n"))
+	}
+
+	type test_case struct {
+		id      int
+		grammar string
+		expect  []string
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			grammar: "%token A = 1 B = 1.\nexpr ::= A B.\n",
+			expect:  []string{`1: 1 is already the number of token "A".`},
+		},
+		{id: 2,
+			grammar: "%token A = 1.\n%token A = 2.\nexpr ::= A.\n",
+			expect:  []string{`2: token "A" already has the number 1.`},
+		},
+		{id: 3,
+			grammar: "%token A = 0 B = x.\nexpr ::= A B.\n",
+			expect: []string{
+				`1: the number of token "A" must be a positive integer, not "0".`,
+				`1: the number of token "B" must be a positive integer, not "x".`,
+			},
+		},
+		{id: 4,
+			grammar: "%token = 3.\nexpr ::= NUM.\n",
+			expect:  []string{`1: the number of a token must follow its name.`, `1: %token argument "3" should be a token.`},
+		},
+		{id: 5,
+			grammar: "%token A = .\nexpr ::= A.\n",
+			expect:  []string{`1: the number of token "A" must be a positive integer, not ".".`},
+		},
+	} {
+		filename := filepath.Join(t.TempDir(), "test.y")
+		if err := os.WriteFile(filename, []byte(tc.grammar), 0644); err != nil {
+			t.Fatal(err)
+		}
+		Symbol_init()
+		Symbol_new("$")
+		lem := &lemon{filename: filename}
+		var got []string
+		msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+			got = append(got, fmt.Sprintf("%d: %s", lineno, msg))
+		}
+		Parse(lem, map[string]string{})
+		msgHook = nil
+		if strings.Join(got, "\n") != strings.Join(tc.expect, "\n") {
+			t.Errorf("%d: want\n%s\n%d: got\n%s\n", tc.id, strings.Join(tc.expect, "\n"), tc.id, strings.Join(got, "\n"))
+		}
+		if lem.errorcnt != len(tc.expect) {
+			t.Errorf("%d: errors: want %d: got %d\n", tc.id, len(tc.expect), lem.errorcnt)
+		}
+	}
+}
@@ -10,3 +10,18 @@ type plink struct {
 	cfp  *config // The configuration to which linked
 	next *plink  // The next propagate link
 }
+
+// Plink_add adds a plink to a plink list.
+func Plink_add(plpp **plink, cfp *config) {
+	*plpp = &plink{cfp: cfp, next: *plpp}
+}
+
+// Plink_copy transfers every plink on the list "from" to the list "to".
+func Plink_copy(to **plink, from *plink) {
+	for from != nil {
+		nextpl := from.next
+		from.next = *to
+		*to = from
+		from = nextpl
+	}
+}
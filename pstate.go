@@ -4,29 +4,77 @@
 package main
 
 type pstate struct {
-	filename        string    // Name of the input file
-	tokenlineno     int       // Linenumber at which current token starts
-	errorcnt        int       // Number of errors so far
-	tokenstart      []byte    // Text of current token
-	gp              *lemon    // Global state vector
-	state           e_state   // The state of the parser
-	fallback        *symbol   // The fallback token
-	tkclass         *symbol   // Token class symbol
-	lhs             *symbol   // Left-hand side of current rule
-	lhsalias        string    // Alias for the LHS
-	nrhs            int       // Number of right-hand side symbols seen
-	rhs             []*symbol // RHS symbols
-	alias           []string  // Aliases for each RHS symbol (or NULL)
-	prevrule        *rule     // Previous rule parsed
-	declkeyword     string    // Keyword of a declaration
-	declargslot     *string   // Where the declaration argument should be put. originally a pointer to char buffer (char**)
-	declArgSlotBuf  []byte    // oh boy
-	declArgSlotSym  *symbol   // oh boy
-	insertLineMacro bool      // Add #line before declaration insert
-	decllinenoslot  *int      // Where to write declaration line number
-	declassoc       e_assoc   // Assign this association to decl arguments
-	preccounter     int       // Assign this precedence to decl arguments
-	firstrule       *rule     // Pointer to first rule in the grammar
-	lastrule        *rule     // Pointer to the most recently parsed rule
-	debug           bool      // mdhender
+	filename        string                    // Name of the input file
+	including       []string                  // The files being read, the input file first
+	symtab          map[string]string         // The macros defined on the command line
+	tested          map[string]bool           // The macros tested by the files read so far
+	tokenlineno     int                       // Linenumber at which current token starts
+	errorcnt        int                       // Number of errors so far
+	tokenstart      []byte                    // Text of current token
+	spaced          bool                      // White space or a comment comes before the current token
+	gp              *lemon                    // Global state vector
+	state           e_state                   // The state of the parser
+	fallback        *symbol                   // The fallback token
+	tkclass         *symbol                   // Token class symbol
+	lhs             *symbol                   // Left-hand side of current rule
+	lhsalias        string                    // Alias for the LHS
+	nrhs            int                       // Number of right-hand side symbols seen
+	rhs             []*symbol                 // RHS symbols
+	alias           []string                  // Aliases for each RHS symbol (or NULL)
+	prevrule        *rule                     // Previous rule parsed
+	declkeyword     string                    // Keyword of a declaration
+	declargslot     *string                   // Where the declaration argument should be put. originally a pointer to char buffer (char**)
+	declArgSlotBuf  []byte                    // oh boy
+	declArgSlotSym  *symbol                   // oh boy
+	insertLineMacro bool                      // Add #line before declaration insert
+	decllinenoslot  *int                      // Where to write declaration line number
+	declassoc       e_assoc                   // Assign this association to decl arguments
+	preccounter     int                       // Assign this precedence to decl arguments
+	firstrule       *rule                     // Pointer to first rule in the grammar
+	lastrule        *rule                     // Pointer to the most recently parsed rule
+	groups          []*rhsGroup               // EBNF groups that are open on the RHS
+	pending         *rhsGroup                 // EBNF group that was just closed, waiting for a "?", "*" or "+"
+	spacedAlias     bool                      // White space comes before the "(" of the RHS alias being read
+	helperRules     []*rule                   // Rules for EBNF helpers, added after the current rule
+	helpers         []*symbol                 // Optional and group EBNF helpers, which may be given a type
+	templates       map[string]*ruleTemplate  // Templates by name
+	tmpl            *ruleTemplate             // Template whose rules are being read, or nil
+	calls           map[*symbol]*templateCall // Uses of templates in the rules of templates
+	callStack       []*templateCall           // Uses of templates whose arguments are being read
+	instances       []*templateInstance       // Nonterminals created from templates
+	spellings       map[string]*symbol        // Terminals by their spelling, like "+"
+	nmid            int                       // Number of mid-rule actions
+	lastToken       *symbol                   // The last token named in a %token declaration
+	tokenNumbers    map[int]*symbol           // Terminals by their number from %token NAME = N
+	patternToken    *symbol                   // The token named in a %token_pattern declaration
+	importing       string                    // The token vocabulary being read, or ""
+	vocabularies    []string                  // The token vocabularies imported so far
+	debug           bool                      // mdhender
+}
+
+// literalSymbol returns the terminal with the spelling. The spelling must
+// be declared with %token before it is used.
+func (psp *pstate) literalSymbol(literal string) *symbol {
+	sp := psp.spellings[literal]
+	if sp == nil {
+		ErrorMsg(psp.filename, psp.tokenlineno, "%s is not the spelling of a token; declare it with \"%%token NAME %s\".", literal, literal)
+		psp.errorcnt++
+		return nil
+	}
+	sp.useCnt++
+	return sp
+}
+
+// symbolNew returns the named symbol, creating it if needed.
+// The line number of the current token is recorded when the symbol is
+// first seen so that warnings about the symbol can point to it.
+func (psp *pstate) symbolNew(name string) *symbol {
+	sp := Symbol_new(name)
+	if sp.lineno == 0 {
+		sp.lineno = psp.tokenlineno
+	}
+	if psp.importing != "" && sp.type_ == TERMINAL && sp.vocabulary == "" {
+		sp.vocabulary = psp.importing
+	}
+	return sp
 }
@@ -0,0 +1,358 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+// this file contains the railroad (syntax) diagrams for the nonterminals.
+//
+// each nonterminal is drawn as a choice between its rules. a rule is a
+// sequence of boxes: rounded for terminals and square for nonterminals.
+// a multi-terminal is a choice between its terminals. left recursion,
+// like "list ::= list item", is drawn as a loop after the other rules.
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The dimensions of the diagrams, in pixels.
+const (
+	rrCharWidth = 8  // width of one character of a name
+	rrBoxHeight = 22 // height of a box
+	rrPad       = 8  // space between a name and the side of its box
+	rrGap       = 10 // line between the items of a sequence
+	rrArc       = 10 // radius of the curves
+	rrVGap      = 8  // space between the alternatives of a choice
+	rrMargin    = 10 // space around the diagram
+	rrEnd       = 20 // line at the start and the end of the diagram
+)
+
+// rrNode is an element of a diagram. The track runs horizontally through
+// the node; the ascent and descent are the extent above and below it.
+type rrNode interface {
+	width() int
+	ascent() int
+	descent() int
+	// draw writes the node with the track entering at (x, y).
+	draw(sb *strings.Builder, x, y int)
+}
+
+// rrBox is a symbol. A terminal is drawn with rounded corners.
+// If href is set, the box links to the diagram for the symbol.
+type rrBox struct {
+	text     string
+	href     string
+	terminal bool
+}
+
+func (b *rrBox) width() int   { return len(b.text)*rrCharWidth + 2*rrPad }
+func (b *rrBox) ascent() int  { return rrBoxHeight / 2 }
+func (b *rrBox) descent() int { return rrBoxHeight / 2 }
+
+func (b *rrBox) draw(sb *strings.Builder, x, y int) {
+	if b.href != "" {
+		_, _ = fmt.Fprintf(sb, `<a href="%s">`, html.EscapeString(b.href))
+	}
+	class, rx := "nonterminal", 0
+	if b.terminal {
+		class, rx = "terminal", rrBoxHeight/2
+	}
+	_, _ = fmt.Fprintf(sb, `<rect class="%s" x="%d" y="%d" width="%d" height="%d" rx="%d"/>`, class, x, y-rrBoxHeight/2, b.width(), rrBoxHeight, rx)
+	_, _ = fmt.Fprintf(sb, `<text x="%d" y="%d">%s</text>`, x+b.width()/2, y+4, html.EscapeString(b.text))
+	if b.href != "" {
+		sb.WriteString(`</a>`)
+	}
+	sb.WriteByte('\n')
+}
+
+// rrSkip is an empty alternative.
+type rrSkip struct{}
+
+func (rrSkip) width() int                         { return 0 }
+func (rrSkip) ascent() int                        { return 0 }
+func (rrSkip) descent() int                       { return 0 }
+func (rrSkip) draw(sb *strings.Builder, x, y int) {}
+
+// rrSeq is a sequence of nodes joined by the track.
+type rrSeq struct {
+	items []rrNode
+}
+
+// newSeq returns the sequence of the nodes, leaving out the empty ones.
+func newSeq(items ...rrNode) rrNode {
+	seq := &rrSeq{}
+	for _, item := range items {
+		if _, ok := item.(rrSkip); !ok {
+			seq.items = append(seq.items, item)
+		}
+	}
+	switch len(seq.items) {
+	case 0:
+		return rrSkip{}
+	case 1:
+		return seq.items[0]
+	}
+	return seq
+}
+
+func (s *rrSeq) width() int {
+	w := rrGap * (len(s.items) - 1)
+	for _, item := range s.items {
+		w += item.width()
+	}
+	return w
+}
+
+func (s *rrSeq) ascent() (a int) {
+	for _, item := range s.items {
+		a = max(a, item.ascent())
+	}
+	return a
+}
+
+func (s *rrSeq) descent() (d int) {
+	for _, item := range s.items {
+		d = max(d, item.descent())
+	}
+	return d
+}
+
+func (s *rrSeq) draw(sb *strings.Builder, x, y int) {
+	for i, item := range s.items {
+		if i != 0 {
+			rrLine(sb, x, y, x+rrGap)
+			x += rrGap
+		}
+		item.draw(sb, x, y)
+		x += item.width()
+	}
+}
+
+// rrChoice is a set of alternatives. The first is on the track and the
+// others branch off below it.
+type rrChoice struct {
+	alts []rrNode
+}
+
+// newChoice returns the choice between the nodes.
+func newChoice(alts ...rrNode) rrNode {
+	if len(alts) == 1 {
+		return alts[0]
+	}
+	return &rrChoice{alts: alts}
+}
+
+// offsets returns the distance from the track to each alternative.
+func (c *rrChoice) offsets() []int {
+	offsets := []int{0}
+	for i := 1; i < len(c.alts); i++ {
+		dy := max(c.alts[i-1].descent()+rrVGap+c.alts[i].ascent(), 2*rrArc)
+		offsets = append(offsets, offsets[i-1]+dy)
+	}
+	return offsets
+}
+
+func (c *rrChoice) width() (w int) {
+	for _, alt := range c.alts {
+		w = max(w, alt.width())
+	}
+	return w + 4*rrArc
+}
+
+func (c *rrChoice) ascent() int {
+	return c.alts[0].ascent()
+}
+
+func (c *rrChoice) descent() int {
+	offsets := c.offsets()
+	return offsets[len(offsets)-1] + c.alts[len(c.alts)-1].descent()
+}
+
+func (c *rrChoice) draw(sb *strings.Builder, x, y int) {
+	w := c.width()
+	for i, offset := range c.offsets() {
+		alt, yi := c.alts[i], y+offset
+		if i == 0 {
+			rrLine(sb, x, y, x+2*rrArc)
+		} else {
+			_, _ = fmt.Fprintf(sb, `<path d="M%d %d q%d 0 %d %d v%d q0 %d %d %d"/>`+"\n", x, y, rrArc, rrArc, rrArc, offset-2*rrArc, rrArc, rrArc, rrArc)
+		}
+		alt.draw(sb, x+2*rrArc, yi)
+		rrLine(sb, x+2*rrArc+alt.width(), yi, x+w-2*rrArc)
+		if i == 0 {
+			rrLine(sb, x+w-2*rrArc, y, x+w)
+		} else {
+			_, _ = fmt.Fprintf(sb, `<path d="M%d %d q%d 0 %d %d v%d q0 %d %d %d"/>`+"\n", x+w-2*rrArc, yi, rrArc, rrArc, -rrArc, -(offset - 2*rrArc), -rrArc, rrArc, -rrArc)
+		}
+	}
+}
+
+// rrLoop is a node that is repeated one or more times. The track returns
+// from the end to the start below the node.
+type rrLoop struct {
+	item rrNode
+}
+
+func (l *rrLoop) width() int   { return l.item.width() + 4*rrArc }
+func (l *rrLoop) ascent() int  { return l.item.ascent() }
+func (l *rrLoop) descent() int { return max(l.item.descent()+rrVGap, 2*rrArc) }
+
+func (l *rrLoop) draw(sb *strings.Builder, x, y int) {
+	w, d := l.width(), l.descent()
+	rrLine(sb, x, y, x+2*rrArc)
+	l.item.draw(sb, x+2*rrArc, y)
+	rrLine(sb, x+2*rrArc+l.item.width(), y, x+w)
+	_, _ = fmt.Fprintf(sb, `<path d="M%d %d q%d 0 %d %d v%d q0 %d %d %d h%d q%d 0 %d %d v%d q0 %d %d %d"/>`+"\n",
+		x+w-2*rrArc, y, rrArc, rrArc, rrArc, d-2*rrArc, rrArc, -rrArc, rrArc,
+		-(w - 4*rrArc), -rrArc, -rrArc, -rrArc, -(d - 2*rrArc), -rrArc, rrArc, -rrArc)
+}
+
+// rrLine draws the track from x1 to x2.
+func rrLine(sb *strings.Builder, x1, y, x2 int) {
+	if x1 < x2 {
+		_, _ = fmt.Fprintf(sb, `<path d="M%d %d h%d"/>`+"\n", x1, y, x2-x1)
+	}
+}
+
+// railroadOf returns the diagram for a nonterminal. The href function
+// returns the link for a nonterminal in the diagram. The helpers for EBNF
+// shorthand are drawn in place instead of as boxes.
+func (lemp *lemon) railroadOf(sp *symbol, href func(name string) string) rrNode {
+	box := func(sp *symbol) rrNode {
+		if sp.helper != "" {
+			return lemp.railroadOf(sp, href)
+		}
+		switch sp.type_ {
+		case TERMINAL:
+			return &rrBox{text: sp.displayName(), terminal: true}
+		case MULTITERMINAL:
+			var alts []rrNode
+			for _, subsym := range sp.subsym {
+				alts = append(alts, &rrBox{text: subsym.displayName(), terminal: true})
+			}
+			return newChoice(alts...)
+		}
+		return &rrBox{text: sp.name, href: href(sp.name)}
+	}
+
+	var bases, tails []rrNode
+	for _, rp := range rulesOf(sp) {
+		var items []rrNode
+		for i, rhs := range rp.rhs {
+			if i == 0 && rhs == sp {
+				continue
+			}
+			items = append(items, box(rhs))
+		}
+		if rp.nrhs != 0 && rp.rhs[0] == sp {
+			tails = append(tails, newSeq(items...))
+		} else {
+			bases = append(bases, newSeq(items...))
+		}
+	}
+	if len(bases) == 0 {
+		bases = append(bases, rrSkip{})
+	}
+	if len(tails) == 0 {
+		return newChoice(bases...)
+	}
+	return newSeq(newChoice(bases...), newChoice(rrSkip{}, &rrLoop{item: newChoice(tails...)}))
+}
+
+// rulesOf returns the rules for a nonterminal in the order of the input.
+func rulesOf(sp *symbol) (rules []*rule) {
+	for rp := sp.rule; rp != nil; rp = rp.nextlhs {
+		rules = append(rules, rp)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].index < rules[j].index
+	})
+	return rules
+}
+
+// railroadSVG returns the diagram as an SVG image.
+func railroadSVG(node rrNode) string {
+	w := node.width() + 2*rrEnd + 2*rrMargin
+	h := node.ascent() + node.descent() + 2*rrMargin
+	x, y := rrMargin, rrMargin+node.ascent()
+	sb := &strings.Builder{}
+	_, _ = fmt.Fprintf(sb, `<svg xmlns="http://www.w3.org/2000/svg" class="railroad" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", w, h, w, h)
+	sb.WriteString(`<style>path { fill: none; stroke: #333; stroke-width: 1.5; } rect { stroke: #333; stroke-width: 1.5; } rect.terminal { fill: #e8f4e8; } rect.nonterminal { fill: #e8eef8; } text { font: 12px monospace; text-anchor: middle; } circle { fill: #333; }</style>` + "\n")
+	_, _ = fmt.Fprintf(sb, `<circle cx="%d" cy="%d" r="4"/>`+"\n", x, y)
+	rrLine(sb, x, y, x+rrEnd)
+	node.draw(sb, x+rrEnd, y)
+	rrLine(sb, x+rrEnd+node.width(), y, x+2*rrEnd+node.width())
+	_, _ = fmt.Fprintf(sb, `<circle cx="%d" cy="%d" r="4"/>`+"\n", x+2*rrEnd+node.width(), y)
+	sb.WriteString("</svg>\n")
+	return sb.String()
+}
+
+// railroadSymbols returns the nonterminals with rules, in the order of
+// their first rule in the input. The EBNF helpers don't have diagrams.
+func (lemp *lemon) railroadSymbols() (list []*symbol) {
+	for i := lemp.nterminal; i < lemp.nsymbol; i++ {
+		if sp := lemp.symbols[i]; sp.rule != nil && sp.helper == "" {
+			list = append(list, lemp.symbols[i])
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return rulesOf(list[i])[0].index < rulesOf(list[j])[0].index
+	})
+	return list
+}
+
+// rulesText returns the rules for a nonterminal as text.
+func rulesText(sp *symbol) string {
+	sb := &bytes.Buffer{}
+	for _, rp := range rulesOf(sp) {
+		rp.printCursor(sb, -1)
+		sb.WriteString(".\n")
+	}
+	return sb.String()
+}
+
+// ReportRailroadHTML writes a web page with a diagram for every nonterminal.
+// The nonterminals in the diagrams link to their own diagrams.
+func ReportRailroadHTML(w io.Writer, lemp *lemon) error {
+	sb := &strings.Builder{}
+	title := html.EscapeString(filepath.Base(lemp.filename))
+	_, _ = fmt.Fprintf(sb, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>Syntax of %s</title>\n", title)
+	sb.WriteString("<style>body { font-family: sans-serif; } pre { background: #f4f4f4; padding: 0.5em; } svg a rect:hover { fill: #ffd; }</style>\n</head>\n<body>\n")
+	_, _ = fmt.Fprintf(sb, "<h1>Syntax of %s</h1>\n", title)
+	for _, sp := range lemp.railroadSymbols() {
+		name := html.EscapeString(sp.name)
+		_, _ = fmt.Fprintf(sb, "<h2 id=\"rr-%s\">%s</h2>\n", name, name)
+		sb.WriteString(railroadSVG(lemp.railroadOf(sp, func(name string) string { return "#rr-" + name })))
+		_, _ = fmt.Fprintf(sb, "<pre>%s</pre>\n", html.EscapeString(rulesText(sp)))
+	}
+	sb.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// ReportRailroadMarkdown writes a diagram for every nonterminal as an SVG
+// file in the directory, and a Markdown page that shows them to w.
+// The images are linked relative to the page, so the directory must be
+// next to it.
+func ReportRailroadMarkdown(w io.Writer, lemp *lemon, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	sb := &strings.Builder{}
+	_, _ = fmt.Fprintf(sb, "# Syntax of %s\n", filepath.Base(lemp.filename))
+	for _, sp := range lemp.railroadSymbols() {
+		svg := railroadSVG(lemp.railroadOf(sp, func(name string) string { return name + ".svg" }))
+		if err := os.WriteFile(filepath.Join(dir, sp.name+".svg"), []byte(svg), 0o644); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(sb, "\n## %s\n\n![%s](%s/%s.svg)\n\n```\n%s```\n", sp.name, sp.name, filepath.Base(dir), sp.name, rulesText(sp))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
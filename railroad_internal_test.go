@@ -0,0 +1,112 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRailroad(t *testing.T) {
+	grammar := "prog ::= stmts.\nstmts ::= stmts stmt SEMI.\nstmts ::= .\nstmt ::= LET ID EQ expr.\nstmt ::= expr.\nexpr ::= expr PLUS|MINUS term.\nexpr ::= term.\nterm ::= NUM.\nterm ::= LP expr RP.\n"
+	lem := parseGrammar(t, grammar)
+	analyzeGrammar(lem)
+
+	type test_case struct {
+		id     int
+		name   string
+		expect string // the shape of the diagram
+	}
+	shape := func(node rrNode) string {
+		var walk func(node rrNode) string
+		walk = func(node rrNode) string {
+			switch n := node.(type) {
+			case *rrBox:
+				return n.text
+			case rrSkip:
+				return "-"
+			case *rrSeq:
+				var items []string
+				for _, item := range n.items {
+					items = append(items, walk(item))
+				}
+				return "(" + strings.Join(items, " ") + ")"
+			case *rrChoice:
+				var alts []string
+				for _, alt := range n.alts {
+					alts = append(alts, walk(alt))
+				}
+				return "[" + strings.Join(alts, "|") + "]"
+			case *rrLoop:
+				return "{" + walk(n.item) + "}"
+			}
+			return "?"
+		}
+		return walk(node)
+	}
+	for _, tc := range []test_case{
+		{id: 1, name: "prog", expect: "stmts"},
+		{id: 2, name: "stmts", expect: "[-|{(stmt SEMI)}]"},
+		{id: 3, name: "stmt", expect: "[(LET ID EQ expr)|expr]"},
+		{id: 4, name: "expr", expect: "(term [-|{([PLUS|MINUS] term)}])"},
+		{id: 5, name: "term", expect: "[NUM|(LP expr RP)]"},
+	} {
+		node := lem.railroadOf(Symbol_find(tc.name), func(name string) string { return "#" + name })
+		if got := shape(node); got != tc.expect {
+			t.Errorf("%d: %s: want %s: got %s\n", tc.id, tc.name, tc.expect, got)
+		}
+		// the image must be well-formed XML
+		d := xml.NewDecoder(strings.NewReader(railroadSVG(node)))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("%d: %s: svg: %v\n", tc.id, tc.name, err)
+				break
+			}
+		}
+	}
+
+	w := &bytes.Buffer{}
+	if err := ReportRailroadHTML(w, lem); err != nil {
+		t.Fatalf("html: %v\n", err)
+	}
+	if page := w.String(); strings.Count(page, "<svg") != 5 || !strings.Contains(page, `<h2 id="rr-expr">`) || !strings.Contains(page, `<a href="#rr-expr">`) {
+		t.Errorf("html: want 5 linked diagrams: got\n%s", page)
+	}
+
+	dir := filepath.Join(t.TempDir(), "test.railroad")
+	w.Reset()
+	if err := ReportRailroadMarkdown(w, lem, dir); err != nil {
+		t.Fatalf("md: %v\n", err)
+	}
+	if !strings.Contains(w.String(), "## stmts\n\n![stmts](test.railroad/stmts.svg)\n") {
+		t.Errorf("md: want stmts image: got\n%s", w.String())
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 5 {
+		t.Errorf("md: want 5 svg files: got %d, %v\n", len(entries), err)
+	}
+}
+
+func TestRailroadEBNF(t *testing.T) {
+	lem := parseGrammar(t, "list ::= LP [item (COMMA item)*] RP.\nitem ::= NUM.\n")
+	analyzeGrammar(lem)
+
+	var names []string
+	for _, sp := range lem.railroadSymbols() {
+		names = append(names, sp.name)
+	}
+	if got := strings.Join(names, " "); got != "list item" {
+		t.Errorf("symbols: want %q: got %q\n", "list item", got)
+	}
+	svg := railroadSVG(lem.railroadOf(Symbol_find("list"), func(name string) string { return "#" + name }))
+	if strings.Contains(svg, "opt_") || strings.Contains(svg, "star_") || !strings.Contains(svg, ">COMMA<") {
+		t.Errorf("list: want the helpers drawn in place: got\n%s", svg)
+	}
+}
@@ -0,0 +1,381 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// reprintDecls are the declarations whose argument is saved as a string
+// in the global state vector, in the order that Reprint writes them.
+var reprintDecls = []struct {
+	keyword string
+	value   func(lemp *lemon) string
+	isCode  bool // true if the argument is code that is stripped with the actions
+}{
+	{keyword: "name", value: func(lemp *lemon) string { return lemp.name }},
+	{keyword: "token_prefix", value: func(lemp *lemon) string { return lemp.tokenprefix }},
+	{keyword: "token_type", value: func(lemp *lemon) string { return lemp.tokentype }},
+	{keyword: "default_type", value: func(lemp *lemon) string { return lemp.vartype }},
+	{keyword: "location_type", value: func(lemp *lemon) string { return lemp.loctype }},
+	{keyword: "extra_argument", value: func(lemp *lemon) string { return lemp.arg }},
+	{keyword: "extra_context", value: func(lemp *lemon) string { return lemp.ctx }},
+	{keyword: "stack_size", value: func(lemp *lemon) string { return lemp.stacksize }},
+	{keyword: "start_symbol", value: func(lemp *lemon) string { return strings.Join(lemp.starts, " ") }},
+	{keyword: "expect", value: func(lemp *lemon) string { return lemp.expect }},
+	{keyword: "expect_rr", value: func(lemp *lemon) string { return lemp.expectRR }},
+	{keyword: "include", value: func(lemp *lemon) string { return lemp.include }, isCode: true},
+	{keyword: "code", value: func(lemp *lemon) string { return lemp.extracode }, isCode: true},
+	{keyword: "token_destructor", value: func(lemp *lemon) string { return lemp.tokendest }, isCode: true},
+	{keyword: "default_destructor", value: func(lemp *lemon) string { return lemp.vardest }, isCode: true},
+	{keyword: "syntax_error", value: func(lemp *lemon) string { return lemp.error }, isCode: true},
+	{keyword: "parse_accept", value: func(lemp *lemon) string { return lemp.accept }, isCode: true},
+	{keyword: "parse_failure", value: func(lemp *lemon) string { return lemp.failure }, isCode: true},
+	{keyword: "stack_overflow", value: func(lemp *lemon) string { return lemp.overflow }, isCode: true},
+}
+
+// Reprint duplicates the input file without comments.
+// The reprint is a complete grammar; it parses back to the same symbols
+// and rules. If stripActions is set, the code for the rules and the
+// code declarations are left out, and so are the aliases that the code used.
+func Reprint(w io.Writer, lemp *lemon, stripActions bool) {
+	_, _ = fmt.Fprintf(w, "// Reprint of input file \"%s\".\n// Symbols:\n", lemp.filename)
+	maxlen := 10
+	for i := 0; i < lemp.nsymbol; i++ {
+		sp := lemp.symbols[i]
+		if len(sp.name) > maxlen {
+			maxlen = len(sp.name)
+		}
+	}
+	ncolumns := 76 / (maxlen + 5)
+	if ncolumns < 1 {
+		ncolumns = 1
+	}
+
+	// print headings as comments
+	skip := (lemp.nsymbol + ncolumns - 1) / ncolumns
+	for i := 0; i < skip; i++ {
+		_, _ = fmt.Fprintf(w, "//")
+		for j := i; j < lemp.nsymbol; j += skip {
+			sp := lemp.symbols[j]
+			if !(sp.index == j) {
+				panic("assert(sp.index == j)")
+			}
+			_, _ = fmt.Fprintf(w, " %3d %-*.*s", j, maxlen, maxlen, sp.name)
+		}
+		_, _ = fmt.Fprintf(w, "\n")
+	}
+
+	// print the declarations that hold a single value
+	_, _ = fmt.Fprintf(w, "\n")
+	for _, decl := range reprintDecls {
+		if decl.isCode && stripActions {
+			continue
+		}
+		for _, arg := range declArgs(decl.value(lemp)) {
+			_, _ = fmt.Fprintf(w, "%%%s %s\n", decl.keyword, arg)
+		}
+	}
+
+	// declare all the terminals so that they keep their numbers.
+	// symbol 0 is "$", which is always created first. the terminals that
+	// fill gaps in the numbers from %token are created again.
+	var names []string
+	for i := 1; i < lemp.nterminal; i++ {
+		sp := lemp.symbols[i]
+		if sp.filler {
+			continue
+		}
+		name := sp.name
+		if sp.number != 0 {
+			name += fmt.Sprintf(" = %d", sp.number)
+		}
+		if sp.spelling != "" {
+			name += " " + sp.spelling
+		}
+		names = append(names, name)
+	}
+	reprintList(w, "token", names)
+	for i := 1; i < lemp.nterminal; i++ {
+		reprintSymbolDecls(w, lemp.symbols[i], stripActions)
+	}
+
+	// print the precedence declarations from lowest to highest
+	maxPrec := 0
+	for i := 1; i < lemp.nterminal; i++ {
+		maxPrec = max(maxPrec, lemp.symbols[i].prec)
+	}
+	for prec := 1; prec <= maxPrec; prec++ {
+		var keyword string
+		names = nil
+		for i := 1; i < lemp.nterminal; i++ {
+			if sp := lemp.symbols[i]; sp.prec == prec {
+				switch sp.assoc {
+				case LEFT:
+					keyword = "left"
+				case RIGHT:
+					keyword = "right"
+				default:
+					keyword = "nonassoc"
+				}
+				names = append(names, sp.name)
+			}
+		}
+		reprintList(w, keyword, names)
+	}
+
+	// print the fallbacks, grouped by the token that is fallen back to
+	for i := 1; i < lemp.nterminal; i++ {
+		names = []string{lemp.symbols[i].name}
+		for j := 1; j < lemp.nterminal; j++ {
+			if lemp.symbols[j].fallback == lemp.symbols[i] {
+				names = append(names, lemp.symbols[j].name)
+			}
+		}
+		if len(names) > 1 {
+			reprintList(w, "fallback", names)
+		}
+	}
+	if lemp.wildcard != nil {
+		reprintList(w, "wildcard", []string{lemp.wildcard.name})
+	}
+
+	// print the token classes, which sort after the "{default}" symbol
+	for i := lemp.nsymbol + 1; i < len(lemp.symbols); i++ {
+		sp := lemp.symbols[i]
+		names = []string{sp.name}
+		for _, subsym := range sp.subsym {
+			names = append(names, subsym.name)
+		}
+		reprintList(w, "token_class", names)
+	}
+	reprintPatterns(w, lemp)
+
+	// print the rules in the order they were read. the rules that the parser
+	// adds for EBNF shorthand, mid-rule actions, instances of templates and
+	// start symbols are left out; the shorthand, the actions and the uses of
+	// the templates are written in the rules that use them instead.
+	var rules []*rule
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		if !rp.lhs.isSynthesized() {
+			rules = append(rules, rp)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].index < rules[j].index
+	})
+
+	// The nonterminals are numbered in the order they are first seen.
+	// A nonterminal may have been seen in a %type or %destructor before its
+	// first rule, so those declarations are written just before the rule that
+	// would otherwise number a nonterminal out of order. The helpers and the
+	// instances get their types from the parser, so they have none to write.
+	seen, declared := make(map[*symbol]bool), make(map[*symbol]bool)
+	next := lemp.nterminal
+	hasDecls := func(sp *symbol) bool {
+		return !sp.isSynthesized() && (sp.datatype != "" || (sp.destructor != "" && !stripActions))
+	}
+	printRule := func(rp *rule) {
+		symbols := rp.sourceSymbols()
+		firstUnseen := func() *symbol {
+			for _, sp := range symbols {
+				if sp.type_ == NONTERMINAL && !seen[sp] {
+					return sp
+				}
+			}
+			return nil
+		}
+		for ; next < lemp.nsymbol && seen[lemp.symbols[next]]; next++ {
+			//
+		}
+		for next < lemp.nsymbol && firstUnseen() != lemp.symbols[next] && hasDecls(lemp.symbols[next]) {
+			reprintSymbolDecls(w, lemp.symbols[next], stripActions)
+			declared[lemp.symbols[next]] = true
+			for seen[lemp.symbols[next]] = true; next < lemp.nsymbol && seen[lemp.symbols[next]]; next++ {
+				//
+			}
+		}
+		for _, sp := range symbols {
+			seen[sp] = true
+		}
+		reprintRule(w, rp, stripActions)
+	}
+	// a template is written with its rules before the first rule that
+	// follows its declaration
+	templates := lemp.templates
+	printTemplates := func(lineno int) {
+		for ; len(templates) != 0 && templates[0].lineno < lineno; templates = templates[1:] {
+			t := templates[0]
+			names := []string{t.name}
+			for _, p := range t.params {
+				names = append(names, p.name)
+			}
+			reprintList(w, "template", names)
+			reprintSymbolDecls(w, t.lhs, stripActions)
+			for _, rp := range t.rules {
+				printRule(rp)
+			}
+		}
+	}
+	_, _ = fmt.Fprintf(w, "\n")
+	for _, rp := range rules {
+		printTemplates(rp.ruleline)
+		printRule(rp)
+	}
+	printTemplates(math.MaxInt)
+	for i := lemp.nterminal; i < lemp.nsymbol; i++ {
+		if sp := lemp.symbols[i]; !declared[sp] && hasDecls(sp) {
+			reprintSymbolDecls(w, sp, stripActions)
+		}
+	}
+}
+
+// sourceSymbols returns the symbols of a rule in the order that the parser
+// creates them when it reads the rule as Reprint writes it. The symbols
+// inside EBNF shorthand and the arguments of a template come before the
+// helper or the instance that they make up.
+func (r *rule) sourceSymbols() []*symbol {
+	var symbols []*symbol
+	added := make(map[*symbol]bool)
+	var add func(sp *symbol)
+	add = func(sp *symbol) {
+		if added[sp] {
+			return
+		}
+		added[sp] = true
+		if sp.isSynthesized() {
+			var rules []*rule
+			for rp := sp.rule; rp != nil; rp = rp.nextlhs {
+				rules = append(rules, rp)
+			}
+			sort.Slice(rules, func(i, j int) bool {
+				return rules[i].index < rules[j].index
+			})
+			for _, rp := range rules {
+				for _, rhs := range rp.rhs {
+					add(rhs)
+				}
+			}
+		}
+		symbols = append(symbols, sp)
+	}
+	add(r.lhs)
+	for _, sp := range r.rhs {
+		add(sp)
+	}
+	return symbols
+}
+
+// reprintRule writes a rule the way it is written in the grammar. A mid-rule
+// action is written in place of its helper, and the other helpers and the
+// instances of templates are written as the shorthand or the use of the
+// template that they stand for. If stripActions is set, the code and the
+// aliases are left out.
+func reprintRule(w io.Writer, rp *rule, stripActions bool) {
+	_, _ = fmt.Fprintf(w, "%s", rp.lhs.name)
+	if rp.lhsalias != "" && !stripActions {
+		_, _ = fmt.Fprintf(w, "(%s)", rp.lhsalias)
+	}
+	_, _ = fmt.Fprintf(w, " ::=")
+	for i, sp := range rp.rhs {
+		if mid := sp.rule; mid != nil && mid.context != nil {
+			if !stripActions {
+				_, _ = fmt.Fprintf(w, " {%s", mid.code)
+			}
+			continue
+		}
+		_, _ = fmt.Fprintf(w, " %s", symbolText(sp))
+		if rp.rhsalias[i] != "" && !stripActions {
+			_, _ = fmt.Fprintf(w, "(%s)", rp.rhsalias[i])
+		}
+	}
+	_, _ = fmt.Fprintf(w, ".")
+	if rp.precsym != nil {
+		_, _ = fmt.Fprintf(w, " [%s]", rp.precsym.name)
+	}
+	if rp.code != "" && !stripActions {
+		_, _ = fmt.Fprintf(w, " {%s", rp.code)
+	}
+	_, _ = fmt.Fprintf(w, "\n")
+}
+
+// reprintSymbolDecls writes the %type and %destructor declarations for a symbol.
+func reprintSymbolDecls(w io.Writer, sp *symbol, stripActions bool) {
+	if sp.datatype != "" {
+		_, _ = fmt.Fprintf(w, "%%type %s %s\n", sp.name, sp.datatype)
+	}
+	if sp.destructor != "" && !stripActions {
+		for _, arg := range declArgs(sp.destructor) {
+			_, _ = fmt.Fprintf(w, "%%destructor %s %s\n", sp.name, arg)
+		}
+	}
+}
+
+// reprintPatterns writes the %token_pattern and %skip_pattern declarations
+// in the order they were read, which decides the pattern that the lexer
+// uses when two match the same text. The spellings are written with %token.
+func reprintPatterns(w io.Writer, lemp *lemon) {
+	for _, pp := range lemp.patterns {
+		if pp.literal {
+			continue
+		} else if pp.sp == nil {
+			_, _ = fmt.Fprintf(w, "%%skip_pattern %s\n", pp.text)
+		} else {
+			_, _ = fmt.Fprintf(w, "%%token_pattern %s %s\n", pp.sp.name, pp.text)
+		}
+	}
+}
+
+// reprintList writes a declaration that takes a list of symbols.
+// Long lists are wrapped.
+func reprintList(w io.Writer, keyword string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	line := "%" + keyword
+	for _, name := range names {
+		if len(line)+1+len(name) > 76 && strings.Contains(line, " ") {
+			_, _ = fmt.Fprintf(w, "%s\n", line)
+			line = strings.Repeat(" ", len(keyword)+1)
+		}
+		line += " " + name
+	}
+	_, _ = fmt.Fprintf(w, "%s.\n", line)
+}
+
+// declArgs splits the value of a declaration back into the arguments that
+// the parser appended to it, dropping the #line macros that it inserted.
+func declArgs(value string) (args []string) {
+	input := []byte(value)
+	for pos := 0; pos < len(input); {
+		if isspace(input[pos]) {
+			pos++
+		} else if bytes.HasPrefix(input[pos:], []byte("#line ")) {
+			end := bytes.IndexByte(input[pos:], '\n')
+			if end == -1 {
+				break
+			}
+			pos += end + 1
+		} else if codeBlock, _ := scanCodeBlock(input[pos:]); codeBlock != nil {
+			args = append(args, string(codeBlock))
+			pos += len(codeBlock)
+		} else if literal := scanStringLiteral(input[pos:]); literal != nil {
+			args = append(args, string(literal))
+			pos += len(literal)
+		} else {
+			end := pos + 1
+			for end < len(input) && !isspace(input[end]) && input[end] != '{' && input[end] != '"' {
+				end++
+			}
+			args = append(args, string(input[pos:end]))
+			pos = end
+		}
+	}
+	return args
+}
@@ -0,0 +1,183 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parseGrammar parses the text of a grammar the same way main does.
+func parseGrammar(t *testing.T, text string) *lemon {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "test.y")
+	if err := os.WriteFile(filename, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Symbol_init()
+	State_init()
+	Symbol_new("$")
+	lem := &lemon{filename: filename, nolinenosflag: true}
+	Parse(lem, map[string]string{})
+	if lem.errorcnt != 0 {
+		t.Fatalf("parse: want 0 errors, got %d\n", lem.errorcnt)
+	} else if err := numberGrammar(lem); err != nil {
+		t.Fatalf("parse: %v\n", err)
+	}
+	return lem
+}
+
+// modelOf returns a description of the symbols and rules of a grammar.
+func modelOf(lem *lemon) string {
+	sb := &strings.Builder{}
+	for _, sp := range lem.symbols {
+		_, _ = fmt.Fprintf(sb, "%d %s %s prec=%d %s type=%q dest=%q", sp.index, sp.name, sp.type_, sp.prec, sp.assoc, sp.datatype, declArgs(sp.destructor))
+		if sp.fallback != nil {
+			_, _ = fmt.Fprintf(sb, " fallback=%s", sp.fallback.name)
+		}
+		if sp.spelling != "" {
+			_, _ = fmt.Fprintf(sb, " spelling=%s", sp.spelling)
+		}
+		if sp.number != 0 || sp.filler {
+			_, _ = fmt.Fprintf(sb, " number=%d filler=%v", sp.number, sp.filler)
+		}
+		for _, subsym := range sp.subsym {
+			_, _ = fmt.Fprintf(sb, " |%s", subsym.name)
+		}
+		sb.WriteByte('\n')
+	}
+	for rp := lem.rule; rp != nil; rp = rp.next {
+		_, _ = fmt.Fprintf(sb, "%d %d ", rp.index, rp.iRule)
+		rp.print(sb)
+		if rp.precsym != nil {
+			_, _ = fmt.Fprintf(sb, " [%s]", rp.precsym.name)
+		}
+		_, _ = fmt.Fprintf(sb, " %q\n", rp.code)
+	}
+	_, _ = fmt.Fprintf(sb, "name=%q include=%q wildcard=%v\n", lem.name, declArgs(lem.include), lem.wildcard != nil)
+	return sb.String()
+}
+
+func TestReprint(t *testing.T) {
+	grammar := `
+%name Test
+%token_type {Token}
+%type stmt {Node *}
+%destructor stmt { free($$); }
+%include { #include "x.h" }
+%token A B C.
+%token PLUS "+".
+%left "+".
+%right POW.
+%fallback ID KW1 KW2.
+%wildcard ANY.
+%token_class idish ID|KW1.
+prog ::= stmts.
+stmts ::= stmts stmt(S). { use(S); }
+stmts ::= .
+stmt(X) ::= idish(N) PLUS|POW ANY. [POW] { X = N; }
+stmt ::= A B C KW1 KW2.
+stmt ::= "+" A.
+`
+	lem := parseGrammar(t, grammar)
+	want := modelOf(lem)
+	first := &bytes.Buffer{}
+	Reprint(first, lem, false)
+
+	lem = parseGrammar(t, first.String())
+	if got := modelOf(lem); got != want {
+		t.Errorf("reprint: want model\n%s\ngot\n%s\nfrom\n%s\n", want, got, first.String())
+	}
+	second := &bytes.Buffer{}
+	Reprint(second, lem, false)
+	// the header names the input file, so it is skipped in the comparison
+	if a, b := first.String()[strings.Index(first.String(), "\n"):], second.String()[strings.Index(second.String(), "\n"):]; a != b {
+		t.Errorf("reprint: want\n%s\ngot\n%s\n", a, b)
+	}
+
+	stripped := &bytes.Buffer{}
+	Reprint(stripped, lem, true)
+	for _, code := range []string{"use(S)", "X = N", "free(", "x.h", "(S)", "stmt(X)", "(N)"} {
+		if strings.Contains(stripped.String(), code) {
+			t.Errorf("reprint: want %q stripped, got\n%s\n", code, stripped.String())
+		}
+	}
+	if !strings.Contains(stripped.String(), "%type stmt {Node *}") {
+		t.Errorf("reprint: want %%type kept, got\n%s\n", stripped.String())
+	}
+}
+
+func TestReprintRules(t *testing.T) {
+	type test_case struct {
+		id      int
+		grammar string
+		expect  []string // lines of the reprint
+		reject  []string // text that must not be in the reprint, like the start of a rule
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			grammar: "block ::= LB(L) { open(L); } stmt RB. { close(); }\nstmt ::= X { mark(); } Y.\n",
+			expect:  []string{"block ::= LB(L) { open(L); } stmt RB. { close(); }", "stmt ::= X { mark(); } Y."},
+			reject:  []string{"\nmid_"},
+		},
+		{id: 2,
+			grammar: "%token_class idish ID|KW.\n%type num {int}\nlist ::= LP [item (COMMA item)*] RP.\nitem ::= num? idish+ (A | B C)(X). { use(X); }\nitem ::= A|B* C.\nnum ::= NUM.\n",
+			expect: []string{
+				"list ::= LP [item (COMMA item)*] RP.",
+				"item ::= num? idish+ (A | B C)(X). { use(X); }",
+				"item ::= A|B* C.",
+			},
+			reject: []string{"\nopt_", "\nstar_", "\nplus_", "\ngroup_", "%type opt_num"},
+		},
+		{id: 3,
+			grammar: "%template sep S X.\n%type sep {List}\nsep ::= X.\nsep ::= sep S X.\nprog ::= sep(COMMA, expr) SEMI.\nexpr ::= LP sep(SEMI, sep(COMMA, NUM)) RP.\n",
+			expect: []string{
+				"%template sep S X.",
+				"%type sep {List}",
+				"sep ::= X.",
+				"sep ::= sep S X.",
+				"prog ::= sep(COMMA, expr) SEMI.",
+				"expr ::= LP sep(SEMI, sep(COMMA, NUM)) RP.",
+			},
+			reject: []string{"\nsep_", "%type sep_"},
+		},
+		{id: 4,
+			grammar: "%start_symbol stmt\n%start_symbol expr\nstmt ::= expr SEMI.\nexpr ::= NUM.\n",
+			expect:  []string{"%start_symbol stmt", "%start_symbol expr", "stmt ::= expr SEMI.", "expr ::= NUM."},
+			reject:  []string{"\nentry_"},
+		},
+		{id: 5,
+			grammar: "%token A B C D = 12.\n%token PLUS = 4 \"+\".\n%type ANY {Any}\n%wildcard ANY.\nprog ::= A \"+\" B C D ANY.\n",
+			expect:  []string{"%token A B C PLUS = 4 \"+\" ANY D = 12.", "%type ANY {Any}"},
+		},
+	} {
+		lem := parseGrammar(t, tc.grammar)
+		want := modelOf(lem)
+		w := &bytes.Buffer{}
+		Reprint(w, lem, false)
+		lines := strings.Split(w.String(), "\n")
+		for _, line := range tc.expect {
+			found := false
+			for _, got := range lines {
+				found = found || got == line
+			}
+			if !found {
+				t.Errorf("%d: want %q in\n%s\n", tc.id, line, w.String())
+			}
+		}
+		for _, text := range tc.reject {
+			if strings.Contains(w.String(), text) {
+				t.Errorf("%d: want no %q in\n%s\n", tc.id, text, w.String())
+			}
+		}
+		lem = parseGrammar(t, w.String())
+		if got := modelOf(lem); got != want {
+			t.Errorf("%d: want model\n%s\ngot\n%s\nfrom\n%s\n", tc.id, want, got, w.String())
+		}
+	}
+}
@@ -13,27 +13,30 @@ import (
 // Each production rule in the grammar is stored in the following
 // structure.
 type rule struct {
-	lhs         *symbol   // Left-hand side of the rule
-	lhsalias    string    // Alias for the LHS (NULL if none)
-	lhsStart    bool      // True if left-hand side is the start symbol
-	ruleline    int       // Line number for the rule
-	nrhs        int       // Number of RHS symbols
-	rhs         []*symbol // The RHS symbols
-	rhsalias    []string  // An alias for each RHS symbol (NULL if none)
-	line        int       // Line number at which code begins
-	code        string    // The code executed when this rule is reduced
-	codePrefix  []byte    // Setup code before code[] above
-	codeSuffix  []byte    // Breakdown code after code[] above
-	precsym     *symbol   // Precedence symbol for this rule
-	index       int       // An index number for this rule
-	iRule       int       // Rule number as used in the generated tables
-	noCode      bool      // True if this rule has no associated C code
-	codeEmitted bool      // True if the code has been emitted already
-	canReduce   bool      // True if this rule is ever reduced
-	doesReduce  bool      // Reduce actions occur after optimization
-	neverReduce bool      // Reduce is theoretically possible, but prevented  by actions or other outside implementation
-	nextlhs     *rule     // Next rule with the same LHS
-	next        *rule     // Next rule in the global list
+	lhs          *symbol   // Left-hand side of the rule
+	lhsalias     string    // Alias for the LHS (NULL if none)
+	lhsStart     bool      // True if left-hand side is the start symbol
+	ruleline     int       // Line number for the rule
+	nrhs         int       // Number of RHS symbols
+	rhs          []*symbol // The RHS symbols
+	rhsalias     []string  // An alias for each RHS symbol (NULL if none)
+	line         int       // Line number at which code begins
+	code         string    // The code executed when this rule is reduced
+	codePrefix   []byte    // Setup code before code[] above
+	codeSuffix   []byte    // Breakdown code after code[] above
+	precsym      *symbol   // Precedence symbol for this rule
+	index        int       // An index number for this rule
+	iRule        int       // Rule number as used in the generated tables
+	noCode       bool      // True if this rule has no associated C code
+	codeEmitted  bool      // True if the code has been emitted already
+	canReduce    bool      // True if this rule is ever reduced
+	doesReduce   bool      // Reduce actions occur after optimization
+	neverReduce  bool      // Reduce is theoretically possible, but prevented  by actions or other outside implementation
+	nextlhs      *rule     // Next rule with the same LHS
+	context      []*symbol // For a mid-rule action, the symbols to its left in the enclosing rule
+	locations    []string  // The aliases whose locations are used in the code, like "@A"
+	contextAlias []string  // The aliases of the context, which the action may use
+	next         *rule     // Next rule in the global list
 }
 
 func (r *rule) length() int {
@@ -89,59 +92,17 @@ func (r *rule) sort() *rule {
 	return list[0]
 }
 
-// Reprint duplicates the input file without comments and without actions on rules
-func Reprint(w io.Writer, lemp *lemon) {
-	fmt.Printf("// Reprint of input file \"%s\".\n// Symbols:\n", lemp.filename)
-	maxlen := 10
-	for i := 0; i < lemp.nsymbol; i++ {
-		sp := lemp.symbols[i]
-		if len(sp.name) > maxlen {
-			maxlen = len(sp.name)
-		}
-	}
-	ncolumns := 76 / (maxlen + 5)
-	if ncolumns < 1 {
-		ncolumns = 1
-	}
-
-	// print headings as comments
-	skip := (lemp.nsymbol + ncolumns - 1) / ncolumns
-	for i := 0; i < skip; i++ {
-		_, _ = fmt.Fprintf(w, "//")
-		for j := i; j < lemp.nsymbol; j += skip {
-			sp := lemp.symbols[j]
-			if !(sp.index == j) {
-				panic("assert(sp.index == j)")
-			}
-			_, _ = fmt.Fprintf(w, " %3d %-*.*s", j, maxlen, maxlen, sp.name)
-		}
-		_, _ = fmt.Fprintf(w, "\n")
-	}
-
-	// print the rules
-	for rp := lemp.rule; rp != nil; rp = rp.next {
-		rp.print(w)
-		_, _ = fmt.Fprintf(w, ".")
-		if rp.precsym != nil {
-			_, _ = fmt.Fprintf(w, " [%s]", rp.precsym.name)
-		}
-		// if rp.code != "" {
-		//   fmt.Printf("\n    %s", rp.code)
-		//
-		_, _ = fmt.Fprintf(w, "\n")
-	}
-}
-
-// print the text of a rule
+// print the text of a rule, including the aliases.
 func (r *rule) print(out io.Writer) {
 	_, _ = fmt.Fprintf(out, "%s", r.lhs.name)
-	// if rp.lhsalias != "" {
-	//     _, _ = fmt.Fprintf(out, "(%s)", rp.lhsalias)
-	// }
+	if r.lhsalias != "" {
+		_, _ = fmt.Fprintf(out, "(%s)", r.lhsalias)
+	}
 	_, _ = fmt.Fprintf(out, " ::=")
 	for i := 0; i < r.nrhs; i++ {
 		sp := r.rhs[i]
-		if sp.type_ == MULTITERMINAL {
+		if sp.type_ == MULTITERMINAL && Symbol_find(sp.name) != sp {
+			// an anonymous multi-terminal from the rule, not a %token_class
 			_, _ = fmt.Fprintf(out, " %s", sp.subsym[0].name)
 			for j := 1; j < sp.nsubsym; j++ {
 				_, _ = fmt.Fprintf(out, "|%s", sp.subsym[j].name)
@@ -149,9 +110,9 @@ func (r *rule) print(out io.Writer) {
 		} else {
 			_, _ = fmt.Fprintf(out, " %s", sp.name)
 		}
-		// if rp.rhsalias[i] != nil {
-		//     _, _ = fmt.Fprintf(out, "(%s)", rp.rhsalias[i])
-		// }
+		if r.rhsalias[i] != "" {
+			_, _ = fmt.Fprintf(out, "(%s)", r.rhsalias[i])
+		}
 	}
 }
 
@@ -167,12 +128,12 @@ func (r *rule) printCursor(fp io.Writer, iCursor int) {
 		}
 		sp := r.rhs[i]
 		if sp.type_ == MULTITERMINAL {
-			_, _ = fmt.Fprintf(fp, " %s", sp.subsym[0].name)
+			_, _ = fmt.Fprintf(fp, " %s", sp.subsym[0].displayName())
 			for j := 1; j < sp.nsubsym; j++ {
-				_, _ = fmt.Fprintf(fp, "|%s", sp.subsym[j].name)
+				_, _ = fmt.Fprintf(fp, "|%s", sp.subsym[j].displayName())
 			}
 		} else {
-			_, _ = fmt.Fprintf(fp, " %s", sp.name)
+			_, _ = fmt.Fprintf(fp, " %s", sp.displayName())
 		}
 	}
 }
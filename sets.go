@@ -3,7 +3,12 @@
 
 package main
 
-import "github.com/mdhender/lemon/internal/sets"
+import (
+	"fmt"
+	"github.com/mdhender/lemon/internal/sets"
+	"io"
+	"strings"
+)
 
 // FindFirstSets finds all non-terminals which will generate lambda (a/k/a the empty string).
 // It then goes back and compute the first sets of every non-terminal. This is
@@ -79,3 +84,111 @@ func FindFirstSets(lemp *lemon) {
 		}
 	}
 }
+
+// FindSymbolFollowSets computes the follow set of every nonterminal. It
+// must be called after FindFirstSets.
+//
+// The follow set is the set of all terminal symbols which can come right
+// after a string generated by that non-terminal in some sentence. Unlike
+// the follow sets of the configurations, it doesn't depend on the state.
+func FindSymbolFollowSets(lemp *lemon) map[*symbol]*sets.Set {
+	follow := make(map[*symbol]*sets.Set)
+	for i := lemp.nterminal; i < lemp.nsymbol; i++ {
+		follow[lemp.symbols[i]] = sets.New(lemp.nterminal + 1)
+	}
+	// the end of input follows the start symbols
+	for _, sp := range lemp.startSymbols() {
+		follow[sp].Add(0)
+	}
+
+	for setsAdded := true; setsAdded; {
+		setsAdded = false
+		for rp := lemp.rule; rp != nil; rp = rp.next {
+			for i := 0; i < rp.nrhs; i++ {
+				s1 := rp.rhs[i]
+				if s1.type_ != NONTERMINAL {
+					continue
+				}
+				// add the first set of the rest of the rule and, if all of
+				// the rest can be empty, the follow set of the lhs.
+				j := i + 1
+				for ; j < rp.nrhs; j++ {
+					s2 := rp.rhs[j]
+					if s2.type_ == TERMINAL {
+						if follow[s1].Add(s2.index) {
+							setsAdded = true
+						}
+						break
+					} else if s2.type_ == MULTITERMINAL {
+						for k := 0; k < s2.nsubsym; k++ {
+							if follow[s1].Add(s2.subsym[k].index) {
+								setsAdded = true
+							}
+						}
+						break
+					}
+					if follow[s1].Union(s2.firstset) {
+						setsAdded = true
+					}
+					if s2.lambda == false {
+						break
+					}
+				}
+				if j == rp.nrhs && follow[s1].Union(follow[rp.lhs]) {
+					setsAdded = true
+				}
+			}
+		}
+	}
+	return follow
+}
+
+// ReportSets writes whether each nonterminal is nullable, and its first
+// and follow sets. If name is not empty, only that nonterminal is written.
+// Nonterminals without rules are left out.
+func ReportSets(w io.Writer, lemp *lemon, name string) error {
+	var list []*symbol
+	if name != "" {
+		sp := Symbol_find(name)
+		if sp == nil {
+			return fmt.Errorf("there is no symbol %q in the grammar", name)
+		} else if sp.type_ != NONTERMINAL || sp.index < lemp.nterminal {
+			return fmt.Errorf("%q is a terminal; its first set is itself", name)
+		}
+		list = append(list, sp)
+	} else {
+		for i := lemp.nterminal; i < lemp.nsymbol; i++ {
+			if lemp.symbols[i].rule != nil {
+				list = append(list, lemp.symbols[i])
+			}
+		}
+	}
+
+	names := func(set *sets.Set) string {
+		var names []string
+		for i := 0; i < lemp.nterminal; i++ {
+			if set.Has(i) {
+				names = append(names, lemp.symbols[i].displayName())
+			}
+		}
+		if len(names) == 0 {
+			return "(empty)"
+		}
+		return strings.Join(names, " ")
+	}
+	follow := FindSymbolFollowSets(lemp)
+	for n, sp := range list {
+		if n != 0 {
+			_, _ = fmt.Fprintf(w, "\n")
+		}
+		nullable := "no"
+		if sp.lambda {
+			nullable = "yes"
+		}
+		_, _ = fmt.Fprintf(w, "%s\n", sp.name)
+		_, _ = fmt.Fprintf(w, "  nullable: %s\n", nullable)
+		_, _ = fmt.Fprintf(w, "  first:    %s\n", names(sp.firstset))
+		_, _ = fmt.Fprintf(w, "  follow:   %s\n", names(follow[sp]))
+	}
+	return nil
+}
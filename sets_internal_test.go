@@ -0,0 +1,46 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReportSets(t *testing.T) {
+	type test_case struct {
+		id      int
+		grammar string
+		name    string
+		expect  string
+	}
+	list := "prog ::= list.\nlist ::= list item SEMI.\nlist ::= .\nitem ::= X opt.\nopt ::= .\nopt ::= Y|Z.\n"
+	for _, tc := range []test_case{
+		{id: 1, grammar: list, name: "opt", expect: "opt\n  nullable: yes\n  first:    Y Z\n  follow:   SEMI\n"},
+		{id: 2, grammar: list, name: "list", expect: "list\n  nullable: yes\n  first:    X\n  follow:   $ X\n"},
+		{id: 3, grammar: list, name: "X", expect: "error"},
+		{id: 4, grammar: list, name: "nothing", expect: "error"},
+		{id: 5,
+			grammar: "prog ::= s.\ns ::= IF E THEN s.\ns ::= IF E THEN s ELSE s.\ns ::= X.\n",
+			expect:  "prog\n  nullable: no\n  first:    IF X\n  follow:   $\n\ns\n  nullable: no\n  first:    IF X\n  follow:   $ ELSE\n",
+		},
+		{id: 6,
+			grammar: "prog ::= a.\na ::= b.\nb ::= .\n",
+			name:    "a",
+			expect:  "a\n  nullable: yes\n  first:    (empty)\n  follow:   $\n",
+		},
+	} {
+		lem := parseGrammar(t, tc.grammar)
+		FindRulePrecedences(lem.rule)
+		FindFirstSets(lem)
+		w := &bytes.Buffer{}
+		got := "error"
+		if err := ReportSets(w, lem, tc.name); err == nil {
+			got = w.String()
+		}
+		if got != tc.expect {
+			t.Errorf("%d: want\n%s\n%d: got\n%s\n", tc.id, tc.expect, tc.id, got)
+		}
+	}
+}
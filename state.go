@@ -3,6 +3,12 @@
 
 package main
 
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
 // Each state of the generated parser's finite state machine is encoded
 // as an instance of the following structure.
 type state struct {
@@ -17,3 +23,243 @@ type state struct {
 	pDfltReduce       *rule   // The default REDUCE rule.
 	autoReduce        bool    // True if this is an auto-reduce state
 }
+
+// x3a is the global table of states, keyed by their basis configurations.
+// x3aOrder holds the states in the order they were created.
+var (
+	x3a      = make(map[string]*state)
+	x3aOrder []*state
+)
+
+// State_init empties the global table of states.
+func State_init() {
+	x3a, x3aOrder = make(map[string]*state), nil
+}
+
+// stateKey returns the key for a state with the given (sorted) basis.
+func stateKey(bp *config) string {
+	sb := &strings.Builder{}
+	for ; bp != nil; bp = bp.bp {
+		_, _ = fmt.Fprintf(sb, "%d.%d;", bp.rp.index, bp.dot)
+	}
+	return sb.String()
+}
+
+// State_find returns the state with the given basis, or nil.
+func State_find(bp *config) *state {
+	return x3a[stateKey(bp)]
+}
+
+// State_insert adds a state to the table of states.
+func State_insert(stp *state, bp *config) {
+	x3a[stateKey(bp)] = stp
+	x3aOrder = append(x3aOrder, stp)
+}
+
+// State_arrayof returns the states in the order they were created.
+func State_arrayof() []*state {
+	return append([]*state{}, x3aOrder...)
+}
+
+// FindStates computes all LR(0) states for the grammar. Links are added
+// between some states so that the LR(1) follow sets can be computed later.
+func FindStates(lemp *lemon) {
+	Configlist_init(lemp)
+
+	// find the start symbols
+	if lemp.startRule == nil {
+		ErrorMsg(lemp.filename, 0, "Internal error - no start rule")
+		os.Exit(1)
+	}
+	for _, name := range lemp.starts {
+		if sp := Symbol_find(name); sp == nil || sp.rule == nil {
+			ErrorMsg(lemp.filename, 0, "The specified start symbol \"%s\" is not a nonterminal of the grammar.", name)
+			lemp.errorcnt++
+		}
+	}
+	lemp.entries = lemp.findEntryPoints()
+
+	// Make sure the start symbol doesn't occur on the right-hand side of any rule.
+	// Report an error if it does. (YACC would generate a new start symbol in this case.)
+	// When there are several start symbols, the parser accepts a helper instead.
+	for _, ep := range lemp.entries {
+		for rp := lemp.rule; rp != nil; rp = rp.next {
+			for i := 0; i < rp.nrhs; i++ {
+				if rp.rhs[i] == ep.goal { // FIX ME:  Deal with multiterminals
+					ErrorMsg(lemp.filename, 0, "The start symbol \"%s\" occurs on the right-hand side of a rule. This will result in a parser which does not work properly.", ep.goal.name)
+					lemp.errorcnt++
+				}
+			}
+		}
+	}
+
+	// The basis configuration set for the start state of each entry point
+	// is all rules which have its start symbol as their left-hand side.
+	// The first start state is state 0. All other states will be computed
+	// automatically during the computation of the start states.
+	for _, ep := range lemp.entries {
+		Configlist_reset()
+		for rp := ep.goal.rule; rp != nil; rp = rp.nextlhs {
+			rp.lhsStart = true
+			newcfp := Configlist_addbasis(rp, 0)
+			newcfp.fws.Add(0)
+		}
+		ep.stp = getstate(lemp)
+	}
+}
+
+// getstate returns a pointer to a state which is described by the
+// configuration list which has been built from calls to Configlist_add.
+func getstate(lemp *lemon) *state {
+	// extract the sorted basis of the new state.
+	Configlist_sortbasis()
+	bp := Configlist_basis()
+
+	// get a state with the same basis
+	stp := State_find(bp)
+	if stp != nil {
+		// A state with the same basis already exists! Copy all the follow-set
+		// propagation links from the state under construction into the
+		// preexisting state, then return a pointer to the preexisting state.
+		for x, y := bp, stp.bp; x != nil && y != nil; x, y = x.bp, y.bp {
+			Plink_copy(&y.bplp, x.bplp)
+			x.fplp, x.bplp = nil, nil
+		}
+		Configlist_return()
+		return stp
+	}
+
+	// this really is a new state. construct all the details.
+	Configlist_closure(lemp) // Compute the configuration closure
+	Configlist_sort()        // Sort the configuration closure
+	stp = &state{
+		bp:       bp,                  // Remember the configuration basis
+		cfp:      Configlist_return(), // Remember the configuration closure
+		statenum: lemp.nstate,         // Every state gets a sequence number
+	}
+	lemp.nstate++
+	State_insert(stp, stp.bp) // Add to the state table
+	buildshifts(lemp, stp)    // Recursively compute successor states
+	return stp
+}
+
+// same_symbol returns true if two symbols are the same.
+func same_symbol(a, b *symbol) bool {
+	if a == b {
+		return true
+	} else if a.type_ != MULTITERMINAL || b.type_ != MULTITERMINAL || a.nsubsym != b.nsubsym {
+		return false
+	}
+	for i := 0; i < a.nsubsym; i++ {
+		if a.subsym[i] != b.subsym[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// buildshifts constructs all successor states to the given state.
+// A "successor" state is any state which can be reached by a shift action.
+func buildshifts(lemp *lemon, stp *state) {
+	// Each configuration becomes complete after it contributes to a successor
+	// state. Initially, all configurations are incomplete.
+	for cfp := stp.cfp; cfp != nil; cfp = cfp.next {
+		cfp.status = INCOMPLETE
+	}
+
+	// loop through all configurations of the state "stp"
+	for cfp := stp.cfp; cfp != nil; cfp = cfp.next {
+		if cfp.status == COMPLETE { // Already used by inner loop
+			continue
+		} else if cfp.dot >= cfp.rp.nrhs { // Can't shift this config
+			continue
+		}
+		Configlist_reset()        // Reset the new config set
+		sp := cfp.rp.rhs[cfp.dot] // Symbol after the dot
+
+		// For every configuration in the state "stp" which has the symbol "sp"
+		// following its dot, add the same configuration to the basis set under
+		// construction but with the dot shifted one symbol to the right.
+		for bcfp := cfp; bcfp != nil; bcfp = bcfp.next {
+			if bcfp.status == COMPLETE { // Already used
+				continue
+			} else if bcfp.dot >= bcfp.rp.nrhs { // Can't shift this one
+				continue
+			}
+			bsp := bcfp.rp.rhs[bcfp.dot] // Get symbol after dot
+			if !same_symbol(bsp, sp) {   // Must be same as for "cfp"
+				continue
+			}
+			bcfp.status = COMPLETE // Mark this config as used
+			newcfg := Configlist_addbasis(bcfp.rp, bcfp.dot+1)
+			Plink_add(&newcfg.bplp, bcfp)
+		}
+
+		// Get a pointer to the state described by the basis configuration set
+		// constructed in the preceding loop.
+		newstp := getstate(lemp)
+
+		// The state "newstp" is reached from the state "stp" by a shift action on the symbol "sp"
+		if sp.type_ == MULTITERMINAL {
+			for i := 0; i < sp.nsubsym; i++ {
+				Action_add(&stp.ap, SHIFT, sp.subsym[i], newstp, nil)
+			}
+		} else {
+			Action_add(&stp.ap, SHIFT, sp, newstp, nil)
+		}
+	}
+}
+
+// FindLinks constructs the propagation links.
+func FindLinks(lemp *lemon) {
+	// Housekeeping detail: add to every propagate link a pointer back to
+	// the state to which the link is attached.
+	for i := 0; i < lemp.nstate; i++ {
+		stp := lemp.sorted[i]
+		for cfp := stp.cfp; cfp != nil; cfp = cfp.next {
+			cfp.stp = stp
+		}
+	}
+
+	// Convert all backlinks into forward links. Only the forward links
+	// are used in the follow-set computation.
+	for i := 0; i < lemp.nstate; i++ {
+		stp := lemp.sorted[i]
+		for cfp := stp.cfp; cfp != nil; cfp = cfp.next {
+			for plp := cfp.bplp; plp != nil; plp = plp.next {
+				other := plp.cfp
+				Plink_add(&other.fplp, cfp)
+			}
+		}
+	}
+}
+
+// FindFollowSets computes all followsets.
+//
+// A followset is the set of all symbols which can come immediately after
+// a configuration.
+func FindFollowSets(lemp *lemon) {
+	for i := 0; i < lemp.nstate; i++ {
+		for cfp := lemp.sorted[i].cfp; cfp != nil; cfp = cfp.next {
+			cfp.status = INCOMPLETE
+		}
+	}
+
+	for progress := true; progress; {
+		progress = false
+		for i := 0; i < lemp.nstate; i++ {
+			for cfp := lemp.sorted[i].cfp; cfp != nil; cfp = cfp.next {
+				if cfp.status == COMPLETE {
+					continue
+				}
+				for plp := cfp.fplp; plp != nil; plp = plp.next {
+					if plp.cfp.fws.Union(cfp.fws) {
+						plp.cfp.status = INCOMPLETE
+						progress = true
+					}
+				}
+				cfp.status = COMPLETE
+			}
+		}
+	}
+}
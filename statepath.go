@@ -0,0 +1,97 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// shortestPath returns the shortest list of grammar symbols that takes the
+// parser from a start state to the target state, or false if the target
+// can't be reached. Only the shifts that the parser takes are followed; a
+// shift that lost a conflict to a reduce by precedence is not. It must be
+// called after FindActions.
+func (lemp *lemon) shortestPath(target *state) ([]*symbol, bool) {
+	type step struct {
+		from *state
+		sp   *symbol
+	}
+	starts := lemp.startStates()
+	parent := make(map[*state]step)
+	for _, stp := range starts {
+		parent[stp] = step{}
+	}
+	for queue := starts; len(queue) != 0; queue = queue[1:] {
+		stp := queue[0]
+		if stp == target {
+			break
+		}
+		for ap := stp.ap; ap != nil; ap = ap.next {
+			switch ap.type_ {
+			case SHIFT, SSCONFLICT:
+			default:
+				continue
+			}
+			if _, ok := parent[ap.x.stp]; ok {
+				continue
+			}
+			parent[ap.x.stp] = step{from: stp, sp: ap.sp}
+			queue = append(queue, ap.x.stp)
+		}
+	}
+	if _, ok := parent[target]; !ok {
+		return nil, false
+	}
+	var path []*symbol
+	for stp := target; parent[stp].from != nil; stp = parent[stp].from {
+		path = append([]*symbol{parent[stp].sp}, path...)
+	}
+	return path, true
+}
+
+// ReportStatePath writes the basis of a state, the shortest list of symbols
+// that reaches it, and an example of the terminals for that list.
+func ReportStatePath(w io.Writer, lemp *lemon, statenum int) error {
+	if statenum < 0 || statenum >= len(lemp.sorted) {
+		return fmt.Errorf("state %d does not exist (the parser has states 0 to %d)", statenum, len(lemp.sorted)-1)
+	}
+	stp := lemp.sorted[statenum]
+	_, _ = fmt.Fprintf(w, "State %d:\n", stp.statenum)
+	for cfp := stp.bp; cfp != nil; cfp = cfp.bp {
+		_, _ = fmt.Fprintf(w, "    ")
+		cfp.rp.printCursor(w, cfp.dot)
+		_, _ = fmt.Fprintf(w, "\n")
+	}
+	path, ok := lemp.shortestPath(stp)
+	if !ok {
+		_, _ = fmt.Fprintf(w, "Path: none; the state can't be reached from a start state.\n")
+		return nil
+	}
+	if len(path) == 0 {
+		_, _ = fmt.Fprintf(w, "Path: empty; this is the start state.\n")
+		return nil
+	}
+	_, _ = fmt.Fprintf(w, "Path: %s\n", symbolNames(path))
+	yields := shortestYields(lemp)
+	var example []*symbol
+	for _, sp := range path {
+		if sp.type_ == MULTITERMINAL {
+			example = append(example, sp.subsym[0])
+			continue
+		}
+		y, ok := yields[sp]
+		if !ok {
+			_, _ = fmt.Fprintf(w, "Example: none; \"%s\" can't derive a string of terminals.\n", sp.name)
+			return nil
+		}
+		example = append(example, y...)
+	}
+	if len(example) == 0 {
+		_, _ = fmt.Fprintf(w, "Example: the empty input.\n")
+		return nil
+	}
+	_, _ = fmt.Fprintf(w, "Example: %s\n", symbolNames(example))
+	return nil
+}
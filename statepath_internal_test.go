@@ -0,0 +1,61 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReportStatePath(t *testing.T) {
+	type test_case struct {
+		id       int
+		grammar  string
+		statenum int
+		expect   string
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			grammar:  "prog ::= s.\ns ::= A a D.\ns ::= B b D.\na ::= C.\nb ::= C.\n",
+			statenum: 0,
+			expect:   "State 0:\n    prog ::= * s\nPath: empty; this is the start state.\n",
+		},
+		{id: 2,
+			grammar:  "prog ::= s.\ns ::= A a D.\ns ::= B b D.\na ::= C.\nb ::= C.\n",
+			statenum: 3,
+			expect:   "State 3:\n    s ::= A a * D\nPath: A a\nExample: A C\n",
+		},
+		{id: 3,
+			grammar:  "prog ::= list END.\nlist ::= list item.\nlist ::= .\nitem ::= X|Y.\n",
+			statenum: 1,
+			expect:   "State 1:\n    prog ::= list * END\n    list ::= list * item\nPath: list\nExample: the empty input.\n",
+		},
+		{id: 4,
+			grammar:  "prog ::= list END.\nlist ::= list item.\nlist ::= .\nitem ::= X|Y.\n",
+			statenum: 4,
+			expect:   "State 4:\n    item ::= X|Y *\nPath: list X\nExample: X\n",
+		},
+		{id: 5, // the only shift into state 4 lost to a reduce by precedence
+			grammar:  "%left PLUS.\nprog ::= e.\ne ::= e PLUS e.\ne ::= e PLUS e PLUS ID.\ne ::= NUM.\n",
+			statenum: 4,
+			expect:   "State 4:\n    e ::= e PLUS * e\n    e ::= e PLUS * e PLUS ID\n    e ::= e PLUS e PLUS * ID\nPath: none; the state can't be reached from a start state.\n",
+		},
+	} {
+		lem := parseGrammar(t, tc.grammar)
+		analyzeGrammar(lem)
+		w := &bytes.Buffer{}
+		if err := ReportStatePath(w, lem, tc.statenum); err != nil {
+			t.Errorf("%d: want nil: got %v\n", tc.id, err)
+		} else if w.String() != tc.expect {
+			t.Errorf("%d: want\n%s%d: got\n%s", tc.id, tc.expect, tc.id, w.String())
+		}
+	}
+
+	lem := parseGrammar(t, "prog ::= NUM.\n")
+	analyzeGrammar(lem)
+	if err := ReportStatePath(&bytes.Buffer{}, lem, 99); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("missing state: want error: got %v\n", err)
+	}
+}
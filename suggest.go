@@ -0,0 +1,104 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"sort"
+)
+
+// editDistance returns the number of single character insertions,
+// deletions, substitutions and transpositions of neighboring characters
+// needed to turn one string into the other.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// maxTypoDistance returns the largest edit distance at which one name is
+// taken to be a misspelling of another. Short names need a closer match
+// or every short name would look like a typo of every other one; names
+// of one or two characters are never taken to be misspelled.
+func maxTypoDistance(name string) int {
+	if len(name) <= 2 {
+		return 0
+	} else if len(name) <= 4 {
+		return 1
+	}
+	return 2
+}
+
+// closestMatch returns the candidate that is nearest to name, or the empty
+// string if none of them are close enough to be a likely misspelling.
+// Ties are broken by taking the candidate that sorts first.
+func closestMatch(name string, candidates []string) string {
+	best, bestDistance := "", maxTypoDistance(name)+1
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		if d := editDistance(name, candidate); d < bestDistance || (d == bestDistance && candidate < best) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// declKeywords returns the declaration keywords in sorted order.
+func declKeywords() []string {
+	var keywords []string
+	for keyword := range declShapes {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	return keywords
+}
+
+// FindMisspelledSymbols warns about symbols that are used only once and
+// are spelled almost the same as another symbol. These are usually typos.
+//
+// A symbol that is used only once is only compared to symbols that are
+// used more than once; two symbols that are each used once, like LPAREN
+// and RPAREN, are more likely a pair than a typo. The exception is a
+// nonterminal with no rules, which can't be anything but a mistake.
+// Terminals are only compared to terminals and nonterminals to nonterminals.
+// The helpers for EBNF shorthand are named by lemon, the tokens of an
+// imported vocabulary are named by another grammar, and the tokens with a
+// %fallback are usually keywords that look alike, so they are skipped.
+func FindMisspelledSymbols(lemp *lemon) {
+	for i := 1; i < lemp.nsymbol; i++ {
+		sp := lemp.symbols[i]
+		if sp.useCnt != 1 || sp == lemp.errsym || sp.helper != "" || sp.vocabulary != "" || sp.fallback != nil {
+			continue
+		}
+		noRules := sp.type_ == NONTERMINAL && sp.rule == nil
+		var candidates []string
+		for j := 1; j < lemp.nsymbol; j++ {
+			if other := lemp.symbols[j]; other != lemp.errsym && other.helper == "" && other.fallback == nil && other.type_ == sp.type_ && (other.useCnt > 1 || noRules) {
+				candidates = append(candidates, other.name)
+			}
+		}
+		if match := closestMatch(sp.name, candidates); match != "" {
+			lemp.warningMsg(MISSPELLED_SYMBOL, lemp.filename, sp.lineno, "Symbol \"%s\" is used only once. Did you mean \"%s\"?", sp.name, match)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	type test_case struct {
+		id     int
+		a, b   string
+		expect int
+	}
+	for _, tc := range []test_case{
+		{id: 1, a: "expr", b: "expr", expect: 0},
+		{id: 2, a: "expr", b: "exrp", expect: 1},
+		{id: 3, a: "PLUS", b: "PLSU", expect: 1},
+		{id: 4, a: "tokn", b: "token", expect: 1},
+		{id: 5, a: "", b: "abc", expect: 3},
+		{id: 6, a: "LPAREN", b: "RPAREN", expect: 1},
+		{id: 7, a: "kitten", b: "sitting", expect: 3},
+	} {
+		if got := editDistance(tc.a, tc.b); got != tc.expect {
+			t.Errorf("%d: %q %q: want %d: got %d\n", tc.id, tc.a, tc.b, tc.expect, got)
+		}
+	}
+}
+
+func TestClosestMatch(t *testing.T) {
+	type test_case struct {
+		id     int
+		name   string
+		expect string
+	}
+	keywords := declKeywords()
+	for _, tc := range []test_case{
+		{id: 1, name: "tokn", expect: "token"},
+		{id: 2, name: "token_tpye", expect: "token_type"},
+		{id: 3, name: "nonasoc", expect: "nonassoc"},
+		{id: 4, name: "lft", expect: "left"},
+		{id: 5, name: "bogus", expect: ""},
+		{id: 6, name: "token", expect: ""},
+	} {
+		if got := closestMatch(tc.name, keywords); got != tc.expect {
+			t.Errorf("%d: %q: want %q: got %q\n", tc.id, tc.name, tc.expect, got)
+		}
+	}
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"fmt"
 	"github.com/mdhender/lemon/internal/sets"
 	"sort"
 	"unicode"
@@ -24,17 +25,48 @@ type symbol struct {
 	destructor string      // Code which executes whenever this symbol is popped from the stack during error processing
 	destLineno int         // Line number for start of destructor.  Set to -1 for duplicate destructors.
 	datatype   string      // The data type of information held by this object. Only used if type==NONTERMINAL
+	dtLineno   int         // Line number of the %type declaration
 	dtnum      int         // The data type number.  In the parser, the value stack is a union.  The .yy%d element of this union is the correct data type for this object
 	bContent   bool        // True if this symbol ever carries content - if it is ever more than just syntax
+	lineno     int         // Line number where the symbol is first seen
+	precUsed   bool        // True if the precedence of this symbol resolves a conflict
+	helper     string      // For a nonterminal created from EBNF shorthand, the shorthand, like "x*"
+	instance   string      // For a nonterminal created from a template, the use, like "list(COMMA, expr)"
+	entry      *symbol     // For the helper of a start symbol, the start symbol
+	spelling   string      // For a terminal, the quoted literal from %token that may be used in its place, like "+"
+	number     int         // For a terminal, the number from %token NAME = N, or 0
+	filler     bool        // True for a terminal that fills a gap in the numbers from %token
+	vocabulary string      // For a terminal, the token vocabulary that defines it, or ""
 
 	// The following fields are used by MULTITERMINALs only
 	nsubsym int       // Number of constituent symbols in the MULTI
 	subsym  []*symbol // Array of constituent symbols
 }
 
+// displayName returns the spelling of a terminal if it has one.
+// Otherwise, it returns the name of the symbol.
+func (s *symbol) displayName() string {
+	if s.spelling != "" {
+		return s.spelling
+	}
+	return s.name
+}
+
+// isSynthesized returns true for a nonterminal that the parser creates,
+// like the helper for EBNF shorthand or a start symbol and the instance
+// of a template.
+func (s *symbol) isSynthesized() bool {
+	return s.helper != "" || s.instance != "" || s.entry != nil
+}
+
 // create a global symbol table
 var x2a = make(map[string]*symbol)
 
+// Symbol_init empties the global symbol table.
+func Symbol_init() {
+	x2a = make(map[string]*symbol)
+}
+
 // Symbol_new returns a pointer to the (terminal or nonterminal) named symbol.
 // Create a new symbol if this is the first time "x" has been seen.
 //
@@ -82,6 +114,57 @@ func Symbol_find(name string) *symbol {
 	return x2a[name]
 }
 
+// numberTokens gives each terminal with a number from %token NAME = N that
+// number as its index, and the other terminals the numbers that are left,
+// in the order they were first seen. A number that no terminal takes is
+// given to an unused terminal so that the numbers after it don't move.
+// It must be called before Symbol_sortedSlice, which keeps the terminals
+// in the order of their indexes.
+func numberTokens() {
+	var terminals []*symbol
+	maxNumber := 0
+	for _, sp := range Symbol_arrayOf() {
+		if sp.type_ == TERMINAL {
+			terminals = append(terminals, sp)
+			maxNumber = max(maxNumber, sp.number)
+		}
+	}
+	if maxNumber == 0 {
+		return
+	}
+	sort.Slice(terminals, func(i, j int) bool {
+		return terminals[i].index < terminals[j].index
+	})
+	taken := make(map[int]bool)
+	for _, sp := range terminals {
+		if sp.number != 0 {
+			taken[sp.number] = true
+		}
+	}
+	next := 1
+	for _, sp := range terminals {
+		if sp.number != 0 {
+			sp.index = sp.number
+			continue
+		}
+		for taken[next] {
+			next++
+		}
+		sp.index, taken[next] = next, true
+	}
+	for n := 1; n < maxNumber; n++ {
+		if taken[n] {
+			continue
+		}
+		name := fmt.Sprintf("UNUSED_%d", n)
+		for Symbol_find(name) != nil {
+			name += "_"
+		}
+		sp := Symbol_new(name)
+		sp.index, sp.filler, sp.useCnt = n, true, 0
+	}
+}
+
 // Symbol_sortedSlice has the side effect of changing the symbol indexes.
 func Symbol_sortedSlice() []*symbol {
 	symbols := Symbol_arrayOf()
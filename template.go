@@ -0,0 +1,281 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A template is a nonterminal with parameters. It is declared with
+//
+//	%template separated_list SEP item.
+//
+// and its rules are written like any other rules, using the parameters
+// as symbols and the name of the template, without arguments, for the
+// instance being defined:
+//
+//	separated_list ::= item.
+//	separated_list ::= separated_list SEP item.
+//
+// In its own rules, the name of the template may have an alias like any
+// other symbol:
+//
+//	separated_list(L) ::= separated_list(M) SEP item(I). { L = add(M, I); }
+//
+// There, a single name in parentheses after the name of the template is
+// always an alias, even when the template has one parameter. To use the
+// template with other arguments in its own rules, give it all of them, like
+// separated_list(SEMI, item), or an argument that isn't a single name.
+//
+// A rule uses the template by giving it arguments, like
+// separated_list(COMMA, expr). Each distinct list of arguments creates an
+// ordinary nonterminal, named separated_list_COMMA_expr, with a copy of the
+// rules of the template. The rules of a template may use other templates,
+// and a %type or %destructor for the template applies to every instance.
+// The %template declaration must come before the template is used.
+
+// ruleTemplate is a nonterminal with parameters.
+type ruleTemplate struct {
+	name   string
+	lineno int       // where the template is declared
+	lhs    *symbol   // stands for the instance in the rules of the template
+	params []*symbol // stand for the arguments in the rules of the template
+	rules  []*rule
+}
+
+// templateCall is the use of a template in the rules of a template, where
+// the arguments may be parameters that are replaced when it is expanded.
+type templateCall struct {
+	tmpl   *ruleTemplate
+	args   []*symbol
+	lineno int
+}
+
+// templateInstance is a nonterminal created from a template.
+type templateInstance struct {
+	sp   *symbol
+	tmpl *ruleTemplate
+	args []*symbol
+}
+
+// maxTemplateInstances stops a template that uses itself with ever longer
+// arguments, like t(X) ::= t(u(X)).
+const maxTemplateInstances = 1000
+
+// declareTemplate adds a template. Its parameters are added as they are read.
+func (psp *pstate) declareTemplate(name string) {
+	if Symbol_find(name) != nil || psp.templates[name] != nil {
+		ErrorMsg(psp.filename, psp.tokenlineno, "symbol %q already used.", name)
+		psp.errorcnt++
+		psp.state = RESYNC_AFTER_DECL_ERROR
+		return
+	}
+	if psp.templates == nil {
+		psp.templates = make(map[string]*ruleTemplate)
+		psp.calls = make(map[*symbol]*templateCall)
+	}
+	psp.tmpl = &ruleTemplate{name: name, lineno: psp.tokenlineno, lhs: placeholder(name)}
+	psp.templates[name] = psp.tmpl
+	psp.gp.templates = append(psp.gp.templates, psp.tmpl)
+	psp.state = WAITING_FOR_TEMPLATE_PARAM
+}
+
+// placeholder returns a symbol that stands for a template or a parameter.
+// It is never added to the symbol table.
+func placeholder(name string) *symbol {
+	sp := &symbol{name: name, prec: -1, assoc: UNK, type_: NONTERMINAL}
+	if isTerminalName(name) {
+		sp.type_ = TERMINAL
+	}
+	return sp
+}
+
+// param returns the parameter with the name, or nil.
+func (t *ruleTemplate) param(name string) *symbol {
+	for _, p := range t.params {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// rhsSymbol returns the symbol for a name on the RHS of a rule.
+// In the rules of a template, the parameters hide the symbols.
+func (psp *pstate) rhsSymbol(name string) *symbol {
+	if psp.tmpl != nil {
+		if p := psp.tmpl.param(name); p != nil {
+			return p
+		}
+	}
+	if t := psp.templates[name]; t != nil {
+		return t.lhs
+	}
+	return psp.symbolNew(name)
+}
+
+// templateOf returns the template that a symbol stands for, or nil.
+func (psp *pstate) templateOf(sp *symbol) *ruleTemplate {
+	if t := psp.templates[sp.name]; t != nil && t.lhs == sp {
+		return t
+	}
+	return nil
+}
+
+// isSelf returns true if the symbol stands for the template whose rules
+// are being read.
+func (psp *pstate) isSelf(sp *symbol) bool {
+	return psp.tmpl != nil && psp.templateOf(sp) == psp.tmpl
+}
+
+// callLast replaces the template at the end of the RHS with a use of it
+// whose arguments are read next.
+func (psp *pstate) callLast() {
+	t := psp.templateOf(psp.rhs[psp.nrhs-1])
+	psp.rhs, psp.alias, psp.nrhs = psp.rhs[:psp.nrhs-1], psp.alias[:psp.nrhs-1], psp.nrhs-1
+	psp.openCall(t)
+}
+
+// openCall starts the arguments of a template.
+func (psp *pstate) openCall(t *ruleTemplate) {
+	psp.callStack = append(psp.callStack, &templateCall{tmpl: t, lineno: psp.tokenlineno})
+	psp.state = RHS_TEMPLATE_ARGS
+}
+
+// closeCall ends the arguments of the innermost template and returns the
+// symbol for it. The symbol is an instance unless the call is in the rules
+// of a template, where it is replaced when the template is expanded.
+func (psp *pstate) closeCall() *symbol {
+	call := psp.callStack[len(psp.callStack)-1]
+	psp.callStack = psp.callStack[:len(psp.callStack)-1]
+	if len(call.args) != len(call.tmpl.params) {
+		ErrorMsg(psp.filename, psp.tokenlineno, "template %q takes %d arguments, not %d.", call.tmpl.name, len(call.tmpl.params), len(call.args))
+		psp.errorcnt++
+		return nil
+	}
+	for _, arg := range call.args {
+		if t := psp.templateOf(arg); t != nil && t != psp.tmpl {
+			ErrorMsg(psp.filename, psp.tokenlineno, "template %q is used without arguments.", t.name)
+			psp.errorcnt++
+			return nil
+		}
+	}
+	if psp.tmpl == nil {
+		return psp.instance(call.tmpl, call.args, call.lineno)
+	}
+	sp := placeholder(callText(call.tmpl, call.args))
+	psp.calls[sp] = call
+	return sp
+}
+
+// instance returns the nonterminal for a template and its arguments,
+// creating it the first time the arguments are used. Its rules are added
+// by expandTemplates.
+func (psp *pstate) instance(t *ruleTemplate, args []*symbol, lineno int) *symbol {
+	text := callText(t, args)
+	var names []string
+	for _, arg := range args {
+		names = append(names, arg.name)
+	}
+	base := t.name + "_" + strings.Join(names, "_")
+	name := base
+	for n := 2; Symbol_find(name) != nil; n++ {
+		if sp := Symbol_find(name); sp.instance == text {
+			return psp.symbolNew(name)
+		}
+		name = fmt.Sprintf("%s_%d", base, n)
+	}
+	sp := psp.symbolNew(name)
+	sp.instance = text
+	sp.lineno = lineno
+	sp.datatype, sp.dtLineno = t.lhs.datatype, t.lhs.dtLineno
+	sp.destructor, sp.destLineno = t.lhs.destructor, t.lhs.destLineno
+	psp.instances = append(psp.instances, &templateInstance{sp: sp, tmpl: t, args: args})
+	return sp
+}
+
+// expandTemplates adds the rules for every instance of a template. The
+// rules of an instance may create more instances, which are expanded in
+// turn.
+func (psp *pstate) expandTemplates() {
+	empty := make(map[*ruleTemplate]bool)
+	for i := 0; i < len(psp.instances); i++ {
+		if i == maxTemplateInstances {
+			ErrorMsg(psp.filename, psp.instances[i].sp.lineno, "more than %d instances of templates; does a template use itself with longer arguments?", maxTemplateInstances)
+			psp.errorcnt++
+			return
+		}
+		inst := psp.instances[i]
+		if len(inst.tmpl.rules) == 0 {
+			if empty[inst.tmpl] {
+				continue
+			}
+			empty[inst.tmpl] = true
+			ErrorMsg(psp.filename, inst.tmpl.lineno, "template %q has no rules.", inst.tmpl.name)
+			psp.errorcnt++
+			continue
+		}
+		with := map[*symbol]*symbol{inst.tmpl.lhs: inst.sp}
+		for j, p := range inst.tmpl.params {
+			with[p] = inst.args[j]
+		}
+		for _, trp := range inst.tmpl.rules {
+			rp := &rule{
+				lhs:         inst.sp,
+				lhsalias:    trp.lhsalias,
+				ruleline:    trp.ruleline,
+				rhsalias:    append([]string{}, trp.rhsalias...),
+				nrhs:        trp.nrhs,
+				line:        trp.line,
+				code:        trp.code,
+				noCode:      trp.noCode,
+				neverReduce: trp.neverReduce,
+			}
+			for k, sp := range trp.rhs {
+				rp.rhs = append(rp.rhs, psp.substitute(sp, with))
+				if rp.rhsalias[k] != "" {
+					rp.rhs[k].bContent = true
+				}
+			}
+			if trp.precsym != nil {
+				rp.precsym = psp.substitute(trp.precsym, with)
+			}
+			rp.nextlhs = inst.sp.rule
+			inst.sp.rule = rp
+			psp.addRule(rp)
+		}
+	}
+}
+
+// substitute returns the symbol that replaces a symbol from the rules of a
+// template in an instance.
+func (psp *pstate) substitute(sp *symbol, with map[*symbol]*symbol) *symbol {
+	if r, ok := with[sp]; ok {
+		return r
+	} else if call := psp.calls[sp]; call != nil {
+		var args []*symbol
+		for _, arg := range call.args {
+			args = append(args, psp.substitute(arg, with))
+		}
+		return psp.instance(call.tmpl, args, call.lineno)
+	} else if sp.type_ == MULTITERMINAL {
+		msp := &symbol{name: sp.name, type_: MULTITERMINAL}
+		for _, subsym := range sp.subsym {
+			msp.subsym = append(msp.subsym, psp.substitute(subsym, with))
+		}
+		msp.name, msp.nsubsym = msp.subsym[0].name, len(msp.subsym)
+		return msp
+	}
+	return sp
+}
+
+// callText returns the use of a template as it is written in the grammar.
+func callText(t *ruleTemplate, args []*symbol) string {
+	var names []string
+	for _, arg := range args {
+		names = append(names, symbolText(arg))
+	}
+	return t.name + "(" + strings.Join(names, ", ") + ")"
+}
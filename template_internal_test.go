@@ -0,0 +1,170 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+	type test_case struct {
+		id      int
+		grammar string
+		expect  []string // the rules in the order they are numbered, which puts rules with code first
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			grammar: "%template separated_list SEP item.\nseparated_list ::= item.\nseparated_list ::= separated_list SEP item.\nargs ::= LP separated_list(COMMA, expr) RP.\nexpr ::= NUM.\n",
+			expect: []string{
+				"args ::= LP separated_list_COMMA_expr RP.",
+				"expr ::= NUM.",
+				"separated_list_COMMA_expr ::= expr.",
+				"separated_list_COMMA_expr ::= separated_list_COMMA_expr COMMA expr.",
+			},
+		},
+		{id: 2,
+			grammar: "%template option X.\n%type option {int}\noption(A) ::= X(B). { A = B; }\noption(A) ::= . { A = 0; }\nprog ::= option(NUM) option(NUM) option(ID).\n",
+			expect: []string{
+				"option_NUM ::= NUM. { A = B; }",
+				"option_NUM ::=. { A = 0; }",
+				"option_ID ::= ID. { A = B; }",
+				"option_ID ::=. { A = 0; }",
+				"prog ::= option_NUM option_NUM option_ID.",
+			},
+		},
+		{id: 3,
+			grammar: "%template list X.\n%template pair A B.\nlist ::= .\nlist ::= list X.\npair ::= A list(B).\nprog ::= pair(LP, list(NUM)).\n",
+			expect: []string{
+				"prog ::= pair_LP_list_NUM.",
+				"list_NUM ::=.",
+				"list_NUM ::= list_NUM NUM.",
+				"pair_LP_list_NUM ::= LP list_list_NUM.",
+				"list_list_NUM ::=.",
+				"list_list_NUM ::= list_list_NUM list_NUM.",
+			},
+		},
+		{id: 4,
+			grammar: "%template either X Y.\neither ::= X|Y.\nprog ::= either(PLUS, MINUS) NUM. [PLUS]\n",
+			expect:  []string{"prog ::= either_PLUS_MINUS NUM.", "either_PLUS_MINUS ::= PLUS|MINUS."},
+		},
+		{id: 5,
+			grammar: "%template sep S X.\n%type sep {List}\nsep(L) ::= X(I). { L = one(I); }\nsep(L) ::= sep(M) S X(I). { L = add(M, I); }\nprog ::= sep(COMMA, NUM).\n",
+			expect: []string{
+				"sep_COMMA_NUM ::= NUM. { L = one(I); }",
+				"sep_COMMA_NUM ::= sep_COMMA_NUM COMMA NUM. { L = add(M, I); }",
+				"prog ::= sep_COMMA_NUM.",
+			},
+		},
+		{id: 6,
+			grammar: "%template count X.\ncount(L) ::= . { L = 0; }\ncount(L) ::= count(M) X. { L = M + 1; }\nprog ::= count(NUM).\n",
+			expect: []string{
+				"count_NUM ::=. { L = 0; }",
+				"count_NUM ::= count_NUM NUM. { L = M + 1; }",
+				"prog ::= count_NUM.",
+			},
+		},
+		{id: 7,
+			grammar: "%template pair A B.\npair ::= A B.\npair ::= A pair(B, A) B.\nprog ::= pair(X, Y).\n",
+			expect: []string{
+				"prog ::= pair_X_Y.",
+				"pair_X_Y ::= X Y.",
+				"pair_X_Y ::= X pair_Y_X Y.",
+				"pair_Y_X ::= Y X.",
+				"pair_Y_X ::= Y pair_X_Y X.",
+			},
+		},
+	} {
+		lem := parseGrammar(t, tc.grammar)
+		var got []string
+		for rp := lem.rule; rp != nil; rp = rp.next {
+			w := &bytes.Buffer{}
+			rp.printCursor(w, -1)
+			text := w.String() + "."
+			if rp.code != "" {
+				text += " {" + rp.code
+			}
+			got = append(got, text)
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.expect, "\n") {
+			t.Errorf("%d: want\n%s\n%d: got\n%s\n", tc.id, strings.Join(tc.expect, "\n"), tc.id, strings.Join(got, "\n"))
+		}
+		if tc.id == 5 || tc.id == 6 {
+			// the self-reference keeps its alias in the instance
+			if rp := lem.rule.next; rp.lhsalias != "L" || rp.rhsalias[0] != "M" || !rp.rhs[0].bContent {
+				t.Errorf("%d: want the rule to be %s(L) ::= %s(M) ...\n", tc.id, rp.lhs.name, rp.lhs.name)
+			}
+		}
+		if tc.id == 2 {
+			if sp := Symbol_find("option_NUM"); sp == nil || sp.datatype != "{int}" {
+				t.Errorf("%d: want option_NUM to have the type of the template\n", tc.id)
+			}
+			if Symbol_find("option") != nil || Symbol_find("X") != nil {
+				t.Errorf("%d: want no symbols for the template and its parameters\n", tc.id)
+			}
+		}
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	type test_case struct {
+		id      int
+		grammar string
+		expect  []string
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			grammar: "%template pair A B.\npair ::= A B.\nprog ::= pair(X).\n",
+			expect:  []string{`3: template "pair" takes 2 arguments, not 1.`},
+		},
+		{id: 2,
+			grammar: "%template pair A B.\npair ::= A B.\nprog ::= pair X.\n",
+			expect:  []string{`3: template "pair" is used without arguments.`},
+		},
+		{id: 3,
+			grammar: "%template opt X.\nprog ::= opt(A).\n",
+			expect:  []string{`1: template "opt" has no rules.`},
+		},
+		{id: 4,
+			grammar: "%template opt X.\nopt ::= X?.\nprog ::= opt(A).\n",
+			expect:  []string{`2: EBNF shorthand can't be used in the rules of template "opt".`},
+		},
+		{id: 5,
+			grammar: "%template opt.\n",
+			expect:  []string{`1: %template "opt" must have at least one parameter.`},
+		},
+		{id: 6,
+			grammar: "%template opt X.\nopt ::= X.\nprog ::= opt(A.\n",
+			expect:  []string{`3: missing ")" after the arguments of template "opt".`},
+		},
+		{id: 7,
+			grammar: "%template deep X.\ndeep ::= X deep(LP, X).\nprog ::= deep(A).\n",
+			expect:  []string{`2: template "deep" takes 1 arguments, not 2.`},
+		},
+	} {
+		filename := filepath.Join(t.TempDir(), "test.y")
+		if err := os.WriteFile(filename, []byte(tc.grammar), 0644); err != nil {
+			t.Fatal(err)
+		}
+		Symbol_init()
+		Symbol_new("$")
+		lem := &lemon{filename: filename}
+		var got []string
+		msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+			got = append(got, fmt.Sprintf("%d: %s", lineno, msg))
+		}
+		Parse(lem, map[string]string{})
+		msgHook = nil
+		if strings.Join(got, "\n") != strings.Join(tc.expect, "\n") {
+			t.Errorf("%d: want\n%s\n%d: got\n%s\n", tc.id, strings.Join(tc.expect, "\n"), tc.id, strings.Join(got, "\n"))
+		}
+		if lem.errorcnt != len(tc.expect) {
+			t.Errorf("%d: errors: want %d: got %d\n", tc.id, len(tc.expect), lem.errorcnt)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Grammars that share a lexer must agree on the tokens and their numbers.
+// The -tokens option writes the token vocabulary of a grammar, its
+// terminals with their numbers and spellings, its fallbacks, its token
+// classes and the patterns of its lexer, to the *.tokens file. The file is written as declarations:
+//
+//	%token ID = 1 NUM = 2 PLUS = 3 "+".
+//	%fallback ID KEY.
+//
+// Another grammar reads it with
+//
+//	%import_tokens "sql.tokens"
+//
+// which is looked for like a file named by %include_grammar. The numbers
+// from the vocabulary fix the numbers of the terminals of the grammar, and
+// every terminal that the grammar uses must be defined by the vocabulary.
+// The tokens of the vocabulary that the grammar doesn't use aren't reported,
+// and the %wildcard of the grammar doesn't need to be in the vocabulary.
+// A vocabulary may only declare tokens, fallbacks, token classes and the
+// patterns of the lexer.
+
+// vocabularyKeywords are the declarations that a token vocabulary may use.
+var vocabularyKeywords = map[string]bool{
+	"token":         true,
+	"token_class":   true,
+	"fallback":      true,
+	"import_tokens": true,
+	"token_pattern": true,
+	"skip_pattern":  true,
+}
+
+// ReportTokens writes the token vocabulary of a numbered grammar.
+func ReportTokens(w io.Writer, lemp *lemon) error {
+	_, _ = fmt.Fprintf(w, "// The token vocabulary of %s, for %%import_tokens.\n", filepath.Base(lemp.filename))
+
+	// every terminal is written with its number so that the grammars that
+	// import the vocabulary number it the same way. symbol 0 is "$".
+	var names []string
+	for i := 1; i < lemp.nterminal; i++ {
+		sp := lemp.symbols[i]
+		if sp.filler {
+			continue
+		}
+		name := fmt.Sprintf("%s = %d", sp.name, sp.index)
+		if sp.spelling != "" {
+			name += " " + sp.spelling
+		}
+		names = append(names, name)
+	}
+	reprintList(w, "token", names)
+
+	for i := 1; i < lemp.nterminal; i++ {
+		names = []string{lemp.symbols[i].name}
+		for j := 1; j < lemp.nterminal; j++ {
+			if lemp.symbols[j].fallback == lemp.symbols[i] {
+				names = append(names, lemp.symbols[j].name)
+			}
+		}
+		if len(names) > 1 {
+			reprintList(w, "fallback", names)
+		}
+	}
+
+	for i := lemp.nsymbol + 1; i < len(lemp.symbols); i++ {
+		sp := lemp.symbols[i]
+		names = []string{sp.name}
+		for _, subsym := range sp.subsym {
+			names = append(names, subsym.name)
+		}
+		reprintList(w, "token_class", names)
+	}
+	reprintPatterns(w, lemp)
+	return nil
+}
+
+// importTokens reads the token vocabulary named by %import_tokens. The
+// terminals that it names are marked as defined by the vocabulary.
+func (psp *pstate) importTokens(literal string) {
+	name := strings.TrimSuffix(strings.TrimPrefix(literal, `"`), `"`)
+	if _, ok := psp.findInclude(name); !ok {
+		ErrorMsg(psp.filename, psp.tokenlineno, "can't find the token vocabulary %q to import.", name)
+		psp.errorcnt++
+		return
+	}
+	importing := psp.importing
+	psp.importing = name
+	psp.vocabularies = append(psp.vocabularies, name)
+	psp.includeFile(literal)
+	psp.importing = importing
+}
+
+// checkVocabulary reports the terminals of the grammar that aren't defined
+// by an imported token vocabulary.
+func (psp *pstate) checkVocabulary() {
+	if len(psp.vocabularies) == 0 {
+		return
+	}
+	var undefined []*symbol
+	for _, sp := range Symbol_arrayOf() {
+		if sp.type_ == TERMINAL && sp.vocabulary == "" && sp.name != "$" && sp != psp.gp.wildcard {
+			undefined = append(undefined, sp)
+		}
+	}
+	sort.Slice(undefined, func(i, j int) bool {
+		return undefined[i].index < undefined[j].index
+	})
+	var names []string
+	for _, name := range psp.vocabularies {
+		names = append(names, fmt.Sprintf("%q", name))
+	}
+	for _, sp := range undefined {
+		ErrorMsg(psp.filename, sp.lineno, "token %q is not defined by the token vocabulary %s.", sp.name, strings.Join(names, " or "))
+		psp.errorcnt++
+	}
+}
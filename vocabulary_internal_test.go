@@ -0,0 +1,147 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTokenVocabulary(t *testing.T) {
+	lem := parseGrammar(t, "%token PLUS \"+\" MINUS \"-\".\n%token ID = 7 NUM.\n%fallback ID KEY.\n%token_class value ID|NUM.\n"+
+		"prog ::= expr.\nexpr ::= expr \"+\" term.\nexpr ::= expr \"-\" term.\nexpr ::= term.\nterm ::= value.\nterm ::= KEY.\n")
+	w := &bytes.Buffer{}
+	if err := ReportTokens(w, lem); err != nil {
+		t.Fatal(err)
+	}
+	expect := "// The token vocabulary of test.y, for %import_tokens.\n" +
+		"%token PLUS = 1 \"+\" MINUS = 2 \"-\" NUM = 3 KEY = 4 ID = 7.\n" +
+		"%fallback ID KEY.\n" +
+		"%token_class value ID NUM.\n"
+	if w.String() != expect {
+		t.Fatalf("tokens: want\n%s\ntokens: got\n%s\n", expect, w.String())
+	}
+
+	// a grammar that imports the vocabulary numbers its tokens the same
+	// way, even when it uses them in another order or not at all.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "expr.tokens"), w.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "calc.y"), []byte("%import_tokens \"expr.tokens\"\nsum ::= NUM \"+\" ID.\nsum ::= KEY \"-\" value.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Symbol_init()
+	State_init()
+	Symbol_new("$")
+	lem = &lemon{filename: filepath.Join(dir, "calc.y"), warnings: newWarningFlags()}
+	var got []string
+	msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+		got = append(got, fmt.Sprintf("%d: %s", lineno, msg))
+	}
+	Parse(lem, map[string]string{})
+	if lem.errorcnt == 0 {
+		if err := numberGrammar(lem); err != nil {
+			t.Fatal(err)
+		}
+		analyzeGrammar(lem)
+	}
+	msgHook = nil
+	if len(got) != 0 {
+		t.Errorf("import: want no messages: got\n%s\n", strings.Join(got, "\n"))
+	}
+	got = nil
+	for i := 1; i < lem.nterminal; i++ {
+		got = append(got, fmt.Sprintf("%d %s", lem.symbols[i].index, lem.symbols[i].name))
+	}
+	if expect := "1 PLUS\n2 MINUS\n3 NUM\n4 KEY\n5 UNUSED_5\n6 UNUSED_6\n7 ID"; strings.Join(got, "\n") != expect {
+		t.Errorf("import: want\n%s\nimport: got\n%s\n", expect, strings.Join(got, "\n"))
+	}
+	if key := Symbol_find("KEY"); key.fallback != Symbol_find("ID") {
+		t.Errorf("import: want KEY to fall back to ID\n")
+	}
+}
+
+func TestTokenVocabularyErrors(t *testing.T) {
+	type test_case struct {
+		id     int
+		files  map[string]string // the grammar is "main.y"
+		expect []string          // the messages, as file:line: message
+	}
+	for _, tc := range []test_case{
+		{id: 1,
+			files: map[string]string{
+				"main.y":   "%import_tokens \"a.tokens\"\nprog ::= A B.\nprog ::= C.\n",
+				"a.tokens": "%token A = 1 B = 2.\n",
+			},
+			expect: []string{`main.y:3: token "C" is not defined by the token vocabulary "a.tokens".`},
+		},
+		{id: 2,
+			files: map[string]string{
+				"main.y":   "%import_tokens \"a.tokens\"\n%import_tokens \"b.tokens\"\n%wildcard ANY.\nprog ::= A B ANY.\nprog ::= C.\n",
+				"a.tokens": "%token A.\n",
+				"b.tokens": "%token B.\n",
+			},
+			expect: []string{`main.y:5: token "C" is not defined by the token vocabulary "a.tokens" or "b.tokens".`},
+		},
+		{id: 3,
+			files: map[string]string{
+				"main.y":   "%import_tokens \"a.tokens\"\nprog ::= A.\n",
+				"a.tokens": "%token A.\nb ::= A.\n%type A {int}\n",
+			},
+			expect: []string{
+				`a.tokens:2: the token vocabulary "a.tokens" can only declare tokens, not "b".`,
+				`a.tokens:3: the token vocabulary "a.tokens" can only declare tokens, not "%type".`,
+			},
+		},
+		{id: 4,
+			files:  map[string]string{"main.y": "%import_tokens \"missing.tokens\"\nprog ::= A.\n"},
+			expect: []string{`main.y:1: can't find the token vocabulary "missing.tokens" to import.`},
+		},
+		{id: 5,
+			files:  map[string]string{"main.y": "%import_tokens missing\nprog ::= A.\n"},
+			expect: []string{`main.y:1: %import_tokens needs the name of a file in quotes, not "missing".`},
+		},
+		{id: 6,
+			files: map[string]string{
+				"main.y":   "%import_tokens \"a.tokens\"\nprog ::= A.\n",
+				"a.tokens": "%token A.\n%import_tokens \"a.tokens\"\n",
+			},
+			expect: []string{`a.tokens:2: "a.tokens" includes itself: a.tokens -> a.tokens.`},
+		},
+	} {
+		dir := t.TempDir()
+		for name, text := range tc.files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		Symbol_init()
+		State_init()
+		Symbol_new("$")
+		lem := &lemon{filename: filepath.Join(dir, "main.y"), warnings: newWarningFlags()}
+		var got []string
+		msgHook = func(filename string, lineno int, isWarning bool, msg string) {
+			got = append(got, fmt.Sprintf("%s:%d: %s", filename, lineno, msg))
+		}
+		Parse(lem, map[string]string{})
+		if lem.errorcnt == 0 {
+			if err := numberGrammar(lem); err != nil {
+				t.Fatal(err)
+			}
+			analyzeGrammar(lem)
+		}
+		msgHook = nil
+		for i := range got {
+			got[i] = strings.ReplaceAll(got[i], dir+string(filepath.Separator), "")
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.expect, "\n") {
+			t.Errorf("%d: want\n%s\n%d: got\n%s\n", tc.id, strings.Join(tc.expect, "\n"), tc.id, strings.Join(got, "\n"))
+		}
+	}
+}
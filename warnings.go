@@ -0,0 +1,242 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// warningFlags records which categories of warnings are reported
+// and which of those are reported as errors.
+type warningFlags struct {
+	enabled [len(e_warning_names)]bool
+	isError [len(e_warning_names)]bool
+}
+
+// newWarningFlags returns the default warnings.
+func newWarningFlags() *warningFlags {
+	w := &warningFlags{}
+	for _, category := range []e_warning{CONFLICTS, UNUSED_SYMBOL, UNUSED_ALIAS, NEVER_REDUCED_RULE, MISSPELLED_SYMBOL, UNREACHABLE_SYMBOL, TERMINAL_TYPE, NON_PRODUCTIVE_SYMBOL, LEXER} {
+		w.enabled[category] = true
+	}
+	return w
+}
+
+// lookup returns the category with the given name.
+func (w *warningFlags) lookup(name string) (e_warning, error) {
+	for category, categoryName := range e_warning_names {
+		if name == categoryName {
+			return e_warning(category), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown warning category %q (want one of %s)", name, strings.Join(e_warning_names[:], ", "))
+}
+
+// warningFlag implements the flag.Value interface for "-W".
+// The value is a category name, "no-" and a category name, "all" or "none".
+type warningFlag struct {
+	w *warningFlags
+}
+
+// String implements the flag.Value interface.
+func (f warningFlag) String() string {
+	if f.w == nil {
+		return ""
+	}
+	var names []string
+	for category, enabled := range f.w.enabled {
+		if enabled {
+			names = append(names, e_warning_names[category])
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Set implements the flag.Value interface.
+func (f warningFlag) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		switch name {
+		case "all", "none":
+			for category := range f.w.enabled {
+				f.w.enabled[category] = name == "all"
+			}
+			continue
+		}
+		enable := !strings.HasPrefix(name, "no-")
+		category, err := f.w.lookup(strings.TrimPrefix(name, "no-"))
+		if err != nil {
+			return err
+		}
+		f.w.enabled[category] = enable
+	}
+	return nil
+}
+
+// werrorFlag implements the flag.Value interface for "-Werror".
+// Without a value, every warning is reported as an error. Otherwise,
+// the value is a list of categories that are reported as errors, which
+// can't include "counterexamples" since it isn't a warning.
+type werrorFlag struct {
+	w *warningFlags
+}
+
+// IsBoolFlag allows "-Werror" to be used without a value.
+func (f werrorFlag) IsBoolFlag() bool {
+	return true
+}
+
+// String implements the flag.Value interface.
+func (f werrorFlag) String() string {
+	if f.w == nil {
+		return ""
+	}
+	var names []string
+	for category, isError := range f.w.isError {
+		if isError {
+			names = append(names, e_warning_names[category])
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Set implements the flag.Value interface.
+func (f werrorFlag) Set(value string) error {
+	if value == "true" || value == "false" {
+		for category := range f.w.isError {
+			f.w.isError[category] = value == "true"
+		}
+		return nil
+	}
+	for _, name := range strings.Split(value, ",") {
+		category, err := f.w.lookup(name)
+		if err != nil {
+			return err
+		} else if category == COUNTEREXAMPLES {
+			return fmt.Errorf("%q only adds examples to the conflicts, so it can't be an error; use -Werror=conflicts", name)
+		}
+		// promoting a warning to an error implies enabling it
+		f.w.enabled[category], f.w.isError[category] = true, true
+	}
+	return nil
+}
+
+// normalizeWarningArgs rewrites the GCC style "-Wname" and "-Wno-name" into
+// "-W=name" so that the flag package will accept them.
+func normalizeWarningArgs(args []string) []string {
+	var normalized []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-W") && len(arg) > 2 && arg[2] != '=' && !strings.HasPrefix(arg, "-Werror") {
+			arg = "-W=" + arg[2:]
+		}
+		normalized = append(normalized, arg)
+	}
+	return normalized
+}
+
+// warningMsg reports a warning in the given category.
+// Nothing is reported if the category is disabled.
+// If the category has been promoted to an error, the error count is
+// incremented instead of the warning count.
+func (lemp *lemon) warningMsg(category e_warning, filename string, lineno int, format string, args ...any) {
+	if !lemp.warningEnabled(category) {
+		return
+	}
+	kind, option := "warning", "-W"+category.String()
+	if lemp.warnings.isError[category] {
+		kind, option = "error", "-Werror="+category.String()
+		lemp.errorcnt++
+	} else {
+		lemp.nwarning++
+	}
+	msg := fmt.Sprintf(format, args...)
+	filename, lineno = sourcePosition(filename, lineno)
+	if msgHook != nil {
+		msgHook(filename, lineno, kind == "warning", fmt.Sprintf("%s [%s]", msg, option))
+	} else if lineno > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "%s:%d: %s: %s [%s]\n", filename, lineno, kind, msg, option)
+	} else {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: %s: %s [%s]\n", filename, kind, msg, option)
+	}
+}
+
+// warningEnabled returns true if the category of warnings is reported.
+func (lemp *lemon) warningEnabled(category e_warning) bool {
+	if lemp.warnings == nil {
+		lemp.warnings = newWarningFlags()
+	}
+	return lemp.warnings.enabled[category]
+}
+
+// noteMsg adds detail to the warning or error that was just reported.
+func (lemp *lemon) noteMsg(filename string, lineno int, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if msgHook != nil {
+		msgHook(filename, lineno, true, "note: "+msg)
+	} else if lineno > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "%s:%d: note: %s\n", filename, lineno, msg)
+	} else {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: note: %s\n", filename, msg)
+	}
+}
+
+// FindUnusedAliases warns about aliases that aren't used in the code for their rule.
+// Like the C version of lemon, it looks for the alias as an identifier
+// anywhere in the code. An alias may also be used by a mid-rule action.
+func FindUnusedAliases(lemp *lemon) {
+	for rp := lemp.rule; rp != nil; rp = rp.next {
+		used := make(map[string]bool)
+		for _, ident := range identifiersIn(rp.code) {
+			used[ident] = true
+		}
+		for _, sp := range rp.rhs {
+			if mid := sp.rule; mid != nil && mid.context != nil {
+				for _, ident := range identifiersIn(mid.code) {
+					used[ident] = true
+				}
+			}
+		}
+		if rp.lhsalias != "" && !used[rp.lhsalias] {
+			lemp.warningMsg(UNUSED_ALIAS, lemp.filename, rp.ruleline, "Label \"%s\" for \"%s(%s)\" is never used.", rp.lhsalias, rp.lhs.name, rp.lhsalias)
+		}
+		for i, alias := range rp.rhsalias {
+			if alias != "" && !used[alias] {
+				lemp.warningMsg(UNUSED_ALIAS, lemp.filename, rp.ruleline, "Label \"%s\" for \"%s(%s)\" is never used.", alias, rp.rhs[i].name, alias)
+			}
+		}
+	}
+}
+
+// FindUselessPrecedence warns about tokens whose precedence never resolves
+// a conflict. It must be called after FindActions.
+func FindUselessPrecedence(lemp *lemon) {
+	for i := 1; i < lemp.nterminal; i++ {
+		sp := lemp.symbols[i]
+		if sp.prec >= 0 && !sp.precUsed {
+			lemp.warningMsg(USELESS_PRECEDENCE, lemp.filename, sp.lineno, "The precedence of \"%s\" is never used to resolve a conflict.", sp.name)
+		}
+	}
+}
+
+// identifiersIn returns the identifiers in a block of code.
+func identifiersIn(code string) (idents []string) {
+	for i := 0; i < len(code); {
+		if isalpha(code[i]) || code[i] == '_' {
+			j := i + 1
+			for j < len(code) && (isalnum(code[j]) || code[j] == '_') {
+				j++
+			}
+			idents = append(idents, code[i:j])
+			i = j
+		} else if isalnum(code[i]) { // skip numbers so that suffixes aren't taken as identifiers
+			for i < len(code) && (isalnum(code[i]) || code[i] == '_') {
+				i++
+			}
+		} else {
+			i++
+		}
+	}
+	return idents
+}
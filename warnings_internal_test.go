@@ -0,0 +1,81 @@
+// lemon - a parser generator
+// Copyright (c) 2023 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWarnings(t *testing.T) {
+	type test_case struct {
+		id       int
+		flags    []string // -W and -Werror options
+		grammar  string
+		warnings int
+		errors   int
+	}
+	conflict := "s ::= e.\ne ::= e PLUS e.\ne ::= N.\n"
+	for _, tc := range []test_case{
+		{id: 1, grammar: conflict, warnings: 1},
+		{id: 2, flags: []string{"-Wno-conflicts"}, grammar: conflict},
+		{id: 3, flags: []string{"-Werror"}, grammar: conflict, errors: 1},
+		{id: 4, flags: []string{"-Werror=unused-alias"}, grammar: conflict, warnings: 1},
+		{id: 5, grammar: "%left PLUS.\n" + conflict},
+		{id: 6, flags: []string{"-Wuseless-precedence"}, grammar: "%left PLUS TIMES.\n" + conflict, warnings: 2},
+		{id: 7, grammar: "%token UNUSED.\ns(A) ::= e(B). { use(B); }\ne ::= N.\n", warnings: 2},
+		{id: 8, flags: []string{"-Wnone"}, grammar: "%token UNUSED.\ns(A) ::= e(B). { use(B); }\ne ::= N.\n"},
+		{id: 9, grammar: "%fallback ID KW.\ns ::= ID.\n"},
+		{id: 10, grammar: "s ::= e.\ne ::= N.\ne ::= N.\n", warnings: 2},
+		{id: 11, grammar: "%left PLUS.\ns ::= e.\ne ::= e PLUS N.\ne ::= N PLSU N.\ne ::= N.\n", warnings: 1},
+		{id: 12, grammar: "s ::= p.\np ::= LPAREN p RPAREN.\np ::= N.\n"},
+		{id: 13, flags: []string{"-Wno-misspelled-symbol"}, grammar: "%left PLUS.\ns ::= e.\ne ::= e PLUS N.\ne ::= N PLSU N.\ne ::= N.\n"},
+		{id: 14, grammar: "%expect 1\n" + conflict},
+		{id: 15, grammar: "%expect 2\n" + conflict, warnings: 1, errors: 1},
+		{id: 16, grammar: "%expect_rr 0\n" + conflict, warnings: 1, errors: 1},
+		{id: 17, grammar: "%expect 0\n%expect_rr 1\ns ::= e.\ne ::= N.\ne ::= N.\n", warnings: 1},
+		{id: 18, grammar: "%expect many\n" + conflict, warnings: 1, errors: 1},
+		{id: 19, grammar: "s ::= e(B) { open(B); } N.\ne ::= N.\n"},
+		{id: 20, grammar: "s ::= e(B) { open(); } N.\ne ::= N.\n", warnings: 1},
+		{id: 21, grammar: "%fallback ID KW1 KW2.\ns ::= ID KW1.\n"},
+	} {
+		lem := parseGrammar(t, tc.grammar)
+		lem.warnings = newWarningFlags()
+		for _, arg := range normalizeWarningArgs(tc.flags) {
+			var err error
+			if arg == "-Werror" {
+				err = werrorFlag{lem.warnings}.Set("true")
+			} else if value, ok := strings.CutPrefix(arg, "-Werror="); ok {
+				err = werrorFlag{lem.warnings}.Set(value)
+			} else if value, ok := strings.CutPrefix(arg, "-W="); ok {
+				err = warningFlag{lem.warnings}.Set(value)
+			}
+			if err != nil {
+				t.Fatalf("%d: %s: %v\n", tc.id, arg, err)
+			}
+		}
+		analyzeGrammar(lem)
+		if lem.nwarning != tc.warnings {
+			t.Errorf("%d: warnings: want %d: got %d\n", tc.id, tc.warnings, lem.nwarning)
+		}
+		if lem.errorcnt != tc.errors {
+			t.Errorf("%d: errors: want %d: got %d\n", tc.id, tc.errors, lem.errorcnt)
+		}
+	}
+}
+
+func TestWarningFlags(t *testing.T) {
+	w := newWarningFlags()
+	if err := (warningFlag{w}).Set("bogus"); err == nil {
+		t.Errorf("warning flag: want error for unknown category\n")
+	}
+	if err := (werrorFlag{w}).Set("counterexamples"); err == nil || w.isError[COUNTEREXAMPLES] {
+		t.Errorf("werror flag: want error for counterexamples\n")
+	}
+	if err := (warningFlag{w}).Set("none,useless-precedence"); err != nil {
+		t.Fatalf("warning flag: %v\n", err)
+	} else if got := (warningFlag{w}).String(); got != "useless-precedence" {
+		t.Errorf("warning flag: want %q: got %q\n", "useless-precedence", got)
+	}
+}